@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/1412335/the-blockchain-bar/database"
+	"github.com/spf13/cobra"
+)
+
+const flagAccount = "account"
+const flagCursor = "cursor"
+const flagLimit = "limit"
+
+func accountCmd() *cobra.Command {
+	var accountCmd = &cobra.Command{
+		Use:   "account",
+		Short: "Inspect accounts",
+		Run: func(cmd *cobra.Command, args []string) {
+
+		},
+	}
+
+	accountCmd.AddCommand(accountHistoryCmd())
+
+	return accountCmd
+}
+
+func accountHistoryCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "history",
+		Short: "List the transactions sent or received by an account, newest first",
+		Run: func(cmd *cobra.Command, args []string) {
+			accountRaw, _ := cmd.Flags().GetString(flagAccount)
+			cursor, _ := cmd.Flags().GetString(flagCursor)
+			limit, _ := cmd.Flags().GetInt(flagLimit)
+
+			state, err := database.NewStateFromDisk(getDataDirFromCmd(cmd))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			defer state.Close()
+
+			account := database.NewAccount(accountRaw)
+			txs, next, err := state.AccountTxs(account, cursor, limit)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Transactions of %s:\n", account.Hex())
+			fmt.Println("__________________")
+			fmt.Println("")
+			for _, tx := range txs {
+				direction := "IN "
+				if tx.Tx.From == account {
+					direction = "OUT"
+				}
+				fmt.Printf("#%d:%d %s %x %s -> %s: %s\n", tx.BlockNumber, tx.Index, direction, tx.Hash, tx.Tx.From.Hex(), tx.Tx.To.Hex(), state.Denomination().Format(tx.Tx.Value))
+			}
+
+			if next != "" {
+				fmt.Printf("\nNext page: --%s %s\n", flagCursor, next)
+			}
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+	cmd.Flags().String(flagAccount, "", "Account address")
+	cmd.MarkFlagRequired(flagAccount)
+	cmd.Flags().String(flagCursor, "", "Cursor returned by the previous page")
+	cmd.Flags().Int(flagLimit, database.DefaultAccountTxsLimit, "Transactions per page")
+
+	return cmd
+}
@@ -9,6 +9,7 @@ import (
 )
 
 const flagDataDir = "db"
+const flagAt = "at"
 
 func balancesCmd() *cobra.Command {
 	var balancesCmd = &cobra.Command{
@@ -37,16 +38,50 @@ func balancesListCmd() *cobra.Command {
 			}
 			defer state.Close()
 
-			fmt.Printf("Accounts balances at %x:\n", state.LatestBlockHash())
+			hash, balances, denomination := state.LatestBlockHash(), state.Balances, state.Denomination()
+
+			at, _ := cmd.Flags().GetString(flagAt)
+			asset, _ := cmd.Flags().GetString(flagAsset)
+			if asset != "" {
+				if at != "" {
+					fmt.Fprintln(os.Stderr, fmt.Errorf("only the latest balances of a token are kept, --%s can't be set with --%s", flagAt, flagAsset))
+					os.Exit(1)
+				}
+				token, ok := state.Token(asset)
+				if !ok {
+					fmt.Fprintln(os.Stderr, fmt.Errorf("unknown token '%s'", asset))
+					os.Exit(1)
+				}
+
+				balances = token.Balances
+				denomination, _ = state.AssetDenomination(asset)
+				fmt.Printf("Token %s issued by %s, supply %s\n", asset, token.Issuer.Hex(), denomination.Format(token.Supply))
+			} else if at != "" {
+				number, err := state.ResolveBlockNumber(at)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+
+				balances, hash, err = state.BalancesAt(number)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+			}
+
+			fmt.Printf("Accounts balances at %x:\n", hash)
 			fmt.Println("__________________")
 			fmt.Println("")
-			for account, balance := range state.Balances {
-				fmt.Printf("%s: %d\n", account.Hex(), balance)
+			for account, balance := range balances {
+				fmt.Printf("%s: %s\n", account.Hex(), denomination.Format(balance))
 			}
 		},
 	}
 
 	addDefaultRequiredFlags(balancesListCmd)
+	balancesListCmd.Flags().String(flagAt, "", "Block height or block hash to list the balances at")
+	balancesListCmd.Flags().String(flagAsset, "", "Token symbol to list the latest balances of, the native currency when empty")
 	return balancesListCmd
 }
 
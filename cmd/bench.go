@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/1412335/the-blockchain-bar/database"
+	"github.com/spf13/cobra"
+)
+
+const flagWorkers = "workers"
+const flagDuration = "duration"
+
+func benchCmd() *cobra.Command {
+	var benchCmd = &cobra.Command{
+		Use:   "bench",
+		Short: "Measure the node performance",
+		Run: func(cmd *cobra.Command, args []string) {
+
+		},
+	}
+
+	benchCmd.AddCommand(benchMineCmd())
+
+	return benchCmd
+}
+
+func benchMineCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "mine",
+		Short: "Measure the proof-of-work hashrate",
+		Run: func(cmd *cobra.Command, args []string) {
+			workers, _ := cmd.Flags().GetInt(flagWorkers)
+			duration, _ := cmd.Flags().GetDuration(flagDuration)
+
+			engine := database.NewPoW()
+			engine.SetWorkers(workers)
+
+			ctx, cancel := context.WithTimeout(context.Background(), duration)
+			defer cancel()
+
+			// a block is sealed over and over until the time is up
+			blocks := 0
+			hashes := float64(0)
+			start := time.Now()
+			for ctx.Err() == nil {
+				sealStart := time.Now()
+				block := database.NewBlock(database.Hash{}, uint64(blocks), uint64(time.Now().Unix()), 0, database.Account{}, nil)
+				_, err := engine.Seal(ctx, nil, block)
+
+				hashes += engine.Hashrate() * time.Since(sealStart).Seconds()
+				if err != nil && ctx.Err() == nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+				if err == nil {
+					blocks++
+				}
+			}
+			elapsed := time.Since(start)
+
+			fmt.Printf("\nWorkers: %d\n", engine.Workers())
+			fmt.Printf("Duration: %s\n", elapsed.Round(time.Millisecond))
+			fmt.Printf("Hashrate: %.0f H/s\n", hashes/elapsed.Seconds())
+			fmt.Printf("Blocks found: %d\n", blocks)
+		},
+	}
+
+	cmd.Flags().Int(flagWorkers, 0, "Number of mining goroutines, 0 for one per CPU")
+	cmd.Flags().Duration(flagDuration, 10*time.Second, "How long to mine")
+
+	return cmd
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/1412335/the-blockchain-bar/database"
+	"github.com/spf13/cobra"
+)
+
+const flagJSON = "json"
+const flagFormat = "format"
+const flagChainFile = "file"
+const importProgressInterval = time.Second
+
+func chainCmd() *cobra.Command {
+	var chainCmd = &cobra.Command{
+		Use:   "chain",
+		Short: "Audit, export and import the blockchain",
+		Run: func(cmd *cobra.Command, args []string) {
+
+		},
+	}
+
+	chainCmd.AddCommand(chainVerifyCmd())
+	chainCmd.AddCommand(chainExportCmd())
+	chainCmd.AddCommand(chainImportCmd())
+
+	return chainCmd
+}
+
+func chainVerifyCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "verify",
+		Short: "Replay blocks.db from genesis checking every block, its TX signatures and balances",
+		Run: func(cmd *cobra.Command, args []string) {
+			workers, _ := cmd.Flags().GetInt(flagWorkers)
+			asJSON, _ := cmd.Flags().GetBool(flagJSON)
+
+			start := time.Now()
+			report, err := database.VerifyChain(getDataDirFromCmd(cmd), workers)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			if asJSON {
+				reportJSON, err := json.MarshalIndent(report, "", "  ")
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+				fmt.Println(string(reportJSON))
+			} else {
+				fmt.Printf("Verified %d blocks and %d TXs in %s\n", report.Blocks, report.TXs, time.Since(start).Round(time.Millisecond))
+				if report.Blocks > 0 {
+					fmt.Printf("Latest valid block %d: %x\n", report.LatestNumber, report.LatestHash)
+				}
+				if report.Problem != nil {
+					fmt.Printf("Bad block %d '%x' at offset %d: %s\n", report.Problem.Number, report.Problem.Hash, report.Problem.Offset, report.Problem.Reason)
+				}
+			}
+
+			if report.Problem != nil {
+				os.Exit(1)
+			}
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+	cmd.Flags().Int(flagWorkers, 0, "Number of signature checking goroutines, 0 for one per CPU")
+	cmd.Flags().Bool(flagJSON, false, "Print the report as JSON")
+
+	return cmd
+}
+
+func chainExportCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "export",
+		Short: "Write blocks into a portable file for 'tbb chain import'",
+		Run: func(cmd *cobra.Command, args []string) {
+			from, _ := cmd.Flags().GetUint64(flagFrom)
+			to, _ := cmd.Flags().GetUint64(flagTo)
+			format, _ := cmd.Flags().GetString(flagFormat)
+			file, _ := cmd.Flags().GetString(flagChainFile)
+
+			state, err := database.NewStateFromDisk(getDataDirFromCmd(cmd))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			defer state.Close()
+
+			f, err := os.Create(file)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			defer f.Close()
+
+			if err := state.Export(f, from, to, format); err != nil {
+				f.Close()
+				os.Remove(file)
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			if latest := state.LatestBlock().Header.Number; to > latest {
+				to = latest
+			}
+			fmt.Printf("Exported blocks %d to %d into %s\n", from, to, file)
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+	cmd.Flags().Uint64(flagFrom, 0, "First block to export")
+	cmd.Flags().Uint64(flagTo, math.MaxUint64, "Last block to export, the latest one by default")
+	cmd.Flags().String(flagFormat, database.ExportFormatJSON, fmt.Sprintf("Either '%s' or the compressed '%s'", database.ExportFormatJSON, database.ExportFormatGzip))
+	cmd.Flags().String(flagChainFile, "", "Export file")
+	cmd.MarkFlagRequired(flagChainFile)
+
+	return cmd
+}
+
+func chainImportCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "import",
+		Short: "Validate and add the blocks of a 'tbb chain export' file, an interrupted import resumes when run again",
+		Run: func(cmd *cobra.Command, args []string) {
+			file, _ := cmd.Flags().GetString(flagChainFile)
+
+			f, err := os.Open(file)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			defer f.Close()
+
+			state, err := database.NewStateFromDisk(getDataDirFromCmd(cmd))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			defer state.Close()
+
+			lastReport := time.Now()
+			result, err := state.Import(f, func(progress database.ImportProgress) {
+				if time.Since(lastReport) < importProgressInterval {
+					return
+				}
+				lastReport = time.Now()
+				fmt.Printf("Imported block %d/%d (%d new, %d already known)\n", progress.Number, progress.Header.To, progress.Imported, progress.Skipped)
+			})
+
+			fmt.Printf("Imported %d new blocks, %d were already known, chain is at block %d\n", result.Imported, result.Skipped, state.LatestBlock().Header.Number)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Import stopped: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+	cmd.Flags().String(flagChainFile, "", "File written by 'tbb chain export'")
+	cmd.MarkFlagRequired(flagChainFile)
+
+	return cmd
+}
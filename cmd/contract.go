@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/1412335/the-blockchain-bar/database"
+	"github.com/1412335/the-blockchain-bar/node"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+)
+
+const flagCode = "code"
+const flagContract = "contract"
+const flagArgs = "args"
+const flagGas = "gas"
+
+const defaultGasLimit = 10000
+
+func txContractCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "contract",
+		Short: "Deploy and call contracts",
+		Run: func(cmd *cobra.Command, args []string) {
+
+		},
+	}
+
+	cmd.AddCommand(txContractDeployCmd())
+	cmd.AddCommand(txContractCallCmd())
+	cmd.AddCommand(txContractShowCmd())
+
+	return cmd
+}
+
+func txContractDeployCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "deploy",
+		Short: "Assemble a contract and deploy it",
+		Run: func(cmd *cobra.Command, args []string) {
+			from, _ := cmd.Flags().GetString(flagFrom)
+			file, _ := cmd.Flags().GetString(flagCode)
+
+			src, err := ioutil.ReadFile(file)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			code, err := database.Assemble(string(src))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, fmt.Errorf("%s: %v", file, err))
+				os.Exit(1)
+			}
+
+			gas, fee := getGasFromCmd(cmd)
+			hash := sendTx(cmd, node.TxAddReq{
+				From:     from,
+				Data:     hex.EncodeToString(code),
+				Fee:      fee,
+				Type:     database.TxTypeContractDeploy,
+				GasLimit: gas,
+			})
+			fmt.Printf("Contract: %s\n", database.ContractAccount(hash).Hex())
+		},
+	}
+
+	addContractFlags(cmd, "Creator account")
+
+	cmd.Flags().String(flagCode, "", "Path to the contract assembly")
+	cmd.MarkFlagRequired(flagCode)
+
+	return cmd
+}
+
+func txContractCallCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "call",
+		Short: "Call a contract with arguments, its result goes into the receipt",
+		Run: func(cmd *cobra.Command, args []string) {
+			from, _ := cmd.Flags().GetString(flagFrom)
+			callArgs, _ := cmd.Flags().GetString(flagArgs)
+
+			if _, err := database.ParseContractArgs(callArgs); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			gas, fee := getGasFromCmd(cmd)
+			sendTx(cmd, node.TxAddReq{
+				From:     from,
+				To:       getContractFromCmd(cmd).Hex(),
+				Data:     callArgs,
+				Fee:      fee,
+				Type:     database.TxTypeContractCall,
+				GasLimit: gas,
+			})
+		},
+	}
+
+	addContractFlags(cmd, "Caller account")
+
+	cmd.Flags().String(flagContract, "", "Contract account")
+	cmd.MarkFlagRequired(flagContract)
+
+	cmd.Flags().String(flagArgs, "", "Space separated decimal arguments, e.g. '1 42'")
+
+	return cmd
+}
+
+func txContractShowCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "show",
+		Short: "Print a contract with its storage",
+		Run: func(cmd *cobra.Command, args []string) {
+			address, _ := cmd.Flags().GetString(flagNode)
+
+			contract, err := node.QueryContract(context.Background(), address, getContractFromCmd(cmd))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Contract %s\n", contract.Account.Hex())
+			fmt.Printf("\tCreator: %s\n", contract.Creator.Hex())
+			fmt.Printf("\tCode: %d bytes\n", len(contract.Code)/2)
+
+			keys := make([]uint64, 0, len(contract.Storage))
+			for key := range contract.Storage {
+				keys = append(keys, key)
+			}
+			sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+			for _, key := range keys {
+				fmt.Printf("\tStorage %d: %d\n", key, contract.Storage[key])
+			}
+		},
+	}
+
+	cmd.Flags().String(flagNode, fmt.Sprintf("%s:%d", DefaultIP, DefaultHTTPort), "Node HTTP address")
+
+	cmd.Flags().String(flagContract, "", "Contract account")
+	cmd.MarkFlagRequired(flagContract)
+
+	return cmd
+}
+
+func addContractFlags(cmd *cobra.Command, fromUsage string) {
+	cmd.Flags().String(flagNode, fmt.Sprintf("%s:%d", DefaultIP, DefaultHTTPort), "Node HTTP address")
+
+	cmd.Flags().String(flagFrom, "", fromUsage)
+	cmd.MarkFlagRequired(flagFrom)
+
+	cmd.Flags().Uint64(flagGas, defaultGasLimit, fmt.Sprintf("Gas limit, up to %d", database.MaxGasLimit))
+	cmd.Flags().Uint64(flagFee, 0, "Fee paid to the miner in the smallest unit, covering at least the gas limit, the gas limit when 0")
+
+	addWaitFlags(cmd)
+}
+
+// getGasFromCmd returns the gas limit and the fee paying for it.
+func getGasFromCmd(cmd *cobra.Command) (uint64, database.Amount) {
+	gas, _ := cmd.Flags().GetUint64(flagGas)
+	fee, _ := cmd.Flags().GetUint64(flagFee)
+	if fee == 0 {
+		fee = gas
+	}
+	return gas, database.Amount(fee)
+}
+
+func getContractFromCmd(cmd *cobra.Command) database.Account {
+	raw, _ := cmd.Flags().GetString(flagContract)
+	if !common.IsHexAddress(raw) {
+		fmt.Fprintln(os.Stderr, fmt.Errorf("invalid contract account '%s'", raw))
+		os.Exit(1)
+	}
+	return database.NewAccount(raw)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/1412335/the-blockchain-bar/database"
+	"github.com/spf13/cobra"
+)
+
+const flagRepair = "repair"
+const flagKeep = "keep"
+
+func dbCmd() *cobra.Command {
+	var dbCmd = &cobra.Command{
+		Use:   "db",
+		Short: "Maintain the blocks database",
+		Run: func(cmd *cobra.Command, args []string) {
+
+		},
+	}
+
+	dbCmd.AddCommand(dbCheckCmd())
+	dbCmd.AddCommand(dbReindexCmd())
+	dbCmd.AddCommand(dbPruneCmd())
+
+	return dbCmd
+}
+
+func dbCheckCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "check",
+		Short: "Report (and optionally repair) corrupted records of blocks.db",
+		Run: func(cmd *cobra.Command, args []string) {
+			repair, _ := cmd.Flags().GetBool(flagRepair)
+
+			report, err := database.CheckBlocksDB(getDataDirFromCmd(cmd), repair)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Checked %d records (%d bytes), %d valid\n", report.Records, report.Size, report.Valid)
+			for _, problem := range report.Problems {
+				fmt.Printf("\t- offset %d: %s\n", problem.Offset, problem.Reason)
+			}
+
+			if len(report.Problems) == 0 {
+				fmt.Println("blocks.db is healthy")
+				return
+			}
+
+			if report.Repaired {
+				fmt.Printf("blocks.db truncated to its first %d valid records\n", report.Valid)
+				return
+			}
+
+			fmt.Println("Run again with --repair to truncate blocks.db before the first bad record")
+			os.Exit(1)
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+	cmd.Flags().Bool(flagRepair, false, "Truncate blocks.db right before the first bad record")
+
+	return cmd
+}
+
+func dbReindexCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "reindex",
+		Short: "Rebuild the balances history, transactions and accounts indexes from blocks.db",
+		Run: func(cmd *cobra.Command, args []string) {
+			dir := getDataDirFromCmd(cmd)
+
+			if err := database.DropIndexes(dir); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			state, err := database.NewStateFromDisk(dir)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			defer state.Close()
+
+			fmt.Printf("Indexes rebuilt up to block %x\n", state.LatestBlockHash())
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+
+	return cmd
+}
+
+func dbPruneCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "prune",
+		Short: "Snapshot the state and drop the TXs of all but the latest blocks",
+		Run: func(cmd *cobra.Command, args []string) {
+			keep, _ := cmd.Flags().GetUint64(flagKeep)
+
+			state, err := database.NewStateFromDisk(getDataDirFromCmd(cmd))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			defer state.Close()
+
+			if _, err := state.Prune(keep); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("blocks.db keeps the TXs from block %d\n", state.PrunedBelow())
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+	cmd.Flags().Uint64(flagKeep, database.SnapshotInterval, "Number of latest blocks keeping their TXs")
+
+	return cmd
+}
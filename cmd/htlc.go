@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/1412335/the-blockchain-bar/database"
+	"github.com/1412335/the-blockchain-bar/node"
+	"github.com/spf13/cobra"
+)
+
+const flagHashLock = "hash-lock"
+const flagRefundAfter = "refund-after"
+const flagEscrow = "escrow"
+const flagPreimage = "preimage"
+
+func txHTLCCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "htlc",
+		Short: "Lock, claim and refund hash time-locked escrows, e.g. for atomic swaps",
+		Run: func(cmd *cobra.Command, args []string) {
+
+		},
+	}
+
+	cmd.AddCommand(txHTLCLockCmd())
+	cmd.AddCommand(txHTLCClaimCmd())
+	cmd.AddCommand(txHTLCRefundCmd())
+	cmd.AddCommand(txHTLCShowCmd())
+
+	return cmd
+}
+
+func txHTLCLockCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "lock",
+		Short: "Lock value for the recipient under a hash lock until a timeout",
+		Run: func(cmd *cobra.Command, args []string) {
+			from, _ := cmd.Flags().GetString(flagFrom)
+			to, _ := cmd.Flags().GetString(flagTo)
+			value, _ := cmd.Flags().GetString(flagValue)
+			fee, _ := cmd.Flags().GetUint64(flagFee)
+			hashLockRaw, _ := cmd.Flags().GetString(flagHashLock)
+			refundAfter, _ := cmd.Flags().GetUint64(flagRefundAfter)
+			asset, _ := cmd.Flags().GetString(flagAsset)
+
+			// the swap initiator picks the secret, the other party locks
+			// under the initiator's hash lock
+			var hashLock database.Hash
+			if hashLockRaw == "" {
+				preimage := make([]byte, 32)
+				if _, err := rand.Read(preimage); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+				hashLock = database.NewHashLock(preimage)
+				fmt.Printf("Secret preimage, keep it until claiming: %s\n", hex.EncodeToString(preimage))
+			} else if err := hashLock.UnmarshalText([]byte(hashLockRaw)); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			fmt.Printf("Hash lock: %x\n", hashLock)
+
+			hash := sendTx(cmd, node.TxAddReq{
+				From:   from,
+				To:     to,
+				Amount: value,
+				Asset:  asset,
+				Fee:    database.Amount(fee),
+				Type:   database.TxTypeHTLCLock,
+				HTLC:   &database.HTLC{HashLock: &hashLock, Timeout: refundAfter},
+			})
+			fmt.Printf("Escrow: %x\n", hash)
+		},
+	}
+
+	cmd.Flags().String(flagNode, fmt.Sprintf("%s:%d", DefaultIP, DefaultHTTPort), "Node HTTP address")
+
+	cmd.Flags().String(flagFrom, "", "Sender account, refunded after the timeout")
+	cmd.MarkFlagRequired(flagFrom)
+
+	cmd.Flags().String(flagTo, "", "Recipient account, claiming with the preimage")
+	cmd.MarkFlagRequired(flagTo)
+
+	cmd.Flags().String(flagValue, "", "Amount in currency units, e.g. '1.5'")
+	cmd.MarkFlagRequired(flagValue)
+	cmd.Flags().String(flagAsset, "", "Token symbol of the amount, the native currency when empty")
+
+	cmd.Flags().Uint64(flagFee, 0, "Fee paid to the miner, in the smallest unit")
+
+	cmd.Flags().String(flagHashLock, "", "SHA-256 hash of the secret preimage in hex, a new secret is generated when empty")
+	cmd.Flags().Uint64(flagRefundAfter, 0, fmt.Sprintf("Timeout from which the sender can refund, a block height, or a Unix time from %d on", database.LockTimeThreshold))
+	cmd.MarkFlagRequired(flagRefundAfter)
+
+	addWaitFlags(cmd)
+
+	return cmd
+}
+
+func txHTLCClaimCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "claim",
+		Short: "Claim an escrow with its hash preimage before the timeout",
+		Run: func(cmd *cobra.Command, args []string) {
+			from, _ := cmd.Flags().GetString(flagFrom)
+			fee, _ := cmd.Flags().GetUint64(flagFee)
+			preimage, _ := cmd.Flags().GetString(flagPreimage)
+
+			escrow := getEscrowFromCmd(cmd)
+			sendTx(cmd, node.TxAddReq{
+				From: from,
+				Fee:  database.Amount(fee),
+				Type: database.TxTypeHTLCClaim,
+				HTLC: &database.HTLC{Escrow: &escrow, Preimage: preimage},
+			})
+		},
+	}
+
+	addHTLCSettleFlags(cmd, "Recipient account of the escrow")
+
+	cmd.Flags().String(flagPreimage, "", "Secret preimage of the hash lock in hex")
+	cmd.MarkFlagRequired(flagPreimage)
+
+	return cmd
+}
+
+func txHTLCRefundCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "refund",
+		Short: "Refund an unclaimed escrow to its sender after the timeout",
+		Run: func(cmd *cobra.Command, args []string) {
+			from, _ := cmd.Flags().GetString(flagFrom)
+			fee, _ := cmd.Flags().GetUint64(flagFee)
+
+			escrow := getEscrowFromCmd(cmd)
+			sendTx(cmd, node.TxAddReq{
+				From: from,
+				Fee:  database.Amount(fee),
+				Type: database.TxTypeHTLCRefund,
+				HTLC: &database.HTLC{Escrow: &escrow},
+			})
+		},
+	}
+
+	addHTLCSettleFlags(cmd, "Sender account of the escrow")
+
+	return cmd
+}
+
+func txHTLCShowCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "show",
+		Short: "Print an escrow, with the preimage revealed by its claim",
+		Run: func(cmd *cobra.Command, args []string) {
+			address, _ := cmd.Flags().GetString(flagNode)
+
+			escrow, err := node.QueryEscrow(context.Background(), address, getEscrowFromCmd(cmd))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Escrow %x %s\n", escrow.ID, escrow.Status)
+			fmt.Printf("\tSender: %s\n", escrow.Sender.Hex())
+			fmt.Printf("\tRecipient: %s\n", escrow.Recipient.Hex())
+			if escrow.Asset != "" {
+				fmt.Printf("\tValue: %d %s\n", escrow.Value, escrow.Asset)
+			} else {
+				fmt.Printf("\tValue: %d\n", escrow.Value)
+			}
+			fmt.Printf("\tHash lock: %x\n", escrow.HashLock)
+			fmt.Printf("\tRefund after: %d\n", escrow.Timeout)
+			if escrow.Preimage != "" {
+				fmt.Printf("\tPreimage: %s\n", escrow.Preimage)
+			}
+		},
+	}
+
+	cmd.Flags().String(flagNode, fmt.Sprintf("%s:%d", DefaultIP, DefaultHTTPort), "Node HTTP address")
+
+	cmd.Flags().String(flagEscrow, "", "Escrow, the hash of its lock transaction")
+	cmd.MarkFlagRequired(flagEscrow)
+
+	return cmd
+}
+
+func addHTLCSettleFlags(cmd *cobra.Command, fromUsage string) {
+	cmd.Flags().String(flagNode, fmt.Sprintf("%s:%d", DefaultIP, DefaultHTTPort), "Node HTTP address")
+
+	cmd.Flags().String(flagFrom, "", fromUsage)
+	cmd.MarkFlagRequired(flagFrom)
+
+	cmd.Flags().String(flagEscrow, "", "Escrow, the hash of its lock transaction")
+	cmd.MarkFlagRequired(flagEscrow)
+
+	cmd.Flags().Uint64(flagFee, 0, "Fee paid to the miner out of the escrow, in the smallest unit")
+
+	addWaitFlags(cmd)
+}
+
+func getEscrowFromCmd(cmd *cobra.Command) database.Hash {
+	raw, _ := cmd.Flags().GetString(flagEscrow)
+
+	var escrow database.Hash
+	if err := escrow.UnmarshalText([]byte(raw)); err != nil {
+		fmt.Fprintln(os.Stderr, fmt.Errorf("invalid escrow '%s': %v", raw, err))
+		os.Exit(1)
+	}
+	return escrow
+}
@@ -21,6 +21,11 @@ func main() {
 	tbbCm.AddCommand(migrateCmd())
 	tbbCm.AddCommand(runCmd())
 	tbbCm.AddCommand(walletCmd())
+	tbbCm.AddCommand(snapshotCmd())
+	tbbCm.AddCommand(dbCmd())
+	tbbCm.AddCommand(accountCmd())
+	tbbCm.AddCommand(benchCmd())
+	tbbCm.AddCommand(chainCmd())
 
 	err := tbbCm.Execute()
 	if err != nil {
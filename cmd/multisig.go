@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/1412335/the-blockchain-bar/database"
+	"github.com/1412335/the-blockchain-bar/node"
+	"github.com/1412335/the-blockchain-bar/wallet"
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/spf13/cobra"
+)
+
+const flagThreshold = "threshold"
+const flagPubKeys = "pubkeys"
+const flagSigner = "signer"
+const flagTxFile = "file"
+
+func walletNewMultisigCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "new-multisig",
+		Short: "Create an M-of-N multisig account from the public keys of its signers",
+		Run: func(c *cobra.Command, args []string) {
+			threshold, _ := c.Flags().GetInt(flagThreshold)
+			pubkeysRaw, _ := c.Flags().GetString(flagPubKeys)
+
+			var pubkeys []database.PubKey
+			for _, pubkeyRaw := range strings.Split(pubkeysRaw, ",") {
+				pubkey, err := hexutil.Decode(strings.TrimSpace(pubkeyRaw))
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "invalid public key '%s': %v\n", pubkeyRaw, err)
+					os.Exit(1)
+				}
+				pubkeys = append(pubkeys, pubkey)
+			}
+
+			multisig, err := database.NewMultisig(threshold, pubkeys)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			acc, err := wallet.SaveMultisig(getDataDirFromCmd(c), multisig)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("New %d-of-%d multisig account created: %s\n", multisig.Threshold, len(multisig.PubKeys), acc.Hex())
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+
+	cmd.Flags().Int(flagThreshold, 0, "Signatures needed for a transaction")
+	cmd.MarkFlagRequired(flagThreshold)
+
+	cmd.Flags().String(flagPubKeys, "", "Comma separated signer public keys, as printed by 'tbb wallet pubkey'")
+	cmd.MarkFlagRequired(flagPubKeys)
+
+	return cmd
+}
+
+func txMultisigCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "multisig",
+		Short: "Build, co-sign and send transactions from multisig accounts",
+		Run: func(cmd *cobra.Command, args []string) {
+
+		},
+	}
+
+	cmd.AddCommand(txMultisigBuildCmd())
+	cmd.AddCommand(txMultisigSignCmd())
+	cmd.AddCommand(txMultisigSendCmd())
+
+	return cmd
+}
+
+func txMultisigBuildCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "build",
+		Short: "Write an unsigned transaction from a multisig account to a file, for its signers to co-sign",
+		Run: func(cmd *cobra.Command, args []string) {
+			dir := getDataDirFromCmd(cmd)
+			from, _ := cmd.Flags().GetString(flagFrom)
+			to, _ := cmd.Flags().GetString(flagTo)
+			valueRaw, _ := cmd.Flags().GetString(flagValue)
+			fee, _ := cmd.Flags().GetUint64(flagFee)
+			data, _ := cmd.Flags().GetString(flagData)
+			validAfter, _ := cmd.Flags().GetUint64(flagValidAfter)
+			validBefore, _ := cmd.Flags().GetUint64(flagValidBefore)
+			file, _ := cmd.Flags().GetString(flagTxFile)
+			asset, _ := cmd.Flags().GetString(flagAsset)
+
+			// token amounts have no decimals
+			denomination := database.Denomination{Symbol: asset}
+			if asset == "" {
+				var err error
+				if denomination, err = database.LoadDenomination(dir); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+			}
+
+			value, err := denomination.Parse(valueRaw)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			multisig, err := wallet.LoadMultisig(dir, database.NewAccount(from))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			tx := database.NewTX(from, to, value, data)
+			tx.Asset = asset
+			tx.Fee = database.Amount(fee)
+			tx.ValidAfter = validAfter
+			tx.ValidBefore = validBefore
+
+			signedTx, err := wallet.NewMultisigTx(tx, multisig)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			if err := writeTxFile(file, signedTx); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("TX written to %s, it needs %d of the signatures of:\n", file, multisig.Threshold)
+			for _, signer := range multisig.Signers() {
+				fmt.Printf("\t%s\n", signer.Hex())
+			}
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+
+	cmd.Flags().String(flagFrom, "", "From multisig account")
+	cmd.MarkFlagRequired(flagFrom)
+
+	cmd.Flags().String(flagTo, "", "To account")
+	cmd.MarkFlagRequired(flagTo)
+
+	cmd.Flags().String(flagValue, "", "Amount in currency units, e.g. '1.5'")
+	cmd.MarkFlagRequired(flagValue)
+	cmd.Flags().String(flagAsset, "", "Token symbol of the amount, the native currency when empty")
+
+	cmd.Flags().Uint64(flagFee, 0, "Fee paid to the miner, in the smallest unit")
+	cmd.Flags().String(flagData, "", "Possible values: 'reward'")
+	addValidityFlags(cmd)
+
+	cmd.Flags().String(flagTxFile, "", "File to write the transaction to")
+	cmd.MarkFlagRequired(flagTxFile)
+
+	return cmd
+}
+
+func txMultisigSignCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "sign",
+		Short: "Add the signature of a multisig signer to the transaction file",
+		Run: func(cmd *cobra.Command, args []string) {
+			dir := getDataDirFromCmd(cmd)
+			signer, _ := cmd.Flags().GetString(flagSigner)
+			file, _ := cmd.Flags().GetString(flagTxFile)
+
+			signedTx, err := readTxFile(file)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			password := utils.GetPassPhrase(fmt.Sprintf("Enter password of account %s:", signer), false)
+
+			signedTx, err = wallet.CoSignTxWithKeystoreAccount(signedTx, database.NewAccount(signer), password, wallet.GetKeystoreDirPath(dir))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			if err := writeTxFile(file, signedTx); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("TX signed by %s, %d of %d signatures\n", database.NewAccount(signer).Hex(), len(signedTx.Signs), signedTx.Multisig.Threshold)
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+
+	cmd.Flags().String(flagSigner, "", "Signer account, its key must be in the keystore")
+	cmd.MarkFlagRequired(flagSigner)
+
+	cmd.Flags().String(flagTxFile, "", "Transaction file written by 'tbb tx multisig build'")
+	cmd.MarkFlagRequired(flagTxFile)
+
+	return cmd
+}
+
+func txMultisigSendCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "send",
+		Short: "Send a co-signed multisig transaction through a running node",
+		Run: func(cmd *cobra.Command, args []string) {
+			address, _ := cmd.Flags().GetString(flagNode)
+			file, _ := cmd.Flags().GetString(flagTxFile)
+			wait, _ := cmd.Flags().GetUint64(flagWait)
+			timeout, _ := cmd.Flags().GetDuration(flagTimeout)
+
+			signedTx, err := readTxFile(file)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			ctx := context.Background()
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+
+			txAddRes, err := node.SubmitTx(ctx, address, signedTx)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			fmt.Printf("TX %x submitted\n", txAddRes.Hash)
+
+			waitForReceipt(ctx, address, txAddRes.Hash, wait)
+		},
+	}
+
+	cmd.Flags().String(flagNode, fmt.Sprintf("%s:%d", DefaultIP, DefaultHTTPort), "Node HTTP address")
+
+	cmd.Flags().String(flagTxFile, "", "Transaction file co-signed with 'tbb tx multisig sign'")
+	cmd.MarkFlagRequired(flagTxFile)
+
+	addWaitFlags(cmd)
+
+	return cmd
+}
+
+func readTxFile(file string) (database.SignedTx, error) {
+	txJSON, err := ioutil.ReadFile(file)
+	if err != nil {
+		return database.SignedTx{}, err
+	}
+
+	var signedTx database.SignedTx
+	if err := json.Unmarshal(txJSON, &signedTx); err != nil {
+		return database.SignedTx{}, fmt.Errorf("%s isn't a transaction file: %v", file, err)
+	}
+	return signedTx, nil
+}
+
+func writeTxFile(file string, signedTx database.SignedTx) error {
+	txJSON, err := json.MarshalIndent(signedTx, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, txJSON, 0600)
+}
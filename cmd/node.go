@@ -7,12 +7,19 @@ import (
 
 	"github.com/1412335/the-blockchain-bar/database"
 	"github.com/1412335/the-blockchain-bar/node"
+	"github.com/ethereum/go-ethereum/cmd/utils"
 	"github.com/spf13/cobra"
 )
 
 const flagIP = "ip"
 const flagPort = "port"
 const flagMiner = "miner"
+const flagMiningWorkers = "mining-workers"
+const flagMine = "mine"
+const flagEmptyBlockInterval = "empty-block-interval-secs"
+const flagFastSync = "fast-sync"
+const flagPruneKeep = "prune-keep"
+const flagLight = "light"
 
 const DefaultIP = "127.0.0.1"
 const DefaultHTTPort = 8080
@@ -46,9 +53,65 @@ func runCmd() *cobra.Command {
 				os.Exit(1)
 			}
 
+			miningWorkers, err := cmd.Flags().GetInt(flagMiningWorkers)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			mine, err := cmd.Flags().GetBool(flagMine)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			emptyBlockInterval, err := cmd.Flags().GetUint64(flagEmptyBlockInterval)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fastSync, err := cmd.Flags().GetBool(flagFastSync)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			pruneKeep, err := cmd.Flags().GetUint64(flagPruneKeep)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			light, err := cmd.Flags().GetBool(flagLight)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
 			bootstrap := node.NewPeerNode("127.0.0.1", 8080, true, false)
 
 			n := node.New(dir, ip, port, database.NewAccount(miner), bootstrap)
+			n.SetMiningConfig(node.MiningConfig{
+				Enabled:                mine,
+				Workers:                miningWorkers,
+				EmptyBlockIntervalSecs: emptyBlockInterval,
+			})
+			n.SetFastSync(fastSync)
+			n.SetPruning(pruneKeep)
+			n.SetLight(light)
+
+			consensus, err := database.LoadConsensusConfig(dir)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			// PoA blocks are signed with the miner keystore key
+			if consensus.Engine == database.EnginePoA && miner != "" && !light {
+				n.SetMinerPassword(utils.GetPassPhrase(fmt.Sprintf("Enter password of signer %s:", miner), false))
+			}
+
 			if err := n.Run(context.Background()); err != nil {
 				fmt.Fprintln(os.Stderr, err)
 				os.Exit(1)
@@ -61,7 +124,13 @@ func runCmd() *cobra.Command {
 	runCmd.Flags().String(flagIP, DefaultIP, "")
 	runCmd.Flags().Uint64(flagPort, DefaultHTTPort, "")
 
-	runCmd.Flags().String(flagMiner, "", "")
+	runCmd.Flags().String(flagMiner, "", "Miner account, the signer account with the poa engine")
+	runCmd.Flags().Int(flagMiningWorkers, 0, "Number of PoW mining goroutines, 0 for one per CPU")
+	runCmd.Flags().Bool(flagMine, true, "Mine pending TXs, can be changed at runtime via /mining/start and /mining/stop")
+	runCmd.Flags().Uint64(flagEmptyBlockInterval, 0, "Mine an empty block once the latest block is that many seconds old, 0 to disable")
+	runCmd.Flags().Bool(flagFastSync, false, "Don't check TX signatures of synced blocks below a checkpoint")
+	runCmd.Flags().Uint64(flagPruneKeep, 0, "Keep the TXs of this many latest blocks only, 0 keeps every block")
+	runCmd.Flags().Bool(flagLight, false, "Sync block headers only and serve the read-only API with balances and TXs proven by full peers")
 
 	return runCmd
 }
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/1412335/the-blockchain-bar/database"
+	"github.com/spf13/cobra"
+)
+
+const (
+	flagSnapshotFile = "file"
+	flagTrustedHash  = "trusted-hash"
+)
+
+func snapshotCmd() *cobra.Command {
+	var snapshotCmd = &cobra.Command{
+		Use:   "snapshot",
+		Short: "Manage state snapshots",
+		Run: func(cmd *cobra.Command, args []string) {
+
+		},
+	}
+
+	snapshotCmd.AddCommand(snapshotCreateCmd())
+	snapshotCmd.AddCommand(snapshotVerifyCmd())
+	snapshotCmd.AddCommand(snapshotImportCmd())
+
+	return snapshotCmd
+}
+
+func snapshotCreateCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "create",
+		Short: "Snapshot the state at the latest block",
+		Run: func(cmd *cobra.Command, args []string) {
+			state, err := database.NewStateFromDisk(getDataDirFromCmd(cmd))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			defer state.Close()
+
+			snapshot, err := state.CreateSnapshot()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			file, _ := cmd.Flags().GetString(flagSnapshotFile)
+			if file != "" {
+				if err := database.WriteSnapshot(file, snapshot); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+			}
+
+			fmt.Printf("Snapshot created at height %d: %x\n", snapshot.Number(), snapshot.Block.BlockHash)
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+	cmd.Flags().String(flagSnapshotFile, "", "Also export the snapshot into this file")
+
+	return cmd
+}
+
+func snapshotVerifyCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "verify",
+		Short: "Replay blocks.db from genesis and compare it with a snapshot",
+		Run: func(cmd *cobra.Command, args []string) {
+			file, _ := cmd.Flags().GetString(flagSnapshotFile)
+
+			snapshot, err := database.LoadSnapshot(file)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			if err := database.VerifySnapshot(getDataDirFromCmd(cmd), snapshot); err != nil {
+				fmt.Fprintf(os.Stderr, "Snapshot at height %d is invalid: %v\n", snapshot.Number(), err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Snapshot at height %d is valid: %x\n", snapshot.Number(), snapshot.Block.BlockHash)
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+	cmd.Flags().String(flagSnapshotFile, "", "Snapshot file to verify")
+	cmd.MarkFlagRequired(flagSnapshotFile)
+
+	return cmd
+}
+
+func snapshotImportCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "import",
+		Short: "Bootstrap a data dir from a snapshot file",
+		Run: func(cmd *cobra.Command, args []string) {
+			file, _ := cmd.Flags().GetString(flagSnapshotFile)
+			trustedHashRaw, _ := cmd.Flags().GetString(flagTrustedHash)
+
+			var trustedHash database.Hash
+			if trustedHashRaw != "" {
+				if err := trustedHash.UnmarshalText([]byte(trustedHashRaw)); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+			}
+
+			snapshot, err := database.ImportSnapshot(getDataDirFromCmd(cmd), file, trustedHash)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Snapshot imported at height %d: %x\n", snapshot.Number(), snapshot.Block.BlockHash)
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+	cmd.Flags().String(flagSnapshotFile, "", "Snapshot file to import")
+	cmd.MarkFlagRequired(flagSnapshotFile)
+	cmd.Flags().String(flagTrustedHash, "", "Hash of the snapshot block, obtained from a trusted source, when it isn't a checkpoint")
+
+	return cmd
+}
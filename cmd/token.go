@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/1412335/the-blockchain-bar/database"
+	"github.com/1412335/the-blockchain-bar/node"
+	"github.com/spf13/cobra"
+)
+
+const flagAsset = "asset"
+const flagSymbol = "symbol"
+const flagSupply = "supply"
+
+func txTokenCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "token",
+		Short: "Issue tokens and control their supply as their issuer",
+		Run: func(cmd *cobra.Command, args []string) {
+
+		},
+	}
+
+	cmd.AddCommand(txTokenIssueCmd())
+	cmd.AddCommand(txTokenMintCmd())
+	cmd.AddCommand(txTokenBurnCmd())
+
+	return cmd
+}
+
+func txTokenIssueCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "issue",
+		Short: "Issue a new token, crediting its initial supply to the recipient",
+		Run: func(cmd *cobra.Command, args []string) {
+			from, _ := cmd.Flags().GetString(flagFrom)
+			to, _ := cmd.Flags().GetString(flagTo)
+			symbol, _ := cmd.Flags().GetString(flagSymbol)
+			supply, _ := cmd.Flags().GetUint64(flagSupply)
+			fee, _ := cmd.Flags().GetUint64(flagFee)
+
+			if to == "" {
+				to = from
+			}
+
+			sendTx(cmd, node.TxAddReq{
+				From:  from,
+				To:    to,
+				Value: database.Amount(supply),
+				Asset: symbol,
+				Fee:   database.Amount(fee),
+				Type:  database.TxTypeTokenIssue,
+			})
+		},
+	}
+
+	addTokenFlags(cmd, "Issuer account, controlling the token supply")
+
+	cmd.Flags().String(flagSymbol, "", "Token symbol, 1 to 12 upper case letters and digits")
+	cmd.MarkFlagRequired(flagSymbol)
+
+	cmd.Flags().Uint64(flagSupply, 0, "Initial supply")
+	cmd.Flags().String(flagTo, "", "Account credited the initial supply, the issuer when empty")
+
+	return cmd
+}
+
+func txTokenMintCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "mint",
+		Short: "Mint tokens to an account, as the token issuer",
+		Run: func(cmd *cobra.Command, args []string) {
+			from, _ := cmd.Flags().GetString(flagFrom)
+			to, _ := cmd.Flags().GetString(flagTo)
+			asset, _ := cmd.Flags().GetString(flagAsset)
+			value, _ := cmd.Flags().GetString(flagValue)
+			fee, _ := cmd.Flags().GetUint64(flagFee)
+
+			if to == "" {
+				to = from
+			}
+
+			sendTx(cmd, node.TxAddReq{
+				From:   from,
+				To:     to,
+				Amount: value,
+				Asset:  asset,
+				Fee:    database.Amount(fee),
+				Type:   database.TxTypeTokenMint,
+			})
+		},
+	}
+
+	addTokenFlags(cmd, "Issuer account")
+
+	cmd.Flags().String(flagAsset, "", "Token symbol")
+	cmd.MarkFlagRequired(flagAsset)
+
+	cmd.Flags().String(flagValue, "", "Amount of tokens to mint")
+	cmd.MarkFlagRequired(flagValue)
+
+	cmd.Flags().String(flagTo, "", "Account credited the tokens, the issuer when empty")
+
+	return cmd
+}
+
+func txTokenBurnCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "burn",
+		Short: "Burn tokens out of the issuer balance, as the token issuer",
+		Run: func(cmd *cobra.Command, args []string) {
+			from, _ := cmd.Flags().GetString(flagFrom)
+			asset, _ := cmd.Flags().GetString(flagAsset)
+			value, _ := cmd.Flags().GetString(flagValue)
+			fee, _ := cmd.Flags().GetUint64(flagFee)
+
+			sendTx(cmd, node.TxAddReq{
+				From:   from,
+				Amount: value,
+				Asset:  asset,
+				Fee:    database.Amount(fee),
+				Type:   database.TxTypeTokenBurn,
+			})
+		},
+	}
+
+	addTokenFlags(cmd, "Issuer account")
+
+	cmd.Flags().String(flagAsset, "", "Token symbol")
+	cmd.MarkFlagRequired(flagAsset)
+
+	cmd.Flags().String(flagValue, "", "Amount of tokens to burn")
+	cmd.MarkFlagRequired(flagValue)
+
+	return cmd
+}
+
+func addTokenFlags(cmd *cobra.Command, fromUsage string) {
+	cmd.Flags().String(flagNode, fmt.Sprintf("%s:%d", DefaultIP, DefaultHTTPort), "Node HTTP address")
+
+	cmd.Flags().String(flagFrom, "", fromUsage)
+	cmd.MarkFlagRequired(flagFrom)
+
+	cmd.Flags().Uint64(flagFee, 0, "Fee paid to the miner, in the smallest unit")
+
+	addWaitFlags(cmd)
+}
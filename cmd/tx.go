@@ -1,13 +1,29 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/1412335/the-blockchain-bar/database"
+	"github.com/1412335/the-blockchain-bar/node"
+	"github.com/ethereum/go-ethereum/cmd/utils"
 	"github.com/spf13/cobra"
 )
 
 const flagFrom = "from"
 const flagTo = "to"
 const flagValue = "value"
+const flagFee = "fee"
 const flagData = "data"
+const flagNode = "node"
+const flagWait = "wait"
+const flagTimeout = "timeout"
+const flagValidAfter = "valid-after"
+const flagValidBefore = "valid-before"
+
+const receiptPollInterval = 2 * time.Second
 
 func txCmd() *cobra.Command {
 	var txCmd = &cobra.Command{
@@ -19,6 +35,11 @@ func txCmd() *cobra.Command {
 	}
 
 	txCmd.AddCommand(txAddCmd())
+	txCmd.AddCommand(txSendCmd())
+	txCmd.AddCommand(txMultisigCmd())
+	txCmd.AddCommand(txHTLCCmd())
+	txCmd.AddCommand(txTokenCmd())
+	txCmd.AddCommand(txContractCmd())
 
 	return txCmd
 }
@@ -83,3 +104,123 @@ func txAddCmd() *cobra.Command {
 
 	return txAddCmd
 }
+
+func txSendCmd() *cobra.Command {
+	var txSendCmd = &cobra.Command{
+		Use:   "send",
+		Short: "Send a transaction through a running node, optionally waiting for its receipt",
+		Run: func(cmd *cobra.Command, args []string) {
+			from, _ := cmd.Flags().GetString(flagFrom)
+			to, _ := cmd.Flags().GetString(flagTo)
+			value, _ := cmd.Flags().GetString(flagValue)
+			fee, _ := cmd.Flags().GetUint64(flagFee)
+			data, _ := cmd.Flags().GetString(flagData)
+			validAfter, _ := cmd.Flags().GetUint64(flagValidAfter)
+			validBefore, _ := cmd.Flags().GetUint64(flagValidBefore)
+			asset, _ := cmd.Flags().GetString(flagAsset)
+
+			sendTx(cmd, node.TxAddReq{
+				From:        from,
+				To:          to,
+				Amount:      value,
+				Asset:       asset,
+				Fee:         database.Amount(fee),
+				Data:        data,
+				ValidAfter:  validAfter,
+				ValidBefore: validBefore,
+			})
+		},
+	}
+
+	txSendCmd.Flags().String(flagNode, fmt.Sprintf("%s:%d", DefaultIP, DefaultHTTPort), "Node HTTP address")
+
+	txSendCmd.Flags().String(flagFrom, "", "From account")
+	txSendCmd.MarkFlagRequired(flagFrom)
+
+	txSendCmd.Flags().String(flagTo, "", "To account")
+	txSendCmd.MarkFlagRequired(flagTo)
+
+	txSendCmd.Flags().String(flagValue, "", "Amount in currency units, e.g. '1.5'")
+	txSendCmd.MarkFlagRequired(flagValue)
+	txSendCmd.Flags().String(flagAsset, "", "Token symbol of the amount, the native currency when empty")
+
+	txSendCmd.Flags().Uint64(flagFee, 0, "Fee paid to the miner, in the smallest unit")
+	txSendCmd.Flags().String(flagData, "", "Possible values: 'reward'")
+	addValidityFlags(txSendCmd)
+
+	addWaitFlags(txSendCmd)
+
+	return txSendCmd
+}
+
+func addWaitFlags(cmd *cobra.Command) {
+	cmd.Flags().Uint64(flagWait, 0, "Wait until the transaction has this many confirmations")
+	cmd.Flags().Duration(flagTimeout, 0, "Give up waiting after this long, e.g. '5m' (0 waits forever)")
+}
+
+// sendTx has the node sign the TX with the From account, prompting for its
+// password, and waits for the receipt as the --wait and --timeout flags say.
+// It returns the TX hash.
+func sendTx(cmd *cobra.Command, txAddReq node.TxAddReq) database.Hash {
+	address, _ := cmd.Flags().GetString(flagNode)
+	wait, _ := cmd.Flags().GetUint64(flagWait)
+	timeout, _ := cmd.Flags().GetDuration(flagTimeout)
+
+	txAddReq.FromPwd = utils.GetPassPhrase(fmt.Sprintf("Enter password of account %s:", txAddReq.From), false)
+
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	txAddRes, err := node.SendTx(ctx, address, txAddReq)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("TX %x submitted\n", txAddRes.Hash)
+
+	waitForReceipt(ctx, address, txAddRes.Hash, wait)
+	return txAddRes.Hash
+}
+
+func addValidityFlags(cmd *cobra.Command) {
+	lock := fmt.Sprintf("a block height, or a Unix time from %d on", database.LockTimeThreshold)
+	cmd.Flags().Uint64(flagValidAfter, 0, "Don't include the transaction in blocks before this, "+lock)
+	cmd.Flags().Uint64(flagValidBefore, 0, "Drop the transaction once blocks reach this, "+lock)
+}
+
+// waitForReceipt prints the receipt of the TX once it has the given number of
+// confirmations, it returns right away when no confirmation is awaited.
+func waitForReceipt(ctx context.Context, address string, hash database.Hash, wait uint64) {
+	if wait == 0 {
+		return
+	}
+
+	txRes, err := node.WaitForReceipt(ctx, address, hash, wait, receiptPollInterval)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	receipt := txRes.Receipt
+	fmt.Printf("TX %x %s\n", receipt.TxHash, receipt.Status)
+	fmt.Printf("\tBlock: %d %x\n", receipt.BlockNumber, receipt.BlockHash)
+	fmt.Printf("\tIndex: %d\n", receipt.Index)
+	fmt.Printf("\tFee: %d\n", receipt.Fee)
+	fmt.Printf("\tConfirmations: %d\n", txRes.Confirmations)
+	for account, balance := range receipt.Balances {
+		fmt.Printf("\tBalance %s: %d\n", account.Hex(), balance)
+	}
+	if receipt.Contract != nil {
+		fmt.Printf("\tContract: %s\n", receipt.Contract.Hex())
+		fmt.Printf("\tGas used: %d\n", receipt.GasUsed)
+		if receipt.Error != "" {
+			fmt.Printf("\tError: %s\n", receipt.Error)
+		} else if len(receipt.Return) > 0 {
+			fmt.Printf("\tReturn: %v\n", receipt.Return)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"os"
 
+	"github.com/1412335/the-blockchain-bar/database"
 	"github.com/1412335/the-blockchain-bar/wallet"
 	"github.com/davecgh/go-spew/spew"
 	"github.com/ethereum/go-ethereum/accounts/keystore"
@@ -25,6 +26,8 @@ func walletCmd() *cobra.Command {
 
 	walletCmd.AddCommand(walletNewAccountCmd())
 	walletCmd.AddCommand(walletPrintPrivateKeyCmd())
+	walletCmd.AddCommand(walletPubKeyCmd())
+	walletCmd.AddCommand(walletNewMultisigCmd())
 
 	return walletCmd
 }
@@ -53,6 +56,32 @@ func walletNewAccountCmd() *cobra.Command {
 	return cmd
 }
 
+func walletPubKeyCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "pubkey",
+		Short: "Print the public key of an account, to share it with the other signers of a multisig account",
+		Run: func(c *cobra.Command, args []string) {
+			account, _ := c.Flags().GetString(flagAccount)
+			password := utils.GetPassPhrase(fmt.Sprintf("Enter password of account %s:", account), false)
+
+			key, err := wallet.LoadKeystoreKey(database.NewAccount(account), password, wallet.GetKeystoreDirPath(getDataDirFromCmd(c)))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Public key of %s: %s\n", database.NewAccount(account).Hex(), database.NewPubKey(key.PublicKey))
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+
+	cmd.Flags().String(flagAccount, "", "Account, its key must be in the keystore")
+	cmd.MarkFlagRequired(flagAccount)
+
+	return cmd
+}
+
 func walletPrintPrivateKeyCmd() *cobra.Command {
 	var cmd = &cobra.Command{
 		Use:   "pk-dump",
@@ -0,0 +1,232 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const DefaultAccountTxsLimit = 20
+const MaxAccountTxsLimit = 100
+
+// AccountTx is a mined transaction sent or received by an account.
+type AccountTx struct {
+	Hash Hash `json:"hash"`
+	TxLocation
+	Tx SignedTx `json:"tx"`
+}
+
+type addrIndexEntry struct {
+	Account Account `json:"account"`
+	TxHash  Hash    `json:"tx"`
+	Index   int     `json:"index"`
+}
+
+// addrIndexRecord lists who sent and received the transactions of one block.
+type addrIndexRecord struct {
+	BlockHash   Hash             `json:"block_hash"`
+	BlockNumber uint64           `json:"block_number"`
+	Entries     []addrIndexEntry `json:"entries"`
+}
+
+type accountTxRef struct {
+	hash     Hash
+	location TxLocation
+}
+
+// addrIndex maps accounts to the transactions they sent or received, oldest
+// first.
+type addrIndex struct {
+	mu sync.RWMutex
+
+	f    *os.File
+	txs  map[Account][]accountTxRef
+	last Hash
+}
+
+func openAddrIndex(dataDir string) (*addrIndex, error) {
+	f, err := openIndexFile(getIndexFilePath(dataDir, "accounts"))
+	if err != nil {
+		return nil, err
+	}
+
+	idx := &addrIndex{f: f, txs: make(map[Account][]accountTxRef)}
+
+	err = readIndexFile(f, func(line []byte) error {
+		var record addrIndexRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return err
+		}
+		idx.add(record)
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("Rebuilding accounts index: %v\n", err)
+		return idx, idx.reset()
+	}
+
+	return idx, nil
+}
+
+func (idx *addrIndex) name() string {
+	return "accounts"
+}
+
+func (idx *addrIndex) lastIndexed() Hash {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return idx.last
+}
+
+func (idx *addrIndex) indexSnapshot(snapshot Snapshot) error {
+	return idx.append(addrIndexRecord{snapshot.Block.BlockHash, snapshot.Number(), []addrIndexEntry{}})
+}
+
+func (idx *addrIndex) indexBlock(block indexedBlock) error {
+	record := addrIndexRecord{block.BlockHash, block.Block.Header.Number, []addrIndexEntry{}}
+
+	for i, tx := range block.Block.TXs {
+		txHash, err := tx.Hash()
+		if err != nil {
+			return err
+		}
+
+		record.Entries = append(record.Entries, addrIndexEntry{tx.From, txHash, i})
+		if tx.To != tx.From {
+			record.Entries = append(record.Entries, addrIndexEntry{tx.To, txHash, i})
+		}
+	}
+
+	return idx.append(record)
+}
+
+func (idx *addrIndex) reset() error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.txs = make(map[Account][]accountTxRef)
+	idx.last = Hash{}
+	return truncateIndexFile(idx.f)
+}
+
+func (idx *addrIndex) close() error {
+	return idx.f.Close()
+}
+
+func (idx *addrIndex) append(record addrIndexRecord) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.add(record)
+	return appendIndexRecord(idx.f, record)
+}
+
+func (idx *addrIndex) add(record addrIndexRecord) {
+	for _, entry := range record.Entries {
+		idx.txs[entry.Account] = append(idx.txs[entry.Account], accountTxRef{
+			entry.TxHash,
+			TxLocation{record.BlockHash, record.BlockNumber, entry.Index},
+		})
+	}
+	idx.last = record.BlockHash
+}
+
+// page returns up to limit transactions of the account older than the
+// cursor, newest first, and the cursor of the next page.
+func (idx *addrIndex) page(account Account, cursor string, limit int) ([]accountTxRef, string, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	refs := idx.txs[account]
+
+	end := len(refs)
+	if cursor != "" {
+		number, index, err := parseAccountTxsCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+
+		end = sort.Search(len(refs), func(i int) bool {
+			location := refs[i].location
+			return location.BlockNumber > number || (location.BlockNumber == number && location.Index >= index)
+		})
+	}
+
+	page := []accountTxRef{}
+	for i := end - 1; i >= 0 && len(page) < limit; i-- {
+		page = append(page, refs[i])
+	}
+
+	next := ""
+	if len(page) > 0 && end-len(page) > 0 {
+		oldest := page[len(page)-1].location
+		next = fmt.Sprintf("%d-%d", oldest.BlockNumber, oldest.Index)
+	}
+
+	return page, next, nil
+}
+
+func parseAccountTxsCursor(cursor string) (uint64, int, error) {
+	parts := strings.Split(cursor, "-")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid cursor '%s'", cursor)
+	}
+
+	number, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid cursor '%s': %v", cursor, err)
+	}
+
+	index, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid cursor '%s': %v", cursor, err)
+	}
+
+	return number, index, nil
+}
+
+// AccountTxs returns a page of the transactions sent or received by the
+// account, newest first. An empty cursor starts from the latest transaction,
+// the returned cursor fetches the next page and is empty after the last one.
+func (s *State) AccountTxs(account Account, cursor string, limit int) ([]AccountTx, string, error) {
+	if limit <= 0 {
+		limit = DefaultAccountTxsLimit
+	}
+	if limit > MaxAccountTxsLimit {
+		limit = MaxAccountTxsLimit
+	}
+
+	refs, next, err := s.indexes.accounts.page(account, cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+
+	txs := make([]AccountTx, 0, len(refs))
+	blocks := make(map[Hash]BlockFS)
+
+	for _, ref := range refs {
+		blockFS, ok := blocks[ref.location.BlockHash]
+		if !ok {
+			blockFS, err = s.GetBlockByHash(ref.location.BlockHash)
+			if err != nil {
+				return nil, "", err
+			}
+			blocks[ref.location.BlockHash] = blockFS
+		}
+
+		if blockFS.Pruned {
+			return nil, "", errPruned(ref.location.BlockNumber, s.PrunedBelow())
+		}
+		if ref.location.Index >= len(blockFS.Block.TXs) {
+			return nil, "", fmt.Errorf("transaction %x is missing from block %x", ref.hash, ref.location.BlockHash)
+		}
+		txs = append(txs, AccountTx{ref.hash, ref.location, blockFS.Block.TXs[ref.location.Index]})
+	}
+
+	return txs, next, nil
+}
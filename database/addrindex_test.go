@@ -0,0 +1,122 @@
+package database
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// allAccountTxs walks every page of the account history.
+func allAccountTxs(t *testing.T, state *State, account Account, limit int) [][]AccountTx {
+	var pages [][]AccountTx
+	cursor := ""
+	for {
+		txs, next, err := state.AccountTxs(account, cursor, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, txs)
+		if next == "" {
+			return pages
+		}
+		cursor = next
+	}
+}
+
+func TestAccountTxs(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := Account(crypto.PubkeyToAddress(key.PublicKey))
+	bob, carol, miner := NewAccount("0x02"), NewAccount("0x04"), NewAccount("0x03")
+
+	state := newTestChainState(t, genesis{
+		Consensus: &ConsensusConfig{Engine: EngineInstant},
+		Balances:  map[Account]Amount{alice: 1000},
+	})
+
+	parent, err := state.AddBlock(NewBlock(Hash{}, 0, 0, 0, miner, []SignedTx{
+		signTestTx(t, TX{From: alice, To: bob, Value: 1, Time: 0}, key),
+		signTestTx(t, TX{From: alice, To: bob, Value: 2, Time: 1}, key),
+		signTestTx(t, TX{From: alice, To: bob, Value: 3, Time: 2}, key),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a TX to itself is listed once
+	if _, err := state.AddBlock(NewBlock(parent, 1, 1, 0, miner, []SignedTx{
+		signTestTx(t, TX{From: alice, To: bob, Value: 4, Time: 3}, key),
+		signTestTx(t, TX{From: alice, To: alice, Value: 5, Time: 4}, key),
+		signTestTx(t, TX{From: alice, To: bob, Value: 6, Time: 5}, key),
+	})); err != nil {
+		t.Fatal(err)
+	}
+
+	txs, next, err := state.AccountTxs(alice, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txs) != 6 || next != "" {
+		t.Fatalf("expected the 6 TXs of alice on a single default page, got %d and cursor '%s'", len(txs), next)
+	}
+	for i, tx := range txs {
+		if tx.Tx.Value != Amount(6-i) {
+			t.Fatalf("expected TX %d to be the one of value %d, newest first, got %d", i, 6-i, tx.Tx.Value)
+		}
+	}
+
+	pages := allAccountTxs(t, state, alice, 4)
+	if len(pages) != 2 || len(pages[0]) != 4 || len(pages[1]) != 2 {
+		t.Fatalf("expected a full page of 4 TXs and a last partial one of 2, got %d pages", len(pages))
+	}
+	if pages[1][0].Tx.Value != 2 || pages[1][1].Tx.Value != 1 {
+		t.Fatalf("expected the last page to continue after the cursor, got %+v", pages[1])
+	}
+
+	pages = allAccountTxs(t, state, bob, 5)
+	if len(pages) != 1 || len(pages[0]) != 5 {
+		t.Fatalf("expected the 5 TXs of bob on an exactly full page, got %d pages", len(pages))
+	}
+
+	if txs, next, err := state.AccountTxs(carol, "", 10); err != nil || len(txs) != 0 || next != "" {
+		t.Fatalf("expected no TX for an account without history, got %d and cursor '%s': %v", len(txs), next, err)
+	}
+
+	// a cursor past the oldest TX gives an empty last page, one past the
+	// newest starts from the latest TX
+	if txs, next, err := state.AccountTxs(alice, "0-0", 10); err != nil || len(txs) != 0 || next != "" {
+		t.Fatalf("expected an empty page before the oldest TX, got %d and cursor '%s': %v", len(txs), next, err)
+	}
+	if txs, _, err := state.AccountTxs(alice, "9-0", 10); err != nil || len(txs) != 6 {
+		t.Fatalf("expected every TX before a cursor past the tip, got %d: %v", len(txs), err)
+	}
+	if _, _, err := state.AccountTxs(alice, "1", 10); err == nil {
+		t.Fatal("expected an invalid cursor to be rejected")
+	}
+
+	expected := allAccountTxs(t, state, alice, 4)
+	if _, err := state.CreateSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the pages are the same read back from disk and rebuilt from blocks.db
+	for _, removeIndex := range []bool{false, true} {
+		state.Close()
+		if removeIndex {
+			if err := os.Remove(getIndexFilePath(state.dataDir, "accounts")); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if state, err = NewStateFromDisk(state.dataDir); err != nil {
+			t.Fatal(err)
+		}
+		if pages := allAccountTxs(t, state, alice, 4); !reflect.DeepEqual(pages, expected) {
+			t.Fatalf("expected the same pages after reopening (index removed: %v), got %+v", removeIndex, pages)
+		}
+	}
+	state.Close()
+}
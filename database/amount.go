@@ -0,0 +1,80 @@
+package database
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Amount is a quantity of the native currency expressed in its smallest unit.
+type Amount uint64
+
+// Add returns a + b or an error if the sum overflows.
+func (a Amount) Add(b Amount) (Amount, error) {
+	if b > math.MaxUint64-a {
+		return 0, fmt.Errorf("amount overflow: %d + %d", a, b)
+	}
+	return a + b, nil
+}
+
+// Sub returns a - b or an error if b is greater than a.
+func (a Amount) Sub(b Amount) (Amount, error) {
+	if b > a {
+		return 0, fmt.Errorf("amount underflow: %d - %d", a, b)
+	}
+	return a - b, nil
+}
+
+// Denomination describes how an Amount is displayed: the smallest unit stored
+// on chain and the number of decimals of the currency symbol shown to users.
+type Denomination struct {
+	Symbol   string `json:"symbol"`
+	Unit     string `json:"unit"`
+	Decimals uint8  `json:"decimals"`
+}
+
+var DefaultDenomination = Denomination{Symbol: "TBB", Unit: "bar", Decimals: 2}
+
+// Format renders the amount in currency units, e.g. 12345 -> "123.45 TBB".
+func (d Denomination) Format(a Amount) string {
+	raw := strconv.FormatUint(uint64(a), 10)
+	if d.Decimals == 0 {
+		return fmt.Sprintf("%s %s", raw, d.Symbol)
+	}
+
+	decimals := int(d.Decimals)
+	if len(raw) <= decimals {
+		raw = strings.Repeat("0", decimals-len(raw)+1) + raw
+	}
+
+	return fmt.Sprintf("%s.%s %s", raw[:len(raw)-decimals], raw[len(raw)-decimals:], d.Symbol)
+}
+
+// Parse converts a decimal string in currency units, e.g. "1.5", into an Amount.
+func (d Denomination) Parse(s string) (Amount, error) {
+	s = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), d.Symbol))
+	if s == "" {
+		return 0, fmt.Errorf("empty amount")
+	}
+
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+	}
+
+	if len(frac) > int(d.Decimals) {
+		return 0, fmt.Errorf("amount '%s' has more than %d decimals", s, d.Decimals)
+	}
+	frac += strings.Repeat("0", int(d.Decimals)-len(frac))
+
+	if whole == "" {
+		whole = "0"
+	}
+
+	v, err := strconv.ParseUint(whole+frac, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount '%s': %v", s, err)
+	}
+	return Amount(v), nil
+}
@@ -0,0 +1,54 @@
+package database
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAmount_AddOverflow(t *testing.T) {
+	if _, err := Amount(math.MaxUint64).Add(1); err == nil {
+		t.Fatal("expected overflow error")
+	}
+
+	sum, err := Amount(40).Add(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum != 42 {
+		t.Fatalf("expected 42, got %d", sum)
+	}
+}
+
+func TestAmount_SubUnderflow(t *testing.T) {
+	if _, err := Amount(1).Sub(2); err == nil {
+		t.Fatal("expected underflow error")
+	}
+}
+
+func TestDenomination_FormatParse(t *testing.T) {
+	d := Denomination{Symbol: "TBB", Unit: "bar", Decimals: 2}
+
+	cases := map[string]Amount{
+		"0.05 TBB":    5,
+		"1.50 TBB":    150,
+		"1000.00 TBB": 100000,
+	}
+
+	for s, a := range cases {
+		if got := d.Format(a); got != s {
+			t.Fatalf("format %d: expected '%s', got '%s'", a, s, got)
+		}
+
+		parsed, err := d.Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed != a {
+			t.Fatalf("parse '%s': expected %d, got %d", s, a, parsed)
+		}
+	}
+
+	if _, err := d.Parse("1.001"); err == nil {
+		t.Fatal("expected error for too many decimals")
+	}
+}
@@ -1,11 +1,8 @@
 package database
 
 import (
-	"crypto/rand"
 	"crypto/sha256"
 	"encoding/json"
-	"math"
-	"math/big"
 )
 
 type Block struct {
@@ -19,11 +16,22 @@ type BlockHeader struct {
 	Time   uint64  `json:"time"`
 	Nonce  uint32  `json:"nonce"`
 	Miner  Account `json:"miner"`
+	// Signature and Vote are only used by proof-of-authority blocks.
+	Signature []byte `json:"signature,omitempty"`
+	Vote      *Vote  `json:"vote,omitempty"`
+	// TxRoot and StateRoot commit to the block TXs and to the balances once
+	// the block is applied, light nodes verify proofs against them. Blocks
+	// mined before commitments were introduced have neither.
+	TxRoot    *Hash `json:"tx_root,omitempty"`
+	StateRoot *Hash `json:"state_root,omitempty"`
 }
 
 type BlockFS struct {
 	BlockHash Hash  `json:"hash"`
 	Block     Block `json:"block"`
+	// Pruned blocks only keep their header, BlockHash can't be recomputed.
+	Pruned   bool   `json:"pruned,omitempty"`
+	Checksum string `json:"checksum,omitempty"`
 }
 
 func NewBlock(parentHash Hash, number uint64, time uint64, nonce uint32, miner Account, txs []SignedTx) Block {
@@ -39,20 +47,31 @@ func NewBlock(parentHash Hash, number uint64, time uint64, nonce uint32, miner A
 	}
 }
 
+// Hash is the sha256 of the block JSON. A block committing to its TXs is
+// identified by its header alone, its TxRoot covers the TXs.
 func (b Block) Hash() (Hash, error) {
-	blockJSON, err := json.Marshal(b)
+	blockJSON, err := b.hashedJSON()
 	if err != nil {
 		return Hash{}, err
 	}
 	return sha256.Sum256(blockJSON), nil
 }
 
-func RandomNonce() (uint32, error) {
-	// rand.Seed(time.Now().UnixNano())
-	// return rand.Uint32()
-	n, err := rand.Int(rand.Reader, big.NewInt(math.MaxUint32))
-	if err != nil {
-		return 0, err
+func (b Block) hashedJSON() ([]byte, error) {
+	if b.Header.TxRoot != nil {
+		return json.Marshal(b.Header)
+	}
+	return json.Marshal(b)
+}
+
+// TotalFees sums the fees the block's transactions pay to its miner.
+func (b Block) TotalFees() (Amount, error) {
+	total := Amount(0)
+	for _, tx := range b.TXs {
+		var err error
+		if total, err = total.Add(tx.Fee); err != nil {
+			return 0, err
+		}
 	}
-	return uint32(n.Int64()), nil
+	return total, nil
 }
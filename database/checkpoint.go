@@ -0,0 +1,110 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Checkpoints pin the block hash at some heights. A chain conflicting with
+// any of them is rejected, whatever peer serves it.
+type Checkpoints map[uint64]Hash
+
+// builtinCheckpoints are shipped with the binary, by genesis chain_id. A
+// release adds a recent block of each public chain here.
+var builtinCheckpoints = map[string]Checkpoints{
+	"the-blockchain-bar-ledger": {},
+}
+
+// Heights returns the checkpointed heights in ascending order.
+func (c Checkpoints) Heights() []uint64 {
+	heights := make([]uint64, 0, len(c))
+	for height := range c {
+		heights = append(heights, height)
+	}
+	sort.Slice(heights, func(i, j int) bool {
+		return heights[i] < heights[j]
+	})
+	return heights
+}
+
+func (c Checkpoints) verify(number uint64, hash Hash) error {
+	checkpoint, ok := c[number]
+	if ok && checkpoint != hash {
+		return fmt.Errorf("block %d is '%x', but checkpoint requires '%x'", number, hash, checkpoint)
+	}
+	return nil
+}
+
+// loadCheckpoints merges the built-in checkpoints of the chain with the ones
+// of the genesis config.
+func loadCheckpoints(chainID string, configured Checkpoints) (Checkpoints, error) {
+	checkpoints := make(Checkpoints)
+	for number, hash := range builtinCheckpoints[chainID] {
+		checkpoints[number] = hash
+	}
+
+	for number, hash := range configured {
+		if builtin, ok := checkpoints[number]; ok && builtin != hash {
+			return nil, fmt.Errorf("checkpoint %d '%x' conflicts with the built-in '%x'", number, hash, builtin)
+		}
+		checkpoints[number] = hash
+	}
+	return checkpoints, nil
+}
+
+func (s *State) Checkpoints() Checkpoints {
+	return s.checkpoints
+}
+
+// SetFastSync makes VerifyCheckpoints mark the blocks below a checkpoint so
+// their TX signatures aren't checked, the checkpoint hash vouches for them.
+func (s *State) SetFastSync(enabled bool) {
+	s.fastSync = enabled
+}
+
+// VerifyCheckpoints checks a segment of blocks about to be added on top of the
+// chain against the checkpoints, before any of them is added. With fast sync,
+// the blocks linked by their parent hashes to a checkpoint in the segment
+// skip the TX signature checks once added, until the segment is verified or
+// ForgetSegment is called.
+func (s *State) VerifyCheckpoints(blocks []Block) error {
+	s.ForgetSegment()
+
+	hashes := make([]Hash, len(blocks))
+	for i, block := range blocks {
+		hash, err := block.Hash()
+		if err != nil {
+			return err
+		}
+		if err := s.checkpoints.verify(block.Header.Number, hash); err != nil {
+			return err
+		}
+		hashes[i] = hash
+	}
+
+	if !s.fastSync {
+		return nil
+	}
+
+	for i := len(blocks) - 1; i >= 0; i-- {
+		if _, ok := s.checkpoints[blocks[i].Header.Number]; !ok {
+			continue
+		}
+
+		ancestor := hashes[i]
+		for j := i; j >= 0 && hashes[j] == ancestor; j-- {
+			s.sigsChecked[hashes[j]] = true
+			ancestor = blocks[j].Header.Parent
+		}
+		return nil
+	}
+	return nil
+}
+
+// ForgetSegment drops the blocks of the last verified segment not added yet,
+// the caller is done with the segment.
+func (s *State) ForgetSegment() {
+	if len(s.sigsChecked) > 0 {
+		s.sigsChecked = make(map[Hash]bool)
+	}
+}
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func newTestChainState(t *testing.T, g genesis) *State {
+	dir, err := ioutil.TempDir("", "tbb-checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	genesisJSON, err := json.Marshal(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(getDatabaseDirPath(dir), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(getGenesisJSONFilePath(dir), genesisJSON, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeEmptyBlocksDBToDisk(getBlocksDBFilePath(dir)); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := NewStateFromDisk(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { state.Close() })
+	return state
+}
+
+func TestCheckpoints(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := Account(crypto.PubkeyToAddress(key.PublicKey))
+	bob, miner := NewAccount("0x02"), NewAccount("0x03")
+
+	// the TX is changed after signing, its signature doesn't match anymore
+	forged := signTestTx(t, TX{From: alice, To: bob, Value: 100, Time: 1}, key)
+	forged.Value = 200
+
+	block0 := NewBlock(Hash{}, 0, 1, 0, miner, []SignedTx{forged})
+	hash0, err := block0.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block1 := NewBlock(hash0, 1, 2, 0, miner, nil)
+	hash1, err := block1.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherBlock1 := NewBlock(hash0, 1, 3, 0, miner, nil)
+
+	g := genesis{
+		Consensus:   &ConsensusConfig{Engine: EngineInstant},
+		Balances:    map[Account]Amount{alice: 1000},
+		Checkpoints: Checkpoints{1: hash1},
+	}
+
+	state := newTestChainState(t, g)
+	if err := state.VerifyCheckpoints([]Block{block0, otherBlock1}); err == nil {
+		t.Fatal("expected a block conflicting with the checkpoint to be rejected")
+	}
+	if err := state.VerifyCheckpoints([]Block{block0, block1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := state.AddBlock(block0); err == nil {
+		t.Fatal("expected the forged TX to be rejected without fast sync")
+	}
+
+	state = newTestChainState(t, g)
+	state.SetFastSync(true)
+	if err := state.VerifyCheckpoints([]Block{block0, block1}); err != nil {
+		t.Fatal(err)
+	}
+	for _, block := range []Block{block0, block1} {
+		if _, err := state.AddBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if state.Balances[bob] != 200 {
+		t.Fatalf("expected bob balance 200, got %d", state.Balances[bob])
+	}
+	if len(state.sigsChecked) != 0 {
+		t.Fatalf("expected the checkpointed blocks to be forgotten once added, got %d", len(state.sigsChecked))
+	}
+
+	// a segment whose blocks are never added
+	state = newTestChainState(t, g)
+	state.SetFastSync(true)
+	if err := state.VerifyCheckpoints([]Block{block0, block1}); err != nil {
+		t.Fatal(err)
+	}
+	if !state.copy().sigsChecked[hash0] {
+		t.Fatal("expected the copy of the state to know the checkpointed blocks")
+	}
+	state.copy().sigsChecked[hash1] = false
+	if !state.sigsChecked[hash1] {
+		t.Fatal("expected the copy of the state not to share the checkpointed blocks")
+	}
+	state.ForgetSegment()
+	if len(state.sigsChecked) != 0 {
+		t.Fatalf("expected the segment to be forgotten, got %d blocks", len(state.sigsChecked))
+	}
+}
@@ -0,0 +1,462 @@
+package database
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// StateLeaf is an entry of the state tree with its proof.
+type StateLeaf struct {
+	Key   []byte      `json:"key"`
+	Value []byte      `json:"value"`
+	Proof MerkleProof `json:"proof"`
+}
+
+// BalanceProof proves the balance of an account in an asset, the native
+// currency when empty, right after the block Number against the block
+// StateRoot. Leaves holds the balance's own leaf or, for an account without
+// balance, the leaves around its place in the tree.
+type BalanceProof struct {
+	Account   Account     `json:"account"`
+	Asset     string      `json:"asset,omitempty"`
+	Balance   Amount      `json:"balance"`
+	BlockHash Hash        `json:"block_hash"`
+	Number    uint64      `json:"number"`
+	Leaves    []StateLeaf `json:"leaves"`
+}
+
+// TxProof proves a TX is in a block against the block TxRoot.
+type TxProof struct {
+	Tx SignedTx `json:"tx"`
+	TxLocation
+	Proof MerkleProof `json:"proof"`
+}
+
+// TxRoot is the merkle root of the TXs in block order, each leaf is a signed
+// TX JSON so the root covers the signatures too.
+func TxRoot(txs []SignedTx) (Hash, error) {
+	leaves, err := txLeaves(txs)
+	if err != nil {
+		return Hash{}, err
+	}
+	return merkleRoot(leaves), nil
+}
+
+func txLeaf(tx SignedTx) (Hash, error) {
+	txJSON, err := json.Marshal(tx)
+	if err != nil {
+		return Hash{}, err
+	}
+	return merkleLeaf(txJSON), nil
+}
+
+func txLeaves(txs []SignedTx) ([]Hash, error) {
+	leaves := make([]Hash, len(txs))
+	for i, tx := range txs {
+		leaf, err := txLeaf(tx)
+		if err != nil {
+			return nil, err
+		}
+		leaves[i] = leaf
+	}
+	return leaves, nil
+}
+
+// The state tree leaves are the entries of the whole state sorted by key, the
+// first key byte tells the kind of entry.
+const (
+	stateKeyBalance byte = iota
+	stateKeyTokenBalance
+	stateKeyToken
+	stateKeyEscrow
+	stateKeyContract
+)
+
+type stateEntry struct {
+	key   []byte
+	value []byte
+}
+
+// balanceKey is the state key of the account balance in the asset.
+func balanceKey(account Account, asset string) []byte {
+	if asset == "" {
+		return append([]byte{stateKeyBalance}, account[:]...)
+	}
+	return append(symbolKey(stateKeyTokenBalance, asset), account[:]...)
+}
+
+func symbolKey(kind byte, symbol string) []byte {
+	return append([]byte{kind, byte(len(symbol))}, symbol...)
+}
+
+func amountValue(amount Amount) []byte {
+	var value [8]byte
+	binary.BigEndian.PutUint64(value[:], uint64(amount))
+	return value[:]
+}
+
+// stateEntries lists the non-zero balances, in the native currency and in
+// tokens, the tokens, the escrows and the contracts with their storage.
+func stateEntries(s *State) ([]stateEntry, error) {
+	entries := make([]stateEntry, 0, len(s.Balances))
+	addBalances := func(balances map[Account]Amount, asset string) {
+		for account, balance := range balances {
+			if balance > 0 {
+				entries = append(entries, stateEntry{balanceKey(account, asset), amountValue(balance)})
+			}
+		}
+	}
+
+	addBalances(s.Balances, "")
+	for symbol, token := range s.tokens {
+		addBalances(token.Balances, symbol)
+		entries = append(entries, stateEntry{symbolKey(stateKeyToken, symbol), append(append([]byte{}, token.Issuer[:]...), amountValue(token.Supply)...)})
+	}
+	for id, escrow := range s.escrows {
+		escrowJSON, err := json.Marshal(escrow)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, stateEntry{append([]byte{stateKeyEscrow}, id[:]...), escrowJSON})
+	}
+	for account, contract := range s.contracts {
+		contractJSON, err := json.Marshal(contract)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, stateEntry{append([]byte{stateKeyContract}, account[:]...), contractJSON})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].key, entries[j].key) < 0
+	})
+	return entries, nil
+}
+
+func stateLeaf(key []byte, value []byte) Hash {
+	return merkleLeaf(append(append([]byte{}, key...), value...))
+}
+
+func stateLeaves(entries []stateEntry) []Hash {
+	leaves := make([]Hash, len(entries))
+	for i, entry := range entries {
+		leaves[i] = stateLeaf(entry.key, entry.value)
+	}
+	return leaves
+}
+
+// StateRoot is the merkle root of the whole state: balances, tokens, HTLC
+// escrows and contracts.
+func (s *State) StateRoot() (Hash, error) {
+	entries, err := stateEntries(s)
+	if err != nil {
+		return Hash{}, err
+	}
+	return merkleRoot(stateLeaves(entries)), nil
+}
+
+// Prepare fills the engine fields of a new block extending the state, and
+// its header commitments to the TXs and the balances once it's applied.
+func (s *State) Prepare(b Block) (Block, error) {
+	pendingState := s.copy()
+
+	if err := s.engine.Prepare(pendingState, &b.Header); err != nil {
+		return Block{}, err
+	}
+
+	txRoot, err := TxRoot(b.TXs)
+	if err != nil {
+		return Block{}, err
+	}
+	b.Header.TxRoot = &txRoot
+	b.Header.StateRoot = nil
+
+	if _, err := applyBlockTXs(pendingState, b, Hash{}); err != nil {
+		return Block{}, err
+	}
+
+	stateRoot, err := pendingState.StateRoot()
+	if err != nil {
+		return Block{}, err
+	}
+	b.Header.StateRoot = &stateRoot
+
+	return b, nil
+}
+
+// verifyTxRoot checks the TX commitment of the block, required from the
+// commitments fork on.
+func verifyTxRoot(state *State, b Block) error {
+	if b.Header.TxRoot == nil {
+		if forkActive(state.forks.Commitments, b.Header.Number) {
+			return fmt.Errorf("block %d doesn't commit to its TXs", b.Header.Number)
+		}
+		if b.Header.StateRoot != nil {
+			return fmt.Errorf("block %d commits to its state but not to its TXs", b.Header.Number)
+		}
+		return nil
+	}
+
+	txRoot, err := TxRoot(b.TXs)
+	if err != nil {
+		return err
+	}
+	if txRoot != *b.Header.TxRoot {
+		return fmt.Errorf("block %d TX root is %x, its TXs give %x", b.Header.Number, *b.Header.TxRoot, txRoot)
+	}
+	return nil
+}
+
+// verifyStateRoot checks the state commitment of the block against the state
+// it was applied to, required from the commitments fork on.
+func verifyStateRoot(state *State, b Block) error {
+	if b.Header.StateRoot == nil {
+		if forkActive(state.forks.Commitments, b.Header.Number) {
+			return fmt.Errorf("block %d doesn't commit to its state", b.Header.Number)
+		}
+		return nil
+	}
+
+	stateRoot, err := state.StateRoot()
+	if err != nil {
+		return err
+	}
+	if stateRoot != *b.Header.StateRoot {
+		return fmt.Errorf("block %d state root is %x, its TXs give %x", b.Header.Number, *b.Header.StateRoot, stateRoot)
+	}
+	return nil
+}
+
+// maxStateReplay bounds the blocks replayed to rebuild a past state, older
+// states than the snapshots allow aren't proven.
+const maxStateReplay = SnapshotInterval
+
+// stateAt rebuilds the state right after the block at the given height from
+// the closest snapshot below it, or from genesis, replaying blocks.db. The
+// blocks were validated when added, only their TXs are applied again. The
+// latest height is the state itself, a past state is built apart from it and
+// can be rebuilt while blocks are added.
+func (s *State) stateAt(number uint64) (*State, error) {
+	if _, ok := s.locationByNumber(number); !ok {
+		return nil, fmt.Errorf("%w %d", ErrUnknownBlock, number)
+	}
+	if _, ok := s.locationByNumber(number + 1); !ok {
+		return s, nil
+	}
+
+	genesis, err := loadGenesis(getGenesisJSONFilePath(s.dataDir))
+	if err != nil {
+		return nil, err
+	}
+	snapshots, err := loadSnapshots(s.dataDir, s.engine)
+	if err != nil {
+		return nil, err
+	}
+
+	state := newGenesisState(s.dataDir, genesis, nil)
+	from := uint64(0)
+	for _, snapshot := range snapshots {
+		if snapshot.Number() <= number {
+			state.loadSnapshot(snapshot)
+			from = snapshot.Number() + 1
+			break
+		}
+	}
+	if replayed := number + 1 - from; replayed > maxStateReplay {
+		return nil, fmt.Errorf("block %d is too old, its state is %d blocks after the closest snapshot, at most %d are replayed", number, replayed, maxStateReplay)
+	}
+
+	f, locations, err := s.openBlocks(from, number)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	for _, location := range locations {
+		if location.Pruned {
+			return nil, errPruned(location.Number, s.PrunedBelow())
+		}
+
+		blockFS, err := readBlockRecord(f, location.Offset)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := applyBlockTXs(state, blockFS.Block, blockFS.BlockHash); err != nil {
+			return nil, err
+		}
+		state.latestBlock = blockFS.Block
+		state.latestBlockHash = blockFS.BlockHash
+		state.hasGenesisBlock = true
+	}
+
+	if !state.hasGenesisBlock || state.latestBlock.Header.Number != number {
+		return nil, fmt.Errorf("unable to rebuild the state at block %d", number)
+	}
+	return state, nil
+}
+
+// openBlocks opens blocks.db for reading on its own with the locations of the
+// blocks from one height to another in it. Pruning replaces the file, the
+// handle keeps reading the one the locations are for.
+func (s *State) openBlocks(from uint64, to uint64) (*os.File, []blockLocation, error) {
+	s.dbMu.RLock()
+	defer s.dbMu.RUnlock()
+
+	f, err := os.Open(getBlocksDBFilePath(s.dataDir))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	locations := make([]blockLocation, 0, to+1-from)
+	for number := from; number <= to; number++ {
+		location, ok := s.locationByNumber(number)
+		if !ok {
+			f.Close()
+			return nil, nil, fmt.Errorf("%w %d", ErrUnknownBlock, number)
+		}
+		locations = append(locations, location)
+	}
+	return f, locations, nil
+}
+
+// BalanceProof proves the balance of the account in the asset, the native
+// currency when empty, right after the block at the given height. The block
+// must commit to its state, the state at a past height is rebuilt first. Only
+// proving the latest height reads the state, see stateAt.
+func (s *State) BalanceProof(account Account, asset string, number uint64) (BalanceProof, error) {
+	blockFS, err := s.GetBlockByNumber(number)
+	if err != nil {
+		return BalanceProof{}, err
+	}
+	if blockFS.Block.Header.StateRoot == nil {
+		return BalanceProof{}, fmt.Errorf("block %d has no state commitment", number)
+	}
+
+	state, err := s.stateAt(number)
+	if err != nil {
+		return BalanceProof{}, err
+	}
+	entries, err := stateEntries(state)
+	if err != nil {
+		return BalanceProof{}, err
+	}
+	leaves := stateLeaves(entries)
+
+	key := balanceKey(account, asset)
+	proof := BalanceProof{Account: account, Asset: asset, BlockHash: blockFS.BlockHash, Number: number, Leaves: []StateLeaf{}}
+
+	leaf := func(i int) StateLeaf {
+		return StateLeaf{entries[i].key, entries[i].value, newMerkleProof(leaves, i)}
+	}
+
+	i := sort.Search(len(entries), func(i int) bool {
+		return bytes.Compare(entries[i].key, key) >= 0
+	})
+	if i < len(entries) && bytes.Equal(entries[i].key, key) {
+		proof.Balance = state.BalanceOf(account, asset)
+		proof.Leaves = append(proof.Leaves, leaf(i))
+		return proof, nil
+	}
+
+	if i > 0 {
+		proof.Leaves = append(proof.Leaves, leaf(i-1))
+	}
+	if i < len(entries) {
+		proof.Leaves = append(proof.Leaves, leaf(i))
+	}
+	if len(proof.Leaves) == 0 {
+		return BalanceProof{}, fmt.Errorf("block %d state has no entry to prove against", number)
+	}
+	return proof, nil
+}
+
+// Verify checks the proof against the state root of its block.
+func (p BalanceProof) Verify(stateRoot Hash) error {
+	if len(p.Leaves) == 0 || len(p.Leaves) > 2 {
+		return fmt.Errorf("balance proof needs 1 or 2 leaves, got %d", len(p.Leaves))
+	}
+
+	for _, leaf := range p.Leaves {
+		if err := leaf.Proof.verify(stateRoot, stateLeaf(leaf.Key, leaf.Value)); err != nil {
+			return fmt.Errorf("state entry %x: %v", leaf.Key, err)
+		}
+	}
+
+	key := balanceKey(p.Account, p.Asset)
+	if bytes.Equal(p.Leaves[0].Key, key) {
+		if len(p.Leaves) != 1 || !bytes.Equal(p.Leaves[0].Value, amountValue(p.Balance)) {
+			return fmt.Errorf("proof of %s balance %d doesn't match its leaf", p.Account.Hex(), p.Balance)
+		}
+		return nil
+	}
+
+	// the account has no balance: the proven leaves are its neighbours in the
+	// sorted tree, or the first or last leaf when it sorts before or after all
+	if p.Balance != 0 {
+		return fmt.Errorf("proof of %s balance %d has no leaf for it", p.Account.Hex(), p.Balance)
+	}
+
+	var before, after *StateLeaf
+	for i := range p.Leaves {
+		leaf := &p.Leaves[i]
+		switch cmp := bytes.Compare(leaf.Key, key); {
+		case cmp < 0 && before == nil:
+			before = leaf
+		case cmp > 0 && after == nil:
+			after = leaf
+		default:
+			return fmt.Errorf("proof leaves don't surround %s", p.Account.Hex())
+		}
+	}
+
+	switch {
+	case before != nil && after != nil && after.Proof.Index != before.Proof.Index+1:
+		return fmt.Errorf("proof leaves around %s aren't adjacent", p.Account.Hex())
+	case before == nil && after.Proof.Index != 0:
+		return fmt.Errorf("proof leaf after %s isn't the first one", p.Account.Hex())
+	case after == nil && before.Proof.Index != before.Proof.Size-1:
+		return fmt.Errorf("proof leaf before %s isn't the last one", p.Account.Hex())
+	}
+	return nil
+}
+
+// TxProof proves the mined TX is in its block, the block must commit to its
+// TXs. The bool is false for an unknown TX.
+func (s *State) TxProof(txHash Hash) (TxProof, bool, error) {
+	tx, location, isMined, err := s.GetTx(txHash)
+	if err != nil || !isMined {
+		return TxProof{}, false, err
+	}
+
+	blockFS, err := s.GetBlockByHash(location.BlockHash)
+	if err != nil {
+		return TxProof{}, false, err
+	}
+	if blockFS.Block.Header.TxRoot == nil {
+		return TxProof{}, false, fmt.Errorf("block %d has no TX commitment", location.BlockNumber)
+	}
+
+	leaves, err := txLeaves(blockFS.Block.TXs)
+	if err != nil {
+		return TxProof{}, false, err
+	}
+
+	return TxProof{tx, location, newMerkleProof(leaves, location.Index)}, true, nil
+}
+
+// Verify checks the proof against the TX root of its block.
+func (p TxProof) Verify(txRoot Hash) error {
+	if p.Proof.Index != uint64(p.Index) {
+		return fmt.Errorf("proof is for TX %d, not TX %d", p.Proof.Index, p.Index)
+	}
+
+	leaf, err := txLeaf(p.Tx)
+	if err != nil {
+		return err
+	}
+	return p.Proof.verify(txRoot, leaf)
+}
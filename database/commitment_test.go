@@ -0,0 +1,356 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestMerkleProof(t *testing.T) {
+	for size := 1; size <= 9; size++ {
+		leaves := make([]Hash, size)
+		for i := range leaves {
+			leaves[i] = merkleLeaf([]byte{byte(i)})
+		}
+		root := merkleRoot(leaves)
+
+		for i := range leaves {
+			proof := newMerkleProof(leaves, i)
+			if err := proof.verify(root, leaves[i]); err != nil {
+				t.Fatalf("leaf %d of %d: %v", i, size, err)
+			}
+
+			if err := proof.verify(root, merkleLeaf([]byte{0xff})); err == nil {
+				t.Fatalf("leaf %d of %d: expected another leaf to be rejected", i, size)
+			}
+
+			resized := proof
+			resized.Size++
+			if err := resized.verify(root, leaves[i]); err == nil {
+				t.Fatalf("leaf %d of %d: expected another tree size to be rejected", i, size)
+			}
+		}
+	}
+}
+
+func TestCommitments(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := Account(crypto.PubkeyToAddress(key.PublicKey))
+	bob, miner := NewAccount("0x02"), NewAccount("0x03")
+
+	state := newTestChainState(t, genesis{
+		Consensus: &ConsensusConfig{Engine: EngineInstant},
+		Balances:  map[Account]Amount{alice: 1000},
+	})
+
+	// a block mined before commitments, then committed ones
+	tx := signTestTx(t, TX{From: alice, To: bob, Value: 10, Time: 0}, key)
+	parent, err := state.AddBlock(NewBlock(Hash{}, 0, 0, 0, miner, []SignedTx{tx}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txs := []SignedTx{
+		signTestTx(t, TX{From: alice, To: bob, Value: 20, Time: 1}, key),
+		signTestTx(t, TX{From: alice, To: bob, Value: 30, Time: 2}, key),
+	}
+	block, err := state.Seal(context.Background(), NewBlock(parent, 1, 1, 0, miner, txs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.Header.TxRoot == nil || block.Header.StateRoot == nil {
+		t.Fatal("expected a sealed block to commit to its TXs and state")
+	}
+
+	tampered := block
+	tampered.TXs = txs[:1]
+	if _, err := state.AddBlock(tampered); err == nil {
+		t.Fatal("expected a block whose TXs don't match its TX root to be rejected")
+	}
+
+	if _, err := state.AddBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	proof, err := state.BalanceProof(bob, "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proof.Balance != 60 {
+		t.Fatalf("expected bob balance 60, got %d", proof.Balance)
+	}
+	if err := proof.Verify(*block.Header.StateRoot); err != nil {
+		t.Fatal(err)
+	}
+
+	forged := proof
+	forged.Balance = 1000
+	forged.Leaves = []StateLeaf{proof.Leaves[0]}
+	forged.Leaves[0].Value = amountValue(1000)
+	if err := forged.Verify(*block.Header.StateRoot); err == nil {
+		t.Fatal("expected a forged balance to be rejected")
+	}
+
+	for _, account := range []Account{NewAccount("0x01"), NewAccount("0x04"), NewAccount("0xffffffffffffffffffffffffffffffffffffffff")} {
+		proof, err := state.BalanceProof(account, "", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := proof.Verify(*block.Header.StateRoot); err != nil || proof.Balance != 0 {
+			t.Fatalf("expected %s proven without balance, got %d: %v", account.Hex(), proof.Balance, err)
+		}
+
+		proof.Balance = 5
+		if err := proof.Verify(*block.Header.StateRoot); err == nil {
+			t.Fatalf("expected a balance of %s without leaf to be rejected", account.Hex())
+		}
+	}
+
+	if _, err := state.BalanceProof(bob, "", 0); err == nil {
+		t.Fatal("expected no balance proof for a block without commitments")
+	}
+
+	txHash, err := txs[1].Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	txProof, isMined, err := state.TxProof(txHash)
+	if err != nil || !isMined {
+		t.Fatalf("expected a proof of the mined TX: %v", err)
+	}
+	if err := txProof.Verify(*block.Header.TxRoot); err != nil {
+		t.Fatal(err)
+	}
+
+	// a light node syncs the headers and checks the proofs against them
+	dir, err := ioutil.TempDir("", "tbb-light")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	genesisJSON, err := ioutil.ReadFile(getGenesisJSONFilePath(state.dataDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(path.Dir(getGenesisJSONFilePath(dir)), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(getGenesisJSONFilePath(dir), genesisJSON, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	headers, err := NewHeaderChainFromDisk(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocks, err := state.GetHeadersAfter(Hash{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 2 || len(blocks[0].TXs) != 1 || len(blocks[1].TXs) != 0 {
+		t.Fatalf("expected the legacy block with its TXs and the committed one without, got %+v", blocks)
+	}
+
+	if _, err := headers.AddHeader(blocks[1]); err == nil {
+		t.Fatal("expected a header not extending the chain to be rejected")
+	}
+	for _, b := range blocks {
+		if _, err := headers.AddHeader(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := headers.VerifyBalanceProof(proof); err != nil {
+		t.Fatal(err)
+	}
+	if err := headers.VerifyTxProof(txProof); err != nil {
+		t.Fatal(err)
+	}
+	headers.Close()
+
+	headers, err = NewHeaderChainFromDisk(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer headers.Close()
+
+	if headers.LatestBlockHash() != state.LatestBlockHash() {
+		t.Fatalf("expected headers reloaded up to %x, got %x", state.LatestBlockHash(), headers.LatestBlockHash())
+	}
+}
+
+func TestStateCommitments(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := Account(crypto.PubkeyToAddress(key.PublicKey))
+	bob, miner := NewAccount("0x02"), NewAccount("0x03")
+
+	state := newTestChainState(t, genesis{
+		Consensus: &ConsensusConfig{Engine: EngineInstant},
+		Balances:  map[Account]Amount{alice: 1000},
+		Forks:     &Forks{Commitments: forkHeight(1)},
+	})
+
+	// commitments are optional before the fork
+	hashLock := NewHashLock([]byte("secret"))
+	parent, err := state.AddBlock(NewBlock(Hash{}, 0, 0, 0, miner, []SignedTx{
+		signTestTx(t, TX{From: alice, To: alice, Value: 100, Asset: "GOLD", Time: 0, Type: TxTypeTokenIssue}, key),
+		signTestTx(t, TX{From: alice, To: bob, Value: 10, Time: 1, Type: TxTypeHTLCLock, HTLC: &HTLC{HashLock: &hashLock, Timeout: 10}}, key),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txs := []SignedTx{signTestTx(t, TX{From: alice, To: bob, Value: 30, Asset: "GOLD", Time: 2}, key)}
+	if _, err := state.AddBlock(NewBlock(parent, 1, 1, 0, miner, txs)); err == nil {
+		t.Fatal("expected a block without commitments from the fork on to be rejected")
+	}
+
+	block, err := state.Seal(context.Background(), NewBlock(parent, 1, 1, 0, miner, txs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent, err = state.AddBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	// the escrows and the contracts are committed to as well
+	root, err := state.StateRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, change := range map[string]func(s *State){
+		"an escrow": func(s *State) {
+			for id, escrow := range s.escrows {
+				escrow.Status = EscrowStatusRefunded
+				s.escrows[id] = escrow
+			}
+		},
+		"a contract":     func(s *State) { s.contracts[NewAccount("0x05")] = &Contract{Creator: alice} },
+		"a token supply": func(s *State) { s.tokens["GOLD"].Supply++ },
+	} {
+		changed := state.copy()
+		change(changed)
+		if changedRoot, err := changed.StateRoot(); err != nil || changedRoot == root {
+			t.Fatalf("expected %s to change the state root: %v", name, err)
+		}
+	}
+
+	proof, err := state.BalanceProof(bob, "GOLD", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proof.Balance != 30 {
+		t.Fatalf("expected bob to hold 30 GOLD, got %d", proof.Balance)
+	}
+	if err := proof.Verify(*block.Header.StateRoot); err != nil {
+		t.Fatal(err)
+	}
+
+	native := proof
+	native.Asset = ""
+	if err := native.Verify(*block.Header.StateRoot); err == nil {
+		t.Fatal("expected a GOLD balance proof not to prove a native balance")
+	}
+
+	// a past state is rebuilt to prove it
+	next, err := state.Seal(context.Background(), NewBlock(parent, 2, 2, 0, miner, []SignedTx{
+		signTestTx(t, TX{From: alice, To: bob, Value: 20, Asset: "GOLD", Time: 3}, key),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := state.AddBlock(next); err != nil {
+		t.Fatal(err)
+	}
+
+	if proof, err = state.BalanceProof(bob, "GOLD", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := proof.Verify(*block.Header.StateRoot); err != nil || proof.Balance != 30 {
+		t.Fatalf("expected bob to hold 30 GOLD after block 1, got %d: %v", proof.Balance, err)
+	}
+	if proof, err = state.BalanceProof(bob, "GOLD", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := proof.Verify(*next.Header.StateRoot); err != nil || proof.Balance != 50 {
+		t.Fatalf("expected bob to hold 50 GOLD after block 2, got %d: %v", proof.Balance, err)
+	}
+}
+
+func TestPastBalanceProofs(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := Account(crypto.PubkeyToAddress(key.PublicKey))
+	bob, miner := NewAccount("0x02"), NewAccount("0x03")
+
+	state := newTestChainState(t, genesis{
+		Consensus: &ConsensusConfig{Engine: EngineInstant},
+		Balances:  map[Account]Amount{alice: 1000000},
+		Forks:     &Forks{Commitments: forkHeight(0)},
+	})
+	defer state.Close()
+
+	roots := make(map[uint64]Hash)
+	addBlocks := func(to uint64) {
+		for number := state.NextBlockNumber(); number <= to; number++ {
+			tx := signTestTx(t, TX{From: alice, To: bob, Value: 1, Time: number}, key)
+			block, err := state.Seal(context.Background(), NewBlock(state.LatestBlockHash(), number, number, 0, miner, []SignedTx{tx}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := state.AddBlock(block); err != nil {
+				t.Fatal(err)
+			}
+			roots[number] = *block.Header.StateRoot
+		}
+	}
+	addBlocks(2*SnapshotInterval + 50)
+
+	// past states are rebuilt apart while the chain grows
+	proven := make(chan error, 1)
+	go func() {
+		for _, number := range []uint64{2*SnapshotInterval + 50, 2*SnapshotInterval + 10, 10} {
+			proof, err := state.BalanceProof(bob, "", number)
+			if err == nil && proof.Balance != Amount(number+1) {
+				err = fmt.Errorf("expected bob to hold %d after block %d, got %d", number+1, number, proof.Balance)
+			}
+			if err != nil {
+				proven <- err
+				return
+			}
+		}
+		close(proven)
+	}()
+	addBlocks(3*SnapshotInterval + 50)
+	if err := <-proven; err != nil {
+		t.Fatal(err)
+	}
+
+	proof, err := state.BalanceProof(bob, "", 2*SnapshotInterval+50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := proof.Verify(roots[2*SnapshotInterval+50]); err != nil {
+		t.Fatal(err)
+	}
+
+	// the snapshots kept bound the replay
+	if _, err := state.BalanceProof(bob, "", SnapshotInterval+10); err == nil {
+		t.Fatal("expected the state before the snapshots kept not to be rebuilt")
+	}
+}
@@ -0,0 +1,120 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	EnginePoW     = "pow"
+	EnginePoA     = "poa"
+	EngineInstant = "instant"
+)
+
+// ConsensusConfig is the "consensus" section of genesis.json. Without it the
+// chain uses proof-of-work.
+type ConsensusConfig struct {
+	Engine string `json:"engine"`
+	// Signers are the accounts initially authorised to seal PoA blocks.
+	Signers []Account `json:"signers,omitempty"`
+}
+
+// Engine decides who may produce a block and how blocks are sealed and
+// verified. Block production in the node and validation in applyBlock only go
+// through it, so adding an engine doesn't touch State or Node.
+type Engine interface {
+	Name() string
+	// Prepare fills the engine fields of a new block header extending the
+	// state, e.g. resets the PoW nonce.
+	Prepare(state *State, header *BlockHeader) error
+	// Seal makes a prepared block valid under the engine rules on top of the
+	// state: PoW searches a nonce, PoA signs the header.
+	Seal(ctx context.Context, state *State, b Block) (Block, error)
+	// VerifySeal checks the block seal on its own, without the chain.
+	VerifySeal(b Block) error
+	// VerifyHeader checks the block seal and that it may extend the state.
+	VerifyHeader(state *State, b Block) error
+	// Finalize credits the block rewards and updates the engine's part of
+	// the state once the block transactions are applied.
+	Finalize(state *State, b Block) error
+}
+
+func newEngine(config ConsensusConfig) (Engine, error) {
+	switch config.Engine {
+	case "", EnginePoW:
+		return NewPoW(), nil
+	case EnginePoA:
+		if len(config.Signers) == 0 {
+			return nil, fmt.Errorf("poa consensus needs at least one signer")
+		}
+		return NewPoA(), nil
+	case EngineInstant:
+		return NewInstantSeal(), nil
+	default:
+		return nil, fmt.Errorf("unknown consensus engine '%s'", config.Engine)
+	}
+}
+
+// accumulateRewards credits the block reward to the miner, transaction fees
+// are credited as each transaction is applied.
+func accumulateRewards(state *State, b Block) error {
+	return state.credit(b.Header.Miner, BlockReward)
+}
+
+// LoadConsensusConfig reads the consensus configuration of the data dir
+// genesis, the default one if the data dir isn't initialised yet.
+func LoadConsensusConfig(dataDir string) (ConsensusConfig, error) {
+	if !fileExists(getGenesisJSONFilePath(dataDir)) {
+		return ConsensusConfig{Engine: EnginePoW}, nil
+	}
+
+	genesis, err := loadGenesis(getGenesisJSONFilePath(dataDir))
+	if err != nil {
+		return ConsensusConfig{}, err
+	}
+	return *genesis.Consensus, nil
+}
+
+// LoadDenomination reads the denomination of the data dir genesis, the
+// default one if the data dir isn't initialised yet.
+func LoadDenomination(dataDir string) (Denomination, error) {
+	if !fileExists(getGenesisJSONFilePath(dataDir)) {
+		return DefaultDenomination, nil
+	}
+
+	genesis, err := loadGenesis(getGenesisJSONFilePath(dataDir))
+	if err != nil {
+		return Denomination{}, err
+	}
+	return *genesis.Denomination, nil
+}
+
+// Engine returns the consensus engine of the chain.
+func (s *State) Engine() Engine {
+	return s.engine
+}
+
+// Seal prepares and seals a block extending the current state with the
+// chain's engine.
+func (s *State) Seal(ctx context.Context, b Block) (Block, error) {
+	seal, err := s.PrepareSeal(b)
+	if err != nil {
+		return Block{}, err
+	}
+	return seal(ctx)
+}
+
+// PrepareSeal prepares a block extending the current state and returns the
+// function sealing it. The seal works on a copy of the state, a caller
+// guarding the state only holds its lock while preparing.
+func (s *State) PrepareSeal(b Block) (func(ctx context.Context) (Block, error), error) {
+	b, err := s.Prepare(b)
+	if err != nil {
+		return nil, err
+	}
+
+	state := s.copy()
+	return func(ctx context.Context) (Block, error) {
+		return s.engine.Seal(ctx, state, b)
+	}, nil
+}
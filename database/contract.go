@@ -0,0 +1,140 @@
+package database
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// The contract TX types deploy contract code and call it. A deploy carries
+// the hex encoded code in its data, a call is sent to the contract with its
+// arguments in the data. Contract TXs carry no value, their fee pays for
+// their gas limit at one smallest unit per gas.
+const (
+	TxTypeContractDeploy TxType = "contract_deploy"
+	TxTypeContractCall   TxType = "contract_call"
+)
+
+// Contract is deployed code with its key-value storage.
+type Contract struct {
+	Creator Account `json:"creator"`
+	// Code is hex encoded.
+	Code    string            `json:"code"`
+	Storage map[uint64]uint64 `json:"storage"`
+}
+
+// Execution is the outcome of a contract TX. A failed call still pays its
+// fee, its storage writes are discarded.
+type Execution struct {
+	Contract Account
+	GasUsed  uint64
+	Return   []uint64
+	Err      error
+}
+
+func (c *Contract) copy() *Contract {
+	cp := &Contract{Creator: c.Creator, Code: c.Code, Storage: make(map[uint64]uint64, len(c.Storage))}
+	for key, value := range c.Storage {
+		cp.Storage[key] = value
+	}
+	return cp
+}
+
+func copyContracts(contracts map[Account]*Contract) map[Account]*Contract {
+	cp := make(map[Account]*Contract, len(contracts))
+	for account, contract := range contracts {
+		cp[account] = contract.copy()
+	}
+	return cp
+}
+
+// ContractAccount returns the account of the contract deployed by the TX with
+// the given hash.
+func ContractAccount(deployTxHash Hash) Account {
+	return Account(common.BytesToAddress(deployTxHash[12:]))
+}
+
+// GetContract returns a copy of the contract at the account.
+func (s *State) GetContract(account Account) (Contract, bool) {
+	contract, ok := s.contracts[account]
+	if !ok {
+		return Contract{}, false
+	}
+	return *contract.copy(), true
+}
+
+func (s *State) applyContract(tx SignedTx, header BlockHeader) (*Execution, error) {
+	if tx.Value != 0 || tx.Asset != "" {
+		return nil, fmt.Errorf("wrong TX. Contract TX can't carry value")
+	}
+	if tx.GasLimit == 0 || tx.GasLimit > MaxGasLimit {
+		return nil, fmt.Errorf("wrong TX. Contract TX gas limit must be 1 to %d, got %d", MaxGasLimit, tx.GasLimit)
+	}
+	if tx.Fee < Amount(tx.GasLimit) {
+		return nil, fmt.Errorf("wrong TX. Fee %d doesn't cover the gas limit %d", tx.Fee, tx.GasLimit)
+	}
+
+	if tx.Type == TxTypeContractDeploy {
+		return s.deployContract(tx)
+	}
+
+	contract, ok := s.contracts[tx.To]
+	if !ok {
+		return nil, fmt.Errorf("wrong TX. No contract at %s", tx.To.Hex())
+	}
+	args, err := ParseContractArgs(tx.Data)
+	if err != nil {
+		return nil, fmt.Errorf("wrong TX. %v", err)
+	}
+	code, err := hex.DecodeString(contract.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.payFee(tx); err != nil {
+		return nil, err
+	}
+
+	// the call runs on a copy of the storage kept only on success
+	storage := contract.copy().Storage
+	ret, gasUsed, err := runContract(code, args, storage, header, tx.GasLimit)
+	if err == nil {
+		contract.Storage = storage
+	}
+	return &Execution{Contract: tx.To, GasUsed: gasUsed, Return: ret, Err: err}, nil
+}
+
+func (s *State) deployContract(tx SignedTx) (*Execution, error) {
+	if tx.To != tx.From {
+		return nil, fmt.Errorf("wrong TX. Contract deploy can't have a recipient")
+	}
+
+	code, err := hex.DecodeString(tx.Data)
+	if err != nil {
+		return nil, fmt.Errorf("wrong TX. Contract code must be hex encoded: %v", err)
+	}
+	if _, err := ValidateCode(code); err != nil {
+		return nil, fmt.Errorf("wrong TX. %v", err)
+	}
+	gasUsed := uint64(len(code)) * deployGasPerByte
+	if gasUsed > tx.GasLimit {
+		return nil, fmt.Errorf("wrong TX. Deploying %d bytes of code uses %d gas, above the limit %d", len(code), gasUsed, tx.GasLimit)
+	}
+
+	hash, err := tx.Hash()
+	if err != nil {
+		return nil, err
+	}
+	account := ContractAccount(hash)
+	if _, exists := s.contracts[account]; exists {
+		return nil, fmt.Errorf("wrong TX. Contract %s already deployed", account.Hex())
+	}
+
+	if err := s.payFee(tx); err != nil {
+		return nil, err
+	}
+
+	s.contracts[account] = &Contract{Creator: tx.From, Code: hex.EncodeToString(code), Storage: make(map[uint64]uint64)}
+	return &Execution{Contract: account, GasUsed: gasUsed}, nil
+}
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// counterContract adds its argument to storage key 0, reverting above 100,
+// and returns the new count.
+const counterContract = `
+	PUSH 0
+	ARG
+	PUSH 0
+	LOAD
+	ADD
+	DUP
+	PUSH 100
+	GT
+	PUSH fail
+	JUMPI
+	DUP
+	PUSH 0
+	STORE
+	PUSH 1
+	RETURN
+fail:
+	REVERT
+`
+
+func TestContracts(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := Account(crypto.PubkeyToAddress(key.PublicKey))
+	miner := NewAccount("0x03")
+
+	state := newTestChainState(t, genesis{
+		Consensus: &ConsensusConfig{Engine: EngineInstant},
+		Balances:  map[Account]Amount{alice: 100000},
+	})
+
+	code, err := Assemble(counterContract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deploy := signTestTx(t, TX{From: alice, To: alice, Data: hex.EncodeToString(code), Fee: 1000, GasLimit: 1000, Time: 0, Type: TxTypeContractDeploy}, key)
+	deployHash, _ := deploy.Hash()
+	contract := ContractAccount(deployHash)
+
+	call := func(args string, time uint64) SignedTx {
+		return signTestTx(t, TX{From: alice, To: contract, Data: args, Fee: 500, GasLimit: 500, Time: time, Type: TxTypeContractCall}, key)
+	}
+	first, second := call("40", 1), call("2", 2)
+	parent, err := state.AddBlock(NewBlock(Hash{}, 0, 0, 0, miner, []SignedTx{deploy, first, second}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deployed, ok := state.GetContract(contract); !ok || deployed.Creator != alice || deployed.Storage[0] != 42 {
+		t.Fatalf("expected the contract deployed with a count of 42, got %+v", deployed)
+	}
+
+	receipt := getTestReceipt(t, state, second)
+	if receipt.Status != ReceiptStatusSuccess || !reflect.DeepEqual(receipt.Return, []uint64{42}) || receipt.GasUsed == 0 || *receipt.Contract != contract {
+		t.Fatalf("expected the receipt to hold the execution, got %+v", receipt)
+	}
+	if receipt := getTestReceipt(t, state, deploy); *receipt.Contract != contract || receipt.GasUsed != uint64(len(code))*deployGasPerByte {
+		t.Fatalf("expected the deploy receipt to hold the contract, got %+v", receipt)
+	}
+
+	for name, tx := range map[string]SignedTx{
+		"a call to no contract":     signTestTx(t, TX{From: alice, To: alice, Data: "1", Fee: 100, GasLimit: 100, Time: 3, Type: TxTypeContractCall}, key),
+		"a call with value":         signTestTx(t, TX{From: alice, To: contract, Value: 1, Data: "1", Fee: 100, GasLimit: 100, Time: 3, Type: TxTypeContractCall}, key),
+		"a fee below the gas limit": signTestTx(t, TX{From: alice, To: contract, Data: "1", Fee: 99, GasLimit: 100, Time: 3, Type: TxTypeContractCall}, key),
+		"a gas limit above the max": signTestTx(t, TX{From: alice, To: contract, Data: "1", Fee: MaxGasLimit + 1, GasLimit: MaxGasLimit + 1, Time: 3, Type: TxTypeContractCall}, key),
+		"wrong arguments":           call("one", 3),
+		"wrong code":                signTestTx(t, TX{From: alice, To: alice, Data: "ff", Fee: 1000, GasLimit: 1000, Time: 3, Type: TxTypeContractDeploy}, key),
+		"a transfer with gas":       signTestTx(t, TX{From: alice, To: contract, Value: 1, GasLimit: 100, Time: 3}, key),
+	} {
+		if _, err := state.AddBlock(NewBlock(parent, 1, 1, 0, miner, []SignedTx{tx})); err == nil {
+			t.Fatalf("expected a block with %s to be rejected", name)
+		}
+	}
+
+	// failed calls are mined, they pay their fee and store nothing
+	reverted, outOfGas := call("60", 3), signTestTx(t, TX{From: alice, To: contract, Data: "1", Fee: 5, GasLimit: 5, Time: 4, Type: TxTypeContractCall}, key)
+	balance := state.Balances[alice]
+	if _, err := state.AddBlock(NewBlock(parent, 1, 1, 0, miner, []SignedTx{reverted, outOfGas})); err != nil {
+		t.Fatal(err)
+	}
+	if state.Balances[alice] != balance-505 {
+		t.Fatalf("expected the failed calls to pay 505, got %d", balance-state.Balances[alice])
+	}
+	if deployed, _ := state.GetContract(contract); deployed.Storage[0] != 42 {
+		t.Fatalf("expected the failed calls to store nothing, got %v", deployed.Storage)
+	}
+	for _, tx := range []SignedTx{reverted, outOfGas} {
+		if receipt := getTestReceipt(t, state, tx); receipt.Status != ReceiptStatusFailed || receipt.Error == "" {
+			t.Fatalf("expected a failed receipt, got %+v", receipt)
+		}
+	}
+
+	// the contracts survive a restart and snapshots
+	snapshot, err := state.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifySnapshot(state.dataDir, snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	state.Close()
+	state, err = NewStateFromDisk(state.dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	if deployed, _ := state.GetContract(contract); deployed.Storage[0] != 42 || deployed.Code != hex.EncodeToString(code) {
+		t.Fatalf("expected the contract reloaded, got %+v", deployed)
+	}
+}
+
+func getTestReceipt(t *testing.T, state *State, tx SignedTx) Receipt {
+	hash, err := tx.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	receipt, ok := state.GetReceipt(hash)
+	if !ok {
+		t.Fatalf("no receipt for TX %x", hash)
+	}
+	return receipt
+}
@@ -0,0 +1,144 @@
+package database
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+const ExportFormatJSON = "json"
+const ExportFormatGzip = "gzip"
+
+const exportVersion = 1
+
+// ExportHeader is the first line of a chain export, one block JSON per line
+// follows it.
+type ExportHeader struct {
+	Version int    `json:"version"`
+	From    uint64 `json:"from"`
+	To      uint64 `json:"to"`
+}
+
+// ImportProgress tells how far an import went, blocks the chain already had
+// are skipped.
+type ImportProgress struct {
+	Header   ExportHeader `json:"header"`
+	Imported int          `json:"imported"`
+	Skipped  int          `json:"skipped"`
+	Number   uint64       `json:"number"`
+}
+
+// Export writes the blocks from..to (inclusive) in the given format.
+func (s *State) Export(w io.Writer, from uint64, to uint64, format string) error {
+	if !s.hasGenesisBlock {
+		return fmt.Errorf("can't export a chain without blocks")
+	}
+	if to > s.latestBlock.Header.Number {
+		to = s.latestBlock.Header.Number
+	}
+	if from > to {
+		return fmt.Errorf("nothing to export from block %d to %d", from, to)
+	}
+
+	var gz *gzip.Writer
+	switch format {
+	case ExportFormatJSON:
+	case ExportFormatGzip:
+		gz = gzip.NewWriter(w)
+		w = gz
+	default:
+		return fmt.Errorf("unknown export format '%s', expected %s or %s", format, ExportFormatJSON, ExportFormatGzip)
+	}
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(ExportHeader{exportVersion, from, to}); err != nil {
+		return err
+	}
+
+	for number := from; number <= to; number++ {
+		blockFS, err := s.GetBlockByNumber(number)
+		if err != nil {
+			return err
+		}
+		if blockFS.Pruned {
+			return errPruned(number, s.PrunedBelow())
+		}
+		if err := encoder.Encode(blockFS.Block); err != nil {
+			return err
+		}
+	}
+
+	if gz != nil {
+		return gz.Close()
+	}
+	return nil
+}
+
+// Import adds the exported blocks through AddBlock, so each is validated and
+// persisted on its own. The blocks the chain already has are only compared,
+// an interrupted import resumes by importing the same export again. progress
+// is called after each block.
+func (s *State) Import(r io.Reader, progress func(ImportProgress)) (ImportProgress, error) {
+	reader := bufio.NewReader(r)
+
+	// gzip streams start with the magic bytes 1f 8b
+	if magic, err := reader.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return ImportProgress{}, err
+		}
+		defer gz.Close()
+		reader = bufio.NewReader(gz)
+	}
+
+	decoder := json.NewDecoder(reader)
+
+	var result ImportProgress
+	if err := decoder.Decode(&result.Header); err != nil {
+		return result, fmt.Errorf("invalid export header: %v", err)
+	}
+	if result.Header.Version != exportVersion {
+		return result, fmt.Errorf("unsupported export version %d", result.Header.Version)
+	}
+
+	for {
+		var block Block
+		err := decoder.Decode(&block)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return result, fmt.Errorf("invalid block after block %d: %v", result.Number, err)
+		}
+
+		hash, err := block.Hash()
+		if err != nil {
+			return result, err
+		}
+
+		if s.hasGenesisBlock && block.Header.Number <= s.latestBlock.Header.Number {
+			existing, err := s.GetBlockByNumber(block.Header.Number)
+			if err != nil {
+				return result, err
+			}
+			if existing.BlockHash != hash {
+				return result, fmt.Errorf("block %d is '%x', the chain has '%x'", block.Header.Number, hash, existing.BlockHash)
+			}
+			result.Skipped++
+		} else {
+			if _, err := s.AddBlock(block); err != nil {
+				return result, fmt.Errorf("block %d: %v", block.Header.Number, err)
+			}
+			result.Imported++
+		}
+
+		result.Number = block.Header.Number
+		if progress != nil {
+			progress(result)
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,71 @@
+package database
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestExportImport(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := Account(crypto.PubkeyToAddress(key.PublicKey))
+	bob, miner := NewAccount("0x02"), NewAccount("0x03")
+
+	g := genesis{
+		Consensus: &ConsensusConfig{Engine: EngineInstant},
+		Balances:  map[Account]Amount{alice: 1000},
+	}
+
+	source := newTestChainState(t, g)
+	var parent Hash
+	for i := uint64(0); i < 4; i++ {
+		tx := signTestTx(t, TX{From: alice, To: bob, Value: 10, Time: i}, key)
+		parent, err = source.AddBlock(NewBlock(parent, i, i, 0, miner, []SignedTx{tx}))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var partial, full bytes.Buffer
+	if err := source.Export(&partial, 0, 1, ExportFormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.Export(&full, 0, 100, ExportFormatGzip); err != nil {
+		t.Fatal(err)
+	}
+
+	target := newTestChainState(t, g)
+	if _, err := target.Import(&partial, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// importing the whole chain resumes after the blocks already imported
+	result, err := target.Import(&full, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Imported != 2 || result.Skipped != 2 || target.LatestBlockHash() != parent {
+		t.Fatalf("unexpected import %+v, tip %x", result, target.LatestBlockHash())
+	}
+	if target.Balances[bob] != 40 {
+		t.Fatalf("expected bob balance 40, got %d", target.Balances[bob])
+	}
+
+	// a chain with another block 0 doesn't accept the export
+	other := newTestChainState(t, g)
+	if _, err := other.AddBlock(NewBlock(Hash{}, 0, 100, 0, miner, nil)); err != nil {
+		t.Fatal(err)
+	}
+	var export bytes.Buffer
+	if err := source.Export(&export, 0, 0, ExportFormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Import(&export, nil); err == nil || !strings.Contains(err.Error(), "the chain has") {
+		t.Fatalf("expected a conflicting block error, got %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+package database
+
+// Forks are the heights from which new consensus rules apply. Blocks below
+// them were accepted under the older rules and are still replayed as such. A
+// rule without height never applies.
+type Forks struct {
+	// Commitments makes blocks commit to their TXs and state.
+	Commitments *uint64 `json:"commitments,omitempty"`
+	// BlockTime bounds block times by the parent's and the clock.
+	BlockTime *uint64 `json:"block_time,omitempty"`
+}
+
+// builtinForks are shipped with the binary, by genesis chain_id. A release
+// sets each height above the tip of the public chain.
+var builtinForks = map[string]Forks{
+	"the-blockchain-bar-ledger": {
+		Commitments: forkHeight(1000),
+		BlockTime:   forkHeight(1000),
+	},
+}
+
+func forkHeight(number uint64) *uint64 {
+	return &number
+}
+
+// forkActive tells whether the rule applies to the block at the given height.
+func forkActive(fork *uint64, number uint64) bool {
+	return fork != nil && number >= *fork
+}
+
+// loadForks merges the built-in forks of the chain with the ones of the
+// genesis config, which take precedence.
+func loadForks(chainID string, configured *Forks) Forks {
+	forks := builtinForks[chainID]
+	if configured == nil {
+		return forks
+	}
+
+	if configured.Commitments != nil {
+		forks.Commitments = configured.Commitments
+	}
+	if configured.BlockTime != nil {
+		forks.BlockTime = configured.BlockTime
+	}
+	return forks
+}
@@ -19,6 +19,26 @@ func getBlocksDBFilePath(dataDir string) string {
 	return path.Join(getDatabaseDirPath(dataDir), "blocks.db")
 }
 
+func getHeadersDBFilePath(dataDir string) string {
+	return path.Join(getDatabaseDirPath(dataDir), "headers.db")
+}
+
+func getSnapshotsDirPath(dataDir string) string {
+	return path.Join(getDatabaseDirPath(dataDir), "snapshots")
+}
+
+func getSnapshotFilePath(dataDir string, hash Hash) string {
+	return path.Join(getSnapshotsDirPath(dataDir), hash.Hex()+".json")
+}
+
+func getIndexesDirPath(dataDir string) string {
+	return path.Join(getDatabaseDirPath(dataDir), "indexes")
+}
+
+func getIndexFilePath(dataDir string, name string) string {
+	return path.Join(getIndexesDirPath(dataDir), name+".db")
+}
+
 func fileExists(path string) bool {
 	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
 		return false
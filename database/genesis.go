@@ -9,13 +9,29 @@ var genesisJSON = `
 {
   "genesis_time": "2019-03-18T00:00:00.000000000Z",
   "chain_id": "the-blockchain-bar-ledger",
+  "denomination": {
+    "symbol": "TBB",
+    "unit": "bar",
+    "decimals": 2
+  },
   "balances": {
     "0xf57913DB69e172c0aD5018Fb0CEBf63308B2B8D7": 1000000
   }
 }`
 
 type genesis struct {
-	Balances map[Account]uint `json:"balances"`
+	ChainID      string             `json:"chain_id"`
+	Denomination *Denomination      `json:"denomination,omitempty"`
+	Consensus    *ConsensusConfig   `json:"consensus,omitempty"`
+	Balances     map[Account]Amount `json:"balances"`
+	// Checkpoints are added to the built-in ones of the chain.
+	Checkpoints Checkpoints `json:"checkpoints,omitempty"`
+	// Forks override the built-in fork heights of the chain.
+	Forks *Forks `json:"forks,omitempty"`
+
+	engine      Engine
+	checkpoints Checkpoints
+	forks       Forks
 }
 
 func loadGenesis(path string) (genesis, error) {
@@ -28,6 +44,28 @@ func loadGenesis(path string) (genesis, error) {
 	if err := json.Unmarshal(contents, &loadedGenesis); err != nil {
 		return genesis{}, err
 	}
+
+	if loadedGenesis.Denomination == nil {
+		denomination := DefaultDenomination
+		loadedGenesis.Denomination = &denomination
+	}
+
+	if loadedGenesis.Consensus == nil {
+		loadedGenesis.Consensus = &ConsensusConfig{Engine: EnginePoW}
+	}
+
+	loadedGenesis.engine, err = newEngine(*loadedGenesis.Consensus)
+	if err != nil {
+		return genesis{}, err
+	}
+
+	loadedGenesis.checkpoints, err = loadCheckpoints(loadedGenesis.ChainID, loadedGenesis.Checkpoints)
+	if err != nil {
+		return genesis{}, err
+	}
+
+	loadedGenesis.forks = loadForks(loadedGenesis.ChainID, loadedGenesis.Forks)
+
 	return loadedGenesis, nil
 }
 
@@ -3,7 +3,6 @@ package database
 import (
 	"bytes"
 	"encoding/hex"
-	"fmt"
 )
 
 type Hash [32]byte
@@ -27,7 +26,3 @@ func (h Hash) IsEmpty() bool {
 	emptyHash := Hash{}
 	return bytes.Equal(h[:], emptyHash[:])
 }
-
-func (h Hash) IsBlockHashValid() bool {
-	return fmt.Sprintf("%x", h[:3]) == "000000" && fmt.Sprintf("%x", h[3]) != "0"
-}
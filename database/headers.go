@@ -0,0 +1,330 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// HeaderChain is the chain of a light node: block headers only, checked with
+// the consensus engine and the checkpoints like full blocks. Balances and TX
+// inclusion are proven by full nodes against the header commitments.
+// headers.db has the blocks.db record format, every record pruned.
+type HeaderChain struct {
+	mu sync.RWMutex
+
+	// state follows the engine part of the chain only, e.g. the PoA signer
+	// set, its balances are meaningless
+	state     *State
+	headers   []BlockFS
+	positions map[Hash]uint64
+}
+
+func NewHeaderChainFromDisk(dir string) (*HeaderChain, error) {
+	if err := initDataDirIfNotExists(dir); err != nil {
+		return nil, err
+	}
+
+	genesis, err := loadGenesis(getGenesisJSONFilePath(dir))
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(getHeadersDBFilePath(dir), os.O_CREATE|os.O_APPEND|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &HeaderChain{
+		state:     newGenesisState(dir, genesis, f),
+		headers:   []BlockFS{},
+		positions: make(map[Hash]uint64),
+	}
+
+	// the stored headers were verified before being written, a bad record
+	// and the ones after it are synced again
+	truncateAt := int64(-1)
+	err = scanBlockRecords(f, func(record blockRecord) (bool, error) {
+		err := record.Err
+		if err == nil {
+			err = c.link(record.BlockFS.Block.Header, record.BlockFS.BlockHash)
+		}
+		if err == nil {
+			err = c.state.engine.Finalize(c.state, record.BlockFS.Block)
+		}
+		if err != nil {
+			fmt.Printf("Truncating headers.db at offset %d, the headers from there are synced again: %v\n", record.Offset, err)
+			truncateAt = record.Offset
+			return false, nil
+		}
+
+		c.add(record.BlockFS)
+		return true, nil
+	})
+	if err == nil && truncateAt >= 0 {
+		if err = f.Truncate(truncateAt); err == nil {
+			err = f.Sync()
+		}
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// link checks the header extends the chain.
+func (c *HeaderChain) link(header BlockHeader, hash Hash) error {
+	next := uint64(len(c.headers))
+	if header.Number != next {
+		return fmt.Errorf("expected header %d, got %d", next, header.Number)
+	}
+	if next == 0 && !header.Parent.IsEmpty() {
+		return fmt.Errorf("genesis header has parent %x", header.Parent)
+	}
+	if next > 0 && header.Parent != c.headers[next-1].BlockHash {
+		return fmt.Errorf("header %d parent %x isn't the previous header %x", next, header.Parent, c.headers[next-1].BlockHash)
+	}
+
+	var parent *BlockHeader
+	if next > 0 {
+		parent = &c.headers[next-1].Block.Header
+	}
+	if err := verifyBlockTime(c.state.forks, parent, header); err != nil {
+		return err
+	}
+	if forkActive(c.state.forks.Commitments, header.Number) && (header.TxRoot == nil || header.StateRoot == nil) {
+		return fmt.Errorf("header %d doesn't commit to its TXs and state", header.Number)
+	}
+	return c.state.checkpoints.verify(header.Number, hash)
+}
+
+func (c *HeaderChain) add(blockFS BlockFS) {
+	c.positions[blockFS.BlockHash] = blockFS.Block.Header.Number
+	c.headers = append(c.headers, blockFS)
+
+	// the engine checks headers against their parent, e.g. the PoA turns
+	c.state.latestBlock = blockFS.Block
+	c.state.latestBlockHash = blockFS.BlockHash
+	c.state.hasGenesisBlock = true
+}
+
+// AddHeader verifies the block header extends the chain and stores it. A
+// block without header commitments comes with its TXs, its hash covers them,
+// they're neither validated nor stored.
+func (c *HeaderChain) AddHeader(b Block) (Hash, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if b.Header.TxRoot != nil {
+		b.TXs = nil
+	}
+
+	hash, err := b.Hash()
+	if err != nil {
+		return Hash{}, err
+	}
+
+	if err := c.link(b.Header, hash); err != nil {
+		return Hash{}, err
+	}
+
+	pendingState := c.state.copy()
+	if err := c.state.engine.VerifyHeader(pendingState, b); err != nil {
+		return Hash{}, err
+	}
+	if err := c.state.engine.Finalize(pendingState, b); err != nil {
+		return Hash{}, err
+	}
+
+	blockFS := BlockFS{BlockHash: hash, Block: Block{Header: b.Header}, Pruned: true}
+	record, err := encodeBlockFS(blockFS)
+	if err != nil {
+		return Hash{}, err
+	}
+	if _, err := c.state.persistRecord(record); err != nil {
+		return Hash{}, err
+	}
+
+	c.state.authority = pendingState.authority
+	c.add(blockFS)
+
+	return hash, nil
+}
+
+func (c *HeaderChain) Close() error {
+	return c.state.dbFile.Close()
+}
+
+// NextBlockNumber is the height of the next header to add.
+func (c *HeaderChain) NextBlockNumber() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return uint64(len(c.headers))
+}
+
+// LatestBlock returns the latest header as a block without TXs.
+func (c *HeaderChain) LatestBlock() Block {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if len(c.headers) == 0 {
+		return Block{}
+	}
+	return c.headers[len(c.headers)-1].Block
+}
+
+func (c *HeaderChain) LatestBlockHash() Hash {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if len(c.headers) == 0 {
+		return Hash{}
+	}
+	return c.headers[len(c.headers)-1].BlockHash
+}
+
+// LatestCommitted returns the latest header committing to its state, balance
+// proofs are asked for its height.
+func (c *HeaderChain) LatestCommitted() (BlockFS, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for i := len(c.headers) - 1; i >= 0; i-- {
+		if c.headers[i].Block.Header.StateRoot != nil {
+			return c.headers[i], true
+		}
+	}
+	return BlockFS{}, false
+}
+
+// GetBlockByNumber returns the header at the given height, without TXs.
+func (c *HeaderChain) GetBlockByNumber(number uint64) (BlockFS, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if number >= uint64(len(c.headers)) {
+		return BlockFS{}, fmt.Errorf("%w %d", ErrUnknownBlock, number)
+	}
+	return c.headers[number], nil
+}
+
+// GetBlockByHash returns the header with the given hash, without TXs.
+func (c *HeaderChain) GetBlockByHash(hash Hash) (BlockFS, error) {
+	c.mu.RLock()
+	number, ok := c.positions[hash]
+	c.mu.RUnlock()
+
+	if !ok {
+		return BlockFS{}, fmt.Errorf("%w %x", ErrUnknownBlock, hash)
+	}
+	return c.GetBlockByNumber(number)
+}
+
+// ResolveBlockNumber turns a block reference, either a height or a block
+// hash in hex, into a block height.
+func (c *HeaderChain) ResolveBlockNumber(ref string) (uint64, error) {
+	if number, err := strconv.ParseUint(ref, 10, 64); err == nil && len(ref) < 2*len(Hash{}) {
+		return number, nil
+	}
+
+	hash := Hash{}
+	if err := hash.UnmarshalText([]byte(ref)); err != nil {
+		return 0, fmt.Errorf("'%s' is neither a block height nor a block hash", ref)
+	}
+
+	header, err := c.GetBlockByHash(hash)
+	if err != nil {
+		return 0, err
+	}
+	return header.Block.Header.Number, nil
+}
+
+func (c *HeaderChain) Denomination() Denomination {
+	return c.state.denomination
+}
+
+func (c *HeaderChain) Engine() Engine {
+	return c.state.engine
+}
+
+func (c *HeaderChain) Authority() Authority {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.state.authority.copy()
+}
+
+func (c *HeaderChain) Checkpoints() Checkpoints {
+	return c.state.checkpoints
+}
+
+// VerifyBalanceProof checks the proof is for a block of the chain and
+// against its state commitment.
+func (c *HeaderChain) VerifyBalanceProof(proof BalanceProof) error {
+	header, err := c.committedHeader(proof.Number, proof.BlockHash)
+	if err != nil {
+		return err
+	}
+	if header.StateRoot == nil {
+		return fmt.Errorf("block %d has no state commitment", proof.Number)
+	}
+	return proof.Verify(*header.StateRoot)
+}
+
+// VerifyTxProof checks the proof is for a block of the chain and against its
+// TX commitment.
+func (c *HeaderChain) VerifyTxProof(proof TxProof) error {
+	header, err := c.committedHeader(proof.BlockNumber, proof.BlockHash)
+	if err != nil {
+		return err
+	}
+	if header.TxRoot == nil {
+		return fmt.Errorf("block %d has no TX commitment", proof.BlockNumber)
+	}
+	return proof.Verify(*header.TxRoot)
+}
+
+func (c *HeaderChain) committedHeader(number uint64, hash Hash) (BlockHeader, error) {
+	header, err := c.GetBlockByNumber(number)
+	if err != nil {
+		return BlockHeader{}, err
+	}
+	if header.BlockHash != hash {
+		return BlockHeader{}, fmt.Errorf("proof is for block %x, block %d is %x", hash, number, header.BlockHash)
+	}
+	return header.Block.Header, nil
+}
+
+// GetHeadersAfter returns up to limit blocks after the given one for light
+// nodes, reduced to their header when it commits to the TXs. Older blocks
+// keep their TXs, their hash can't be checked without them.
+func (s *State) GetHeadersAfter(hash Hash, limit int) ([]Block, error) {
+	from := uint64(0)
+	if !hash.IsEmpty() {
+		location, ok := s.locationByHash(hash)
+		if !ok {
+			return nil, fmt.Errorf("unknown block %x", hash)
+		}
+		from = location.Number + 1
+	}
+
+	blocks := []Block{}
+	for number := from; number < s.NextBlockNumber() && len(blocks) < limit; number++ {
+		blockFS, err := s.GetBlockByNumber(number)
+		if err != nil {
+			return nil, err
+		}
+
+		if blockFS.Block.Header.TxRoot != nil {
+			blockFS.Block.TXs = nil
+		} else if blockFS.Pruned {
+			return nil, errPruned(number, s.PrunedBelow())
+		}
+		blocks = append(blocks, blockFS.Block)
+	}
+	return blocks, nil
+}
@@ -0,0 +1,196 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// historyRecord holds the balances changed by one block. A full record holds
+// every balance instead, it's the base of a chain bootstrapped from a snapshot.
+type historyRecord struct {
+	Hash     Hash               `json:"hash"`
+	Number   uint64             `json:"number"`
+	Full     bool               `json:"full,omitempty"`
+	Balances map[Account]Amount `json:"balances"`
+}
+
+// balanceHistory keeps per-block balance diffs to answer balance queries at
+// any past block height.
+type balanceHistory struct {
+	mu sync.RWMutex
+
+	f       *os.File
+	genesis map[Account]Amount
+	records []historyRecord
+	numbers map[Hash]uint64
+}
+
+func openBalanceHistory(dataDir string, genesis map[Account]Amount) (*balanceHistory, error) {
+	f, err := openIndexFile(getIndexFilePath(dataDir, "history"))
+	if err != nil {
+		return nil, err
+	}
+
+	h := &balanceHistory{f: f, genesis: genesis}
+	h.clear()
+
+	err = readIndexFile(f, func(line []byte) error {
+		var record historyRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return err
+		}
+		return h.add(record)
+	})
+	if err != nil {
+		fmt.Printf("Rebuilding balances history: %v\n", err)
+		return h, h.reset()
+	}
+
+	return h, nil
+}
+
+func (h *balanceHistory) name() string {
+	return "history"
+}
+
+func (h *balanceHistory) lastIndexed() Hash {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if len(h.records) == 0 {
+		return Hash{}
+	}
+	return h.records[len(h.records)-1].Hash
+}
+
+func (h *balanceHistory) indexSnapshot(snapshot Snapshot) error {
+	return h.append(historyRecord{snapshot.Block.BlockHash, snapshot.Number(), true, snapshot.Balances})
+}
+
+func (h *balanceHistory) indexBlock(block indexedBlock) error {
+	return h.append(historyRecord{block.BlockHash, block.Block.Header.Number, false, block.Balances})
+}
+
+func (h *balanceHistory) reset() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.clear()
+	return truncateIndexFile(h.f)
+}
+
+func (h *balanceHistory) close() error {
+	return h.f.Close()
+}
+
+func (h *balanceHistory) clear() {
+	h.records = []historyRecord{}
+	h.numbers = make(map[Hash]uint64)
+}
+
+func (h *balanceHistory) append(record historyRecord) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := h.add(record); err != nil {
+		return err
+	}
+	return appendIndexRecord(h.f, record)
+}
+
+func (h *balanceHistory) add(record historyRecord) error {
+	if len(h.records) > 0 && !record.Full {
+		last := h.records[len(h.records)-1]
+		if record.Number != last.Number+1 {
+			return fmt.Errorf("expected history of block %d, got %d", last.Number+1, record.Number)
+		}
+	}
+
+	// a full record starts the history over
+	if record.Full {
+		h.clear()
+	}
+
+	h.records = append(h.records, record)
+	h.numbers[record.Hash] = record.Number
+	return nil
+}
+
+// position returns the index of the block's record in h.records.
+func (h *balanceHistory) position(number uint64) (int, error) {
+	if len(h.records) == 0 {
+		return 0, fmt.Errorf("no balances history")
+	}
+
+	first, last := h.records[0].Number, h.records[len(h.records)-1].Number
+	if number < first || number > last {
+		return 0, fmt.Errorf("balances history is only available from block %d to %d", first, last)
+	}
+	return int(number - first), nil
+}
+
+func (h *balanceHistory) balanceAt(account Account, number uint64) (Amount, Hash, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	pos, err := h.position(number)
+	if err != nil {
+		return 0, Hash{}, err
+	}
+
+	for i := pos; i >= 0; i-- {
+		if balance, ok := h.records[i].Balances[account]; ok || h.records[i].Full {
+			return balance, h.records[pos].Hash, nil
+		}
+	}
+	return h.genesis[account], h.records[pos].Hash, nil
+}
+
+func (h *balanceHistory) balancesAt(number uint64) (map[Account]Amount, Hash, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	pos, err := h.position(number)
+	if err != nil {
+		return nil, Hash{}, err
+	}
+
+	base := h.genesis
+	if h.records[0].Full {
+		base = h.records[0].Balances
+	}
+
+	balances := make(map[Account]Amount, len(base))
+	for account, balance := range base {
+		balances[account] = balance
+	}
+
+	for i := 0; i <= pos; i++ {
+		for account, balance := range h.records[i].Balances {
+			balances[account] = balance
+		}
+	}
+	return balances, h.records[pos].Hash, nil
+}
+
+func (h *balanceHistory) blockNumber(hash Hash) (uint64, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	number, ok := h.numbers[hash]
+	return number, ok
+}
+
+// BalanceAt returns the account balance right after the block at the given
+// height was applied, together with the block hash.
+func (s *State) BalanceAt(account Account, number uint64) (Amount, Hash, error) {
+	return s.indexes.history.balanceAt(account, number)
+}
+
+// BalancesAt returns every balance right after the block at the given height
+// was applied, together with the block hash.
+func (s *State) BalancesAt(number uint64) (map[Account]Amount, Hash, error) {
+	return s.indexes.history.balancesAt(number)
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestBalanceHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tbb-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	alice, bob := NewAccount("0x01"), NewAccount("0x02")
+
+	h, err := openBalanceHistory(dir, map[Account]Amount{alice: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := []historyRecord{
+		{Hash{1}, 0, false, map[Account]Amount{alice: 60, bob: 40}},
+		{Hash{2}, 1, false, map[Account]Amount{bob: 45}},
+	}
+	for _, record := range records {
+		if err := h.append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h.close()
+
+	// reopen to check the history is read back from disk
+	h, err = openBalanceHistory(dir, map[Account]Amount{alice: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.close()
+
+	if balance, _, err := h.balanceAt(alice, 1); err != nil || balance != 60 {
+		t.Fatalf("expected alice balance 60 at block 1, got %d (%v)", balance, err)
+	}
+
+	balances, hash, err := h.balancesAt(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != (Hash{2}) || balances[alice] != 60 || balances[bob] != 45 {
+		t.Fatalf("unexpected balances %v at %x", balances, hash)
+	}
+
+	if _, _, err := h.balancesAt(2); err == nil {
+		t.Fatal("expected error for a block beyond the history")
+	}
+
+	if err := h.append(historyRecord{Hash{4}, 5, false, nil}); err == nil {
+		t.Fatal("expected error for a gap in the history")
+	}
+}
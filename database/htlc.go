@@ -0,0 +1,182 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// The HTLC TX types escrow value under a hash lock until a timeout: the
+// recipient claims it with the hash preimage before the timeout, the sender
+// refunds it from the timeout on. The escrow is identified by the hash of
+// the lock TX.
+const (
+	TxTypeHTLCLock   TxType = "htlc_lock"
+	TxTypeHTLCClaim  TxType = "htlc_claim"
+	TxTypeHTLCRefund TxType = "htlc_refund"
+)
+
+const maxPreimageSize = 64
+
+const (
+	EscrowStatusOpen     = "open"
+	EscrowStatusClaimed  = "claimed"
+	EscrowStatusRefunded = "refunded"
+)
+
+// HTLC holds the parameters of the HTLC TXs: a lock sets HashLock and
+// Timeout, a claim sets Escrow and Preimage, a refund sets Escrow.
+type HTLC struct {
+	HashLock *Hash `json:"hash_lock,omitempty"`
+	// Timeout is a block height or a Unix time, see LockTimeThreshold.
+	Timeout uint64 `json:"timeout,omitempty"`
+	Escrow  *Hash  `json:"escrow,omitempty"`
+	// Preimage is hex encoded.
+	Preimage string `json:"preimage,omitempty"`
+}
+
+// Escrow is the value locked by an HTLC lock TX. Settled escrows are kept,
+// the claim reveals the preimage the sender needs on the other chain of a
+// swap.
+type Escrow struct {
+	Sender    Account `json:"sender"`
+	Recipient Account `json:"recipient"`
+	Value     Amount  `json:"value"`
+	Asset     string  `json:"asset,omitempty"`
+	HashLock  Hash    `json:"hash_lock"`
+	Timeout   uint64  `json:"timeout"`
+	Status    string  `json:"status"`
+	Preimage  string  `json:"preimage,omitempty"`
+}
+
+// NewHashLock returns the hash lock of the preimage.
+func NewHashLock(preimage []byte) Hash {
+	return sha256.Sum256(preimage)
+}
+
+// GetEscrow returns the escrow locked by the TX with the given hash.
+func (s *State) GetEscrow(id Hash) (Escrow, bool) {
+	escrow, ok := s.escrows[id]
+	return escrow, ok
+}
+
+func (s *State) applyHTLC(tx SignedTx, header BlockHeader) error {
+	if tx.HTLC == nil {
+		return fmt.Errorf("wrong TX. %s TX without HTLC parameters", tx.Type)
+	}
+
+	switch tx.Type {
+	case TxTypeHTLCLock:
+		return s.lockEscrow(tx, header)
+	case TxTypeHTLCClaim, TxTypeHTLCRefund:
+		return s.settleEscrow(tx, header)
+	}
+	return fmt.Errorf("wrong TX. Unknown type '%s'", tx.Type)
+}
+
+func (s *State) lockEscrow(tx SignedTx, header BlockHeader) error {
+	htlc := tx.HTLC
+	if htlc.HashLock == nil || htlc.Timeout == 0 || htlc.Escrow != nil || htlc.Preimage != "" {
+		return fmt.Errorf("wrong TX. HTLC lock needs a hash lock and a timeout only")
+	}
+	if tx.Value == 0 {
+		return fmt.Errorf("wrong TX. HTLC lock of no value")
+	}
+	if lockReached(htlc.Timeout, header) {
+		return fmt.Errorf("wrong TX. HTLC timeout %d already reached at block %d", htlc.Timeout, header.Number)
+	}
+
+	id, err := tx.Hash()
+	if err != nil {
+		return err
+	}
+	if _, exists := s.escrows[id]; exists {
+		return fmt.Errorf("wrong TX. Escrow %x already exists", id)
+	}
+
+	if err := s.chargeTx(tx); err != nil {
+		return err
+	}
+
+	s.escrows[id] = Escrow{
+		Sender:    tx.From,
+		Recipient: tx.To,
+		Value:     tx.Value,
+		Asset:     tx.Asset,
+		HashLock:  *htlc.HashLock,
+		Timeout:   htlc.Timeout,
+		Status:    EscrowStatusOpen,
+	}
+	return nil
+}
+
+// settleEscrow pays the escrow out to the TX sender, the recipient claiming
+// it or the sender refunding it.
+func (s *State) settleEscrow(tx SignedTx, header BlockHeader) error {
+	htlc := tx.HTLC
+	if htlc.Escrow == nil || htlc.HashLock != nil || htlc.Timeout != 0 {
+		return fmt.Errorf("wrong TX. HTLC %s needs the escrow", tx.Type)
+	}
+	if tx.Value != 0 || tx.Asset != "" || tx.To != tx.From {
+		return fmt.Errorf("wrong TX. HTLC %s pays the escrow to its sender, it can't carry value", tx.Type)
+	}
+
+	escrow, ok := s.escrows[*htlc.Escrow]
+	if !ok {
+		return fmt.Errorf("wrong TX. Unknown escrow %x", *htlc.Escrow)
+	}
+	if escrow.Status != EscrowStatusOpen {
+		return fmt.Errorf("wrong TX. Escrow %x is %s", *htlc.Escrow, escrow.Status)
+	}
+
+	if tx.Type == TxTypeHTLCClaim {
+		if tx.From != escrow.Recipient {
+			return fmt.Errorf("wrong TX. Escrow %x can only be claimed by %s", *htlc.Escrow, escrow.Recipient.Hex())
+		}
+		if lockReached(escrow.Timeout, header) {
+			return fmt.Errorf("wrong TX. Escrow %x timed out at %d", *htlc.Escrow, escrow.Timeout)
+		}
+
+		preimage, err := hex.DecodeString(htlc.Preimage)
+		if err != nil || len(preimage) == 0 || len(preimage) > maxPreimageSize {
+			return fmt.Errorf("wrong TX. HTLC preimage must be 1 to %d hex encoded bytes", maxPreimageSize)
+		}
+		if NewHashLock(preimage) != escrow.HashLock {
+			return fmt.Errorf("wrong TX. Preimage doesn't match the hash lock of escrow %x", *htlc.Escrow)
+		}
+
+		escrow.Status = EscrowStatusClaimed
+		escrow.Preimage = hex.EncodeToString(preimage)
+	} else {
+		if htlc.Preimage != "" {
+			return fmt.Errorf("wrong TX. HTLC refund can't carry a preimage")
+		}
+		if tx.From != escrow.Sender {
+			return fmt.Errorf("wrong TX. Escrow %x can only be refunded to %s", *htlc.Escrow, escrow.Sender.Hex())
+		}
+		if !lockReached(escrow.Timeout, header) {
+			return fmt.Errorf("wrong TX. Escrow %x can't be refunded before %d", *htlc.Escrow, escrow.Timeout)
+		}
+
+		escrow.Status = EscrowStatusRefunded
+	}
+
+	// the fee can be paid out of a native escrow
+	if err := s.creditAsset(tx.From, escrow.Asset, escrow.Value); err != nil {
+		return err
+	}
+	if err := s.payFee(tx); err != nil {
+		return err
+	}
+
+	s.escrows[*htlc.Escrow] = escrow
+	return nil
+}
+
+func copyEscrows(escrows map[Hash]Escrow) map[Hash]Escrow {
+	cp := make(map[Hash]Escrow, len(escrows))
+	for id, escrow := range escrows {
+		cp[id] = escrow
+	}
+	return cp
+}
@@ -0,0 +1,121 @@
+package database
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestHTLC(t *testing.T) {
+	aliceKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := Account(crypto.PubkeyToAddress(aliceKey.PublicKey))
+	bob := Account(crypto.PubkeyToAddress(bobKey.PublicKey))
+	miner := NewAccount("0x03")
+
+	state := newTestChainState(t, genesis{
+		Consensus: &ConsensusConfig{Engine: EngineInstant},
+		Balances:  map[Account]Amount{alice: 1000},
+	})
+
+	preimage := []byte("swap secret")
+	hashLock := NewHashLock(preimage)
+
+	// two escrows timing out at block 3, one claimed and one refunded
+	lock := func(value Amount, time uint64) SignedTx {
+		return signTestTx(t, TX{From: alice, To: bob, Value: value, Fee: 1, Time: time, Type: TxTypeHTLCLock, HTLC: &HTLC{HashLock: &hashLock, Timeout: 3}}, aliceKey)
+	}
+	claimed, refunded := lock(100, 0), lock(200, 1)
+	parent, err := state.AddBlock(NewBlock(Hash{}, 0, 0, 0, miner, []SignedTx{claimed, refunded}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Balances[alice] != 698 {
+		t.Fatalf("expected alice to lock 300 and pay 2 fees, got %d", state.Balances[alice])
+	}
+
+	claimedID, _ := claimed.Hash()
+	refundedID, _ := refunded.Hash()
+	settle := func(key *ecdsa.PrivateKey, from Account, txType TxType, id Hash, preimage []byte, time uint64) SignedTx {
+		htlc := &HTLC{Escrow: &id}
+		if preimage != nil {
+			htlc.Preimage = hex.EncodeToString(preimage)
+		}
+		return signTestTx(t, TX{From: from, To: from, Fee: 1, Time: time, Type: txType, HTLC: htlc}, key)
+	}
+
+	for name, tx := range map[string]SignedTx{
+		"a wrong preimage":         settle(bobKey, bob, TxTypeHTLCClaim, claimedID, []byte("guess"), 2),
+		"the sender claiming":      settle(aliceKey, alice, TxTypeHTLCClaim, claimedID, preimage, 2),
+		"a refund before timeout":  settle(aliceKey, alice, TxTypeHTLCRefund, refundedID, nil, 2),
+		"an unknown escrow":        settle(bobKey, bob, TxTypeHTLCClaim, Hash{1}, preimage, 2),
+		"a lock without hash lock": signTestTx(t, TX{From: alice, To: bob, Value: 1, Time: 2, Type: TxTypeHTLCLock, HTLC: &HTLC{Timeout: 5}}, aliceKey),
+		"an expired lock":          signTestTx(t, TX{From: alice, To: bob, Value: 1, Time: 2, Type: TxTypeHTLCLock, HTLC: &HTLC{HashLock: &hashLock, Timeout: 1}}, aliceKey),
+	} {
+		if _, err := state.AddBlock(NewBlock(parent, 1, 1, 0, miner, []SignedTx{tx})); err == nil {
+			t.Fatalf("expected a block with %s to be rejected", name)
+		}
+	}
+
+	// bob pays the claim fee out of the escrow
+	claim := settle(bobKey, bob, TxTypeHTLCClaim, claimedID, preimage, 2)
+	if parent, err = state.AddBlock(NewBlock(parent, 1, 1, 0, miner, []SignedTx{claim})); err != nil {
+		t.Fatal(err)
+	}
+	if state.Balances[bob] != 99 {
+		t.Fatalf("expected bob to claim 100 minus the fee, got %d", state.Balances[bob])
+	}
+	escrow, ok := state.GetEscrow(claimedID)
+	if !ok || escrow.Status != EscrowStatusClaimed || escrow.Preimage != hex.EncodeToString(preimage) {
+		t.Fatalf("expected the escrow claimed with the preimage revealed, got %+v", escrow)
+	}
+
+	if _, err := state.AddBlock(NewBlock(parent, 2, 2, 0, miner, []SignedTx{settle(bobKey, bob, TxTypeHTLCClaim, claimedID, preimage, 3)})); err == nil {
+		t.Fatal("expected a second claim to be rejected")
+	}
+	if parent, err = state.AddBlock(NewBlock(parent, 2, 2, 0, miner, nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	// from the timeout on the other escrow can't be claimed but refunded
+	if _, err := state.AddBlock(NewBlock(parent, 3, 3, 0, miner, []SignedTx{settle(bobKey, bob, TxTypeHTLCClaim, refundedID, preimage, 3)})); err == nil {
+		t.Fatal("expected a claim after the timeout to be rejected")
+	}
+	if _, err := state.AddBlock(NewBlock(parent, 3, 3, 0, miner, []SignedTx{settle(aliceKey, alice, TxTypeHTLCRefund, refundedID, nil, 3)})); err != nil {
+		t.Fatal(err)
+	}
+	if state.Balances[alice] != 897 {
+		t.Fatalf("expected alice refunded 200 minus the fee, got %d", state.Balances[alice])
+	}
+
+	// the escrows survive a restart and snapshots
+	snapshot, err := state.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot.Escrows) != 2 {
+		t.Fatalf("expected the snapshot to hold 2 escrows, got %+v", snapshot.Escrows)
+	}
+	if err := VerifySnapshot(state.dataDir, snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	state.Close()
+	state, err = NewStateFromDisk(state.dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	if escrow, ok := state.GetEscrow(refundedID); !ok || escrow.Status != EscrowStatusRefunded {
+		t.Fatalf("expected the refunded escrow reloaded, got %+v", escrow)
+	}
+}
@@ -0,0 +1,179 @@
+package database
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// blockIndex is a secondary index stored next to blocks.db. AddBlock feeds it
+// every new block, and it's rebuilt from blocks.db on startup whenever its last
+// indexed block isn't the chain tip (new index, crash, repaired blocks.db...).
+type blockIndex interface {
+	name() string
+	lastIndexed() Hash
+	// indexSnapshot is called when the indexes start from a snapshot instead
+	// of genesis: the chain was bootstrapped from it, or the blocks before it
+	// were pruned.
+	indexSnapshot(snapshot Snapshot) error
+	indexBlock(block indexedBlock) error
+	reset() error
+	close() error
+}
+
+// indexedBlock is a block together with the effects of applying it.
+type indexedBlock struct {
+	BlockFS
+	// Balances after the block of every account the block touched.
+	Balances map[Account]Amount
+	Receipts []Receipt
+}
+
+func newIndexedBlock(blockFS BlockFS, balances map[Account]Amount, receipts []Receipt) indexedBlock {
+	touched := make(map[Account]Amount)
+	for _, account := range blockAccounts(blockFS.Block) {
+		touched[account] = balances[account]
+	}
+	return indexedBlock{blockFS, touched, receipts}
+}
+
+// blockAccounts lists the accounts whose balance a block may change.
+func blockAccounts(b Block) []Account {
+	accounts := []Account{b.Header.Miner}
+	for _, tx := range b.TXs {
+		accounts = append(accounts, tx.From, tx.To)
+	}
+	return accounts
+}
+
+type chainIndexes struct {
+	history  *balanceHistory
+	txs      *txIndex
+	accounts *addrIndex
+	receipts *receiptIndex
+}
+
+func openIndexes(dataDir string, genesis genesis) (*chainIndexes, error) {
+	history, err := openBalanceHistory(dataDir, genesis.Balances)
+	if err != nil {
+		return nil, err
+	}
+
+	txs, err := openTxIndex(dataDir)
+	if err != nil {
+		history.close()
+		return nil, err
+	}
+
+	accounts, err := openAddrIndex(dataDir)
+	if err != nil {
+		history.close()
+		txs.close()
+		return nil, err
+	}
+
+	receipts, err := openReceiptIndex(dataDir)
+	if err != nil {
+		history.close()
+		txs.close()
+		accounts.close()
+		return nil, err
+	}
+
+	return &chainIndexes{history, txs, accounts, receipts}, nil
+}
+
+func (c *chainIndexes) all() []blockIndex {
+	return []blockIndex{c.history, c.txs, c.accounts, c.receipts}
+}
+
+// DropIndexes deletes every index of the data dir, they're rebuilt from
+// blocks.db the next time the state is loaded.
+func DropIndexes(dataDir string) error {
+	return os.RemoveAll(getIndexesDirPath(dataDir))
+}
+
+func (c *chainIndexes) close() error {
+	for _, index := range c.all() {
+		if err := index.close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func staleIndexes(indexes []blockIndex, tip Hash) []blockIndex {
+	stale := []blockIndex{}
+	for _, index := range indexes {
+		if index.lastIndexed() != tip {
+			stale = append(stale, index)
+		}
+	}
+	return stale
+}
+
+func (s *State) indexBlock(indexes []blockIndex, blockFS BlockFS, balances map[Account]Amount, receipts []Receipt) error {
+	if len(indexes) == 0 {
+		return nil
+	}
+
+	block := newIndexedBlock(blockFS, balances, receipts)
+	for _, index := range indexes {
+		if err := index.indexBlock(block); err != nil {
+			return fmt.Errorf("%s index: %v", index.name(), err)
+		}
+	}
+	return nil
+}
+
+func openIndexFile(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(path, os.O_APPEND|os.O_RDWR|os.O_CREATE, 0600)
+}
+
+// readIndexFile decodes an index file line by line. Any error, including a
+// torn last line, makes the caller reset and rebuild the index.
+func readIndexFile(f *os.File, fn func(line []byte) error) error {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) == 0 && errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+}
+
+func appendIndexRecord(f *os.File, record interface{}) error {
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(append(recordJSON, '\n'))
+	return err
+}
+
+func truncateIndexFile(f *os.File) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err := f.Seek(0, io.SeekStart)
+	return err
+}
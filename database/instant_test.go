@@ -0,0 +1,101 @@
+package database
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func signTestTx(t *testing.T, tx TX, key *ecdsa.PrivateKey) SignedTx {
+	txEncoded, err := tx.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign, err := crypto.Sign(crypto.Keccak256(txEncoded), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return SignedTx{TX: tx, Sign: sign}
+}
+
+func TestInstantSealAddBlock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tbb-instant")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := Account(crypto.PubkeyToAddress(key.PublicKey))
+	bob, miner := NewAccount("0x02"), NewAccount("0x03")
+
+	genesisJSON, err := json.Marshal(genesis{
+		Consensus: &ConsensusConfig{Engine: EngineInstant},
+		Balances:  map[Account]Amount{alice: 1000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(getDatabaseDirPath(dir), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(getGenesisJSONFilePath(dir), genesisJSON, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeEmptyBlocksDBToDisk(getBlocksDBFilePath(dir)); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := NewStateFromDisk(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := signTestTx(t, TX{From: alice, To: bob, Value: 100, Fee: 5, Time: 1}, key)
+	block, err := state.Seal(context.Background(), NewBlock(Hash{}, 0, 1, 0, miner, []SignedTx{tx}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := state.AddBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[Account]Amount{alice: 895, bob: 100, miner: BlockReward + 5}
+	for account, balance := range expected {
+		if state.Balances[account] != balance {
+			t.Fatalf("expected %s balance %d, got %d", account.Hex(), balance, state.Balances[account])
+		}
+	}
+
+	txHash, err := tx.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	receipt, ok := state.GetReceipt(txHash)
+	if !ok || receipt.Status != ReceiptStatusSuccess || receipt.Fee != 5 || receipt.Balances[alice] != 895 {
+		t.Fatalf("unexpected receipt %+v", receipt)
+	}
+	state.Close()
+
+	// reloading replays blocks.db through the engine
+	state, err = NewStateFromDisk(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	for account, balance := range expected {
+		if state.Balances[account] != balance {
+			t.Fatalf("expected %s balance %d after reload, got %d", account.Hex(), balance, state.Balances[account])
+		}
+	}
+}
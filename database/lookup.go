@@ -0,0 +1,171 @@
+package database
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// ErrUnknownBlock is returned for a block height or hash the chain doesn't
+// have.
+var ErrUnknownBlock = errors.New("unknown block")
+
+// blockLocation is where a block is stored in blocks.db.
+type blockLocation struct {
+	Offset int64
+	Hash   Hash
+	Number uint64
+	Pruned bool
+}
+
+func newBlockLocation(record blockRecord) blockLocation {
+	return blockLocation{record.Offset, record.BlockFS.BlockHash, record.BlockFS.Block.Header.Number, record.BlockFS.Pruned}
+}
+
+// blockLocator finds blocks in blocks.db by height or by hash without
+// scanning the whole file. It's built in memory while loading the state.
+type blockLocator struct {
+	locationsMu sync.RWMutex
+	locations   []blockLocation
+	positions   map[Hash]int
+	// prunedBelow is the height of the oldest block with its TXs
+	prunedBelow uint64
+}
+
+func (l *blockLocator) setBlockLocations(locations []blockLocation) {
+	l.locationsMu.Lock()
+	defer l.locationsMu.Unlock()
+
+	l.locations = locations
+	l.positions = make(map[Hash]int, len(locations))
+	for i, location := range locations {
+		l.positions[location.Hash] = i
+	}
+	l.prunedBelow = prunedHeight(locations)
+}
+
+// prunedHeight returns the height of the oldest block with its TXs, 0 when
+// nothing was pruned.
+func prunedHeight(locations []blockLocation) uint64 {
+	prunedBelow := uint64(0)
+	for _, location := range locations {
+		if location.Pruned {
+			prunedBelow = location.Number + 1
+		}
+	}
+	return prunedBelow
+}
+
+// PrunedBelow is the height of the oldest block whose TXs blocks.db still
+// has, 0 when nothing was pruned.
+func (l *blockLocator) PrunedBelow() uint64 {
+	l.locationsMu.RLock()
+	defer l.locationsMu.RUnlock()
+
+	return l.prunedBelow
+}
+
+func (l *blockLocator) addBlockLocation(location blockLocation) {
+	l.locationsMu.Lock()
+	defer l.locationsMu.Unlock()
+
+	if l.positions == nil {
+		l.positions = make(map[Hash]int)
+	}
+	l.positions[location.Hash] = len(l.locations)
+	l.locations = append(l.locations, location)
+}
+
+func (l *blockLocator) locationByNumber(number uint64) (blockLocation, bool) {
+	l.locationsMu.RLock()
+	defer l.locationsMu.RUnlock()
+
+	if len(l.locations) == 0 || number < l.locations[0].Number {
+		return blockLocation{}, false
+	}
+
+	pos := number - l.locations[0].Number
+	if pos >= uint64(len(l.locations)) {
+		return blockLocation{}, false
+	}
+	return l.locations[pos], true
+}
+
+func (l *blockLocator) locationByHash(hash Hash) (blockLocation, bool) {
+	l.locationsMu.RLock()
+	defer l.locationsMu.RUnlock()
+
+	pos, ok := l.positions[hash]
+	if !ok {
+		return blockLocation{}, false
+	}
+	return l.locations[pos], true
+}
+
+// GetBlockByNumber reads the block at the given height from blocks.db.
+func (s *State) GetBlockByNumber(number uint64) (BlockFS, error) {
+	s.dbMu.RLock()
+	defer s.dbMu.RUnlock()
+
+	location, ok := s.locationByNumber(number)
+	if !ok {
+		return BlockFS{}, fmt.Errorf("%w %d", ErrUnknownBlock, number)
+	}
+	return s.readBlockFS(location.Offset)
+}
+
+// GetBlockByHash reads the block with the given hash from blocks.db.
+func (s *State) GetBlockByHash(hash Hash) (BlockFS, error) {
+	s.dbMu.RLock()
+	defer s.dbMu.RUnlock()
+
+	location, ok := s.locationByHash(hash)
+	if !ok {
+		return BlockFS{}, fmt.Errorf("%w %x", ErrUnknownBlock, hash)
+	}
+	return s.readBlockFS(location.Offset)
+}
+
+// readBlockFS reads the record at the offset, the caller holds dbMu.
+func (s *State) readBlockFS(offset int64) (BlockFS, error) {
+	return readBlockRecord(s.dbFile, offset)
+}
+
+func readBlockRecord(f *os.File, offset int64) (BlockFS, error) {
+	reader := bufio.NewReader(io.NewSectionReader(f, offset, math.MaxInt64-offset))
+
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		return BlockFS{}, err
+	}
+	return decodeBlockFS(line)
+}
+
+// ResolveBlockNumber turns a block reference, either a height or a block
+// hash in hex, into a block height.
+func (s *State) ResolveBlockNumber(ref string) (uint64, error) {
+	if number, err := strconv.ParseUint(ref, 10, 64); err == nil && len(ref) < 2*len(Hash{}) {
+		return number, nil
+	}
+
+	hash := Hash{}
+	if err := hash.UnmarshalText([]byte(ref)); err != nil {
+		return 0, fmt.Errorf("'%s' is neither a block height nor a block hash", ref)
+	}
+
+	if location, ok := s.locationByHash(hash); ok {
+		return location.Number, nil
+	}
+
+	// the block a node was bootstrapped from is only known by the history
+	if number, ok := s.indexes.history.blockNumber(hash); ok {
+		return number, nil
+	}
+
+	return 0, fmt.Errorf("unknown block hash %x", hash)
+}
@@ -0,0 +1,131 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+// prefixes keep a leaf from passing for an inner node, and the root from
+// passing for either
+const (
+	merkleLeafPrefix = 0x00
+	merkleNodePrefix = 0x01
+	merkleRootPrefix = 0x02
+)
+
+// MerkleProof is the path from a leaf to the root of a tree of Size leaves.
+// Pairs are hashed level by level, the last node of an odd level moves up
+// unpaired, so Index and Size tell on which side each Path hash goes.
+type MerkleProof struct {
+	Index uint64 `json:"index"`
+	Size  uint64 `json:"size"`
+	Path  []Hash `json:"path"`
+}
+
+func merkleLeaf(data []byte) Hash {
+	return sha256.Sum256(append([]byte{merkleLeafPrefix}, data...))
+}
+
+func merkleNode(left Hash, right Hash) Hash {
+	data := make([]byte, 0, 1+2*len(Hash{}))
+	data = append(data, merkleNodePrefix)
+	data = append(data, left[:]...)
+	data = append(data, right[:]...)
+	return sha256.Sum256(data)
+}
+
+// merkleRoot commits to the leaves and to their number, a proof can't claim
+// another tree size.
+func merkleRoot(leaves []Hash) Hash {
+	top := Hash{}
+	if len(leaves) > 0 {
+		level := leaves
+		for len(level) > 1 {
+			level = merkleLevelUp(level)
+		}
+		top = level[0]
+	}
+	return merkleSizedRoot(uint64(len(leaves)), top)
+}
+
+func merkleSizedRoot(size uint64, top Hash) Hash {
+	var sizeBytes [8]byte
+	binary.BigEndian.PutUint64(sizeBytes[:], size)
+
+	data := make([]byte, 0, 1+len(sizeBytes)+len(Hash{}))
+	data = append(data, merkleRootPrefix)
+	data = append(data, sizeBytes[:]...)
+	data = append(data, top[:]...)
+	return sha256.Sum256(data)
+}
+
+func merkleLevelUp(level []Hash) []Hash {
+	up := make([]Hash, 0, (len(level)+1)/2)
+	for i := 0; i < len(level); i += 2 {
+		if i+1 == len(level) {
+			up = append(up, level[i])
+			continue
+		}
+		up = append(up, merkleNode(level[i], level[i+1]))
+	}
+	return up
+}
+
+func newMerkleProof(leaves []Hash, index int) MerkleProof {
+	proof := MerkleProof{Index: uint64(index), Size: uint64(len(leaves)), Path: []Hash{}}
+
+	level := leaves
+	for len(level) > 1 {
+		sibling := index ^ 1
+		if sibling < len(level) {
+			proof.Path = append(proof.Path, level[sibling])
+		}
+		level = merkleLevelUp(level)
+		index /= 2
+	}
+	return proof
+}
+
+// Root computes the root of the tree the proof puts the leaf in.
+func (p MerkleProof) Root(leaf Hash) (Hash, error) {
+	if p.Index >= p.Size {
+		return Hash{}, fmt.Errorf("proof index %d is out of a tree of %d leaves", p.Index, p.Size)
+	}
+
+	node, index, size := leaf, p.Index, p.Size
+	path := p.Path
+	for size > 1 {
+		sibling := index ^ 1
+		if sibling < size {
+			if len(path) == 0 {
+				return Hash{}, fmt.Errorf("proof path is too short")
+			}
+			if index%2 == 0 {
+				node = merkleNode(node, path[0])
+			} else {
+				node = merkleNode(path[0], node)
+			}
+			path = path[1:]
+		}
+		index /= 2
+		size = (size + 1) / 2
+	}
+	if len(path) > 0 {
+		return Hash{}, fmt.Errorf("proof path is too long")
+	}
+
+	return merkleSizedRoot(p.Size, node), nil
+}
+
+// verify checks the proof puts the leaf in the tree with the given root.
+func (p MerkleProof) verify(root Hash, leaf Hash) error {
+	computed, err := p.Root(leaf)
+	if err != nil {
+		return err
+	}
+	if computed != root {
+		return fmt.Errorf("proof leads to root %x, expected %x", computed, root)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package database
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// MaxMultisigSigners bounds the signatures a multisig TX can carry.
+const MaxMultisigSigners = 16
+
+// PubKey is a compressed secp256k1 public key, 0x prefixed hex in JSON.
+type PubKey = hexutil.Bytes
+
+// NewPubKey compresses the public key.
+func NewPubKey(pubkey ecdsa.PublicKey) PubKey {
+	return crypto.CompressPubkey(&pubkey)
+}
+
+// Multisig defines an M-of-N account: a TX from it needs the signatures of
+// Threshold distinct holders of PubKeys. The account address is derived from
+// the definition and TXs carry it, so accounts need no registration.
+type Multisig struct {
+	Threshold int      `json:"threshold"`
+	PubKeys   []PubKey `json:"pubkeys"`
+}
+
+// NewMultisig sorts the public keys, the same set and threshold always give
+// the same account.
+func NewMultisig(threshold int, pubkeys []PubKey) (Multisig, error) {
+	sorted := append([]PubKey{}, pubkeys...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i], sorted[j]) < 0
+	})
+
+	m := Multisig{Threshold: threshold, PubKeys: sorted}
+	return m, m.Validate()
+}
+
+// Validate checks the definition is canonical: distinct valid public keys in
+// order.
+func (m Multisig) Validate() error {
+	if len(m.PubKeys) == 0 || len(m.PubKeys) > MaxMultisigSigners {
+		return fmt.Errorf("multisig needs 1 to %d signers, got %d", MaxMultisigSigners, len(m.PubKeys))
+	}
+	if m.Threshold < 1 || m.Threshold > len(m.PubKeys) {
+		return fmt.Errorf("multisig threshold must be between 1 and %d, got %d", len(m.PubKeys), m.Threshold)
+	}
+	for i, pubkey := range m.PubKeys {
+		if _, err := crypto.DecompressPubkey(pubkey); err != nil {
+			return fmt.Errorf("multisig public key %s: %v", pubkey, err)
+		}
+		if i > 0 && bytes.Compare(m.PubKeys[i-1], pubkey) >= 0 {
+			return fmt.Errorf("multisig public keys must be distinct and sorted")
+		}
+	}
+	return nil
+}
+
+// Account is the address of the multisig account.
+func (m Multisig) Account() Account {
+	data := append([]byte("multisig"), byte(m.Threshold))
+	for _, pubkey := range m.PubKeys {
+		data = append(data, pubkey...)
+	}
+	return Account(common.BytesToAddress(crypto.Keccak256(data)[12:]))
+}
+
+// Signers returns the accounts of the public keys, the definition must be
+// valid.
+func (m Multisig) Signers() []Account {
+	signers := make([]Account, 0, len(m.PubKeys))
+	for _, pubkey := range m.PubKeys {
+		if key, err := crypto.DecompressPubkey(pubkey); err == nil {
+			signers = append(signers, Account(crypto.PubkeyToAddress(*key)))
+		}
+	}
+	return signers
+}
+
+func (m Multisig) IsSigner(pubkey ecdsa.PublicKey) bool {
+	compressed := NewPubKey(pubkey)
+	for _, signer := range m.PubKeys {
+		if bytes.Equal(signer, compressed) {
+			return true
+		}
+	}
+	return false
+}
+
+// MultisigSigners returns who signed the multisig TX so far. Every signature
+// must be from a distinct signer of the account.
+func (t *SignedTx) MultisigSigners() ([]Account, error) {
+	if t.Multisig == nil {
+		return nil, fmt.Errorf("TX isn't from a multisig account")
+	}
+	if len(t.Signs) > len(t.Multisig.PubKeys) {
+		return nil, fmt.Errorf("%d signatures for %d signers", len(t.Signs), len(t.Multisig.PubKeys))
+	}
+
+	txEncoded, err := t.TX.Encode()
+	if err != nil {
+		return nil, err
+	}
+	hash := crypto.Keccak256(txEncoded)
+
+	signers := make([]Account, 0, len(t.Signs))
+	for i, sign := range t.Signs {
+		pubkey, err := crypto.SigToPub(hash, sign)
+		if err != nil {
+			return nil, fmt.Errorf("signature %d: %v", i, err)
+		}
+
+		signer := Account(crypto.PubkeyToAddress(*pubkey))
+		if !t.Multisig.IsSigner(*pubkey) {
+			return nil, fmt.Errorf("signature %d is from %s, not a signer", i, signer.Hex())
+		}
+		for _, s := range signers {
+			if s == signer {
+				return nil, fmt.Errorf("%s signed twice", signer.Hex())
+			}
+		}
+		signers = append(signers, signer)
+	}
+	return signers, nil
+}
+
+func (t *SignedTx) verifyMultisig() error {
+	if err := t.Multisig.Validate(); err != nil {
+		return fmt.Errorf("wrong TX. %v", err)
+	}
+	if account := t.Multisig.Account(); account != t.From {
+		return fmt.Errorf("wrong TX. Sender %s isn't the multisig account %s", t.From.Hex(), account.Hex())
+	}
+	if len(t.Sign) > 0 {
+		return fmt.Errorf("wrong TX. Multisig TX can't carry a single signature")
+	}
+
+	signers, err := t.MultisigSigners()
+	if err != nil {
+		return fmt.Errorf("wrong TX. %v", err)
+	}
+	if len(signers) < t.Multisig.Threshold {
+		return fmt.Errorf("wrong TX. Sender %s needs %d signatures, got %d", t.From.Hex(), t.Multisig.Threshold, len(signers))
+	}
+	return nil
+}
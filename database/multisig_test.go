@@ -0,0 +1,112 @@
+package database
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func coSignTestTx(t *testing.T, tx SignedTx, keys ...*ecdsa.PrivateKey) SignedTx {
+	for _, key := range keys {
+		tx.Signs = append(tx.Signs, signTestTx(t, tx.TX, key).Sign)
+	}
+	return tx
+}
+
+func TestMultisig(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 3)
+	pubkeys := make([]PubKey, 3)
+	for i := range keys {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = key
+		pubkeys[i] = NewPubKey(key.PublicKey)
+	}
+
+	multisig, err := NewMultisig(2, pubkeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reordered, err := NewMultisig(2, []PubKey{pubkeys[2], pubkeys[0], pubkeys[1]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if multisig.Account() != reordered.Account() {
+		t.Fatal("expected the account not to depend on the signers order")
+	}
+	if other, _ := NewMultisig(3, pubkeys); other.Account() == multisig.Account() {
+		t.Fatal("expected the account to depend on the threshold")
+	}
+	if signers := multisig.Signers(); len(signers) != 3 || !multisig.IsSigner(keys[1].PublicKey) {
+		t.Fatalf("expected the 3 signers to be derived from the public keys, got %v", signers)
+	}
+
+	for _, invalid := range []struct {
+		threshold int
+		pubkeys   []PubKey
+	}{
+		{0, pubkeys},
+		{4, pubkeys},
+		{1, nil},
+		{1, []PubKey{pubkeys[0], pubkeys[0]}},
+		{1, []PubKey{pubkeys[0][1:]}},
+	} {
+		if _, err := NewMultisig(invalid.threshold, invalid.pubkeys); err == nil {
+			t.Fatalf("expected %d of %v to be invalid", invalid.threshold, invalid.pubkeys)
+		}
+	}
+
+	account, bob, miner := multisig.Account(), NewAccount("0x02"), NewAccount("0x03")
+	tx := SignedTx{TX: TX{From: account, To: bob, Value: 100, Time: 0}, Multisig: &multisig}
+
+	outsider, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsorted := multisig
+	unsorted.PubKeys = []PubKey{multisig.PubKeys[2], multisig.PubKeys[1], multisig.PubKeys[0]}
+	wrongFrom := coSignTestTx(t, tx, keys[0], keys[1])
+	wrongFrom.From = bob
+	bothSigns := coSignTestTx(t, tx, keys[0], keys[1])
+	bothSigns.Sign = bothSigns.Signs[0]
+
+	for name, invalid := range map[string]SignedTx{
+		"below threshold":      coSignTestTx(t, tx, keys[0]),
+		"duplicate signer":     coSignTestTx(t, tx, keys[0], keys[0]),
+		"non-signer":           coSignTestTx(t, tx, keys[0], outsider),
+		"wrong sender":         wrongFrom,
+		"unsorted signers":     coSignTestTx(t, SignedTx{TX: tx.TX, Multisig: &unsorted}, keys[0], keys[1]),
+		"single signature":     signTestTx(t, tx.TX, keys[0]),
+		"without multisig":     coSignTestTx(t, SignedTx{TX: tx.TX}, keys[0], keys[1]),
+		"single signature too": bothSigns,
+	} {
+		if isAuth, err := invalid.IsAuthentic(); isAuth && err == nil {
+			t.Fatalf("expected a multisig TX with %s to be rejected", name)
+		}
+	}
+
+	state := newTestChainState(t, genesis{
+		Consensus: &ConsensusConfig{Engine: EngineInstant},
+		Balances:  map[Account]Amount{account: 1000},
+	})
+
+	signedTx := coSignTestTx(t, tx, keys[2], keys[0])
+	if isAuth, err := signedTx.IsAuthentic(); !isAuth || err != nil {
+		t.Fatalf("expected a TX with 2 of 3 signatures to be authentic: %v", err)
+	}
+
+	block, err := state.Seal(context.Background(), NewBlock(Hash{}, 0, 0, 0, miner, []SignedTx{signedTx}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := state.AddBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	if state.Balances[account] != 900 || state.Balances[bob] != 100 {
+		t.Fatalf("expected the multisig account to pay bob 100, got %d and %d", state.Balances[account], state.Balances[bob])
+	}
+}
@@ -0,0 +1,304 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ErrNotInTurn is returned by PoA Seal when another signer has to seal the
+// block, ErrUnauthorizedSigner when the node's signer isn't in the signer set.
+var ErrNotInTurn = errors.New("not in turn to seal the block")
+var ErrUnauthorizedSigner = errors.New("not an authorised signer")
+
+// OutOfTurnDelaySecs is how long after its parent a signer out of turn may
+// seal a block, per turn it is away from the in-turn signer. An offline
+// signer only slows the chain down: the next signers seal in its place, in
+// order, and can vote it out.
+const OutOfTurnDelaySecs = 30
+
+// SignerFn signs the seal hash of a block with the signer's key.
+type SignerFn func(hash Hash) ([]byte, error)
+
+// Vote is a signer's proposal, carried in a block header, to authorise or
+// remove a PoA signer.
+type Vote struct {
+	Account   Account `json:"account"`
+	Authorize bool    `json:"authorize"`
+}
+
+// Authority is the PoA signer set and the pending votes to change it. A
+// proposal passes once more than half the signers voted for it.
+type Authority struct {
+	Signers []Account `json:"signers"`
+	// Votes maps each proposed account to the votes of the signers.
+	Votes map[Account]map[Account]bool `json:"votes,omitempty"`
+}
+
+func newAuthority(signers []Account) Authority {
+	return Authority{Signers: append([]Account{}, signers...), Votes: make(map[Account]map[Account]bool)}
+}
+
+func (a Authority) copy() Authority {
+	cp := newAuthority(a.Signers)
+	for account, votes := range a.Votes {
+		cp.Votes[account] = make(map[Account]bool, len(votes))
+		for signer, authorize := range votes {
+			cp.Votes[account][signer] = authorize
+		}
+	}
+	return cp
+}
+
+func (a Authority) IsSigner(account Account) bool {
+	for _, signer := range a.Signers {
+		if signer == account {
+			return true
+		}
+	}
+	return false
+}
+
+// InTurn returns the signer whose turn it is to seal the block at the given
+// height, signers take turns in the order of the set.
+func (a Authority) InTurn(number uint64) Account {
+	return a.Signers[number%uint64(len(a.Signers))]
+}
+
+// turnDistance returns how many turns the signer comes after the in-turn
+// signer of the block at the given height, 0 when it's in turn.
+func (a Authority) turnDistance(signer Account, number uint64) uint64 {
+	n := uint64(len(a.Signers))
+	for i, s := range a.Signers {
+		if s == signer {
+			return (uint64(i) + n - number%n) % n
+		}
+	}
+	return n
+}
+
+// checkTurn checks the signer may seal the block on top of the state, right
+// away when in turn and otherwise once the out-of-turn delay has passed.
+func (a Authority) checkTurn(state *State, signer Account, header BlockHeader) error {
+	distance := a.turnDistance(signer, header.Number)
+	if distance == 0 {
+		return nil
+	}
+
+	var parentTime uint64
+	if state.hasGenesisBlock {
+		parentTime = state.latestBlock.Header.Time
+	}
+	if earliest := parentTime + distance*OutOfTurnDelaySecs; header.Time < earliest {
+		return fmt.Errorf("%w: block %d is for %s, %s may seal it out of turn from time %d", ErrNotInTurn, header.Number, a.InTurn(header.Number).Hex(), signer.Hex(), earliest)
+	}
+	return nil
+}
+
+func (a Authority) validateVote(vote Vote) error {
+	switch {
+	case vote.Account == Account{}:
+		return fmt.Errorf("vote for an empty account")
+	case vote.Authorize && a.IsSigner(vote.Account):
+		return fmt.Errorf("vote to authorise %s, already a signer", vote.Account.Hex())
+	case !vote.Authorize && !a.IsSigner(vote.Account):
+		return fmt.Errorf("vote to remove %s, not a signer", vote.Account.Hex())
+	case !vote.Authorize && len(a.Signers) == 1:
+		return fmt.Errorf("vote to remove %s, the last signer", vote.Account.Hex())
+	}
+	return nil
+}
+
+// cast records the vote of a signer and applies the proposal once it has a
+// majority.
+func (a *Authority) cast(signer Account, vote Vote) {
+	if a.Votes == nil {
+		a.Votes = make(map[Account]map[Account]bool)
+	}
+	if a.Votes[vote.Account] == nil {
+		a.Votes[vote.Account] = make(map[Account]bool)
+	}
+	a.Votes[vote.Account][signer] = vote.Authorize
+
+	tally := 0
+	for _, authorize := range a.Votes[vote.Account] {
+		if authorize == vote.Authorize {
+			tally++
+		}
+	}
+	if tally <= len(a.Signers)/2 {
+		return
+	}
+
+	delete(a.Votes, vote.Account)
+	if vote.Authorize {
+		a.Signers = append(a.Signers, vote.Account)
+		return
+	}
+
+	signers := make([]Account, 0, len(a.Signers)-1)
+	for _, s := range a.Signers {
+		if s != vote.Account {
+			signers = append(signers, s)
+		}
+	}
+	a.Signers = signers
+
+	// a removed signer's votes don't count anymore
+	for account, votes := range a.Votes {
+		delete(votes, vote.Account)
+		if len(votes) == 0 {
+			delete(a.Votes, account)
+		}
+	}
+}
+
+// Authority returns the PoA signer set and pending votes.
+func (s *State) Authority() Authority {
+	return s.authority.copy()
+}
+
+// PoA is the proof-of-authority engine: the signers listed in genesis take
+// turns signing blocks, and vote to change the signer set. When the in-turn
+// signer is late the others seal after a delay growing with their distance to
+// the turn.
+type PoA struct {
+	mu sync.RWMutex
+
+	signer Account
+	sign   SignerFn
+}
+
+func NewPoA() *PoA {
+	return &PoA{}
+}
+
+// Authorize sets the account and key the node seals blocks with.
+func (e *PoA) Authorize(signer Account, sign SignerFn) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.signer = signer
+	e.sign = sign
+}
+
+func (e *PoA) Name() string {
+	return EnginePoA
+}
+
+// Prepare sets the node's signer as the block miner, it gets the reward.
+func (e *PoA) Prepare(_ *State, header *BlockHeader) error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.sign == nil {
+		return fmt.Errorf("no signer key, this node can't seal blocks")
+	}
+	header.Nonce = 0
+	header.Miner = e.signer
+	return nil
+}
+
+func (e *PoA) Seal(_ context.Context, state *State, b Block) (Block, error) {
+	e.mu.RLock()
+	signer, sign := e.signer, e.sign
+	e.mu.RUnlock()
+
+	if sign == nil {
+		return Block{}, fmt.Errorf("no signer key, this node can't seal blocks")
+	}
+	if b.Header.Miner != signer {
+		return Block{}, fmt.Errorf("block miner %s isn't the signer %s", b.Header.Miner.Hex(), signer.Hex())
+	}
+	if !state.authority.IsSigner(signer) {
+		return Block{}, fmt.Errorf("%w: %s", ErrUnauthorizedSigner, signer.Hex())
+	}
+	if err := state.authority.checkTurn(state, signer, b.Header); err != nil {
+		return Block{}, err
+	}
+	if b.Header.Vote != nil {
+		if err := state.authority.validateVote(*b.Header.Vote); err != nil {
+			return Block{}, err
+		}
+	}
+
+	hash, err := sealHash(b)
+	if err != nil {
+		return Block{}, err
+	}
+
+	b.Header.Signature, err = sign(hash)
+	if err != nil {
+		return Block{}, err
+	}
+
+	fmt.Printf("Sealed new Block using PoA, height %d, signer %s\n", b.Header.Number, signer.Hex())
+	return b, nil
+}
+
+func (e *PoA) VerifySeal(b Block) error {
+	signer, err := blockSigner(b)
+	if err != nil {
+		return err
+	}
+	if signer != b.Header.Miner {
+		return fmt.Errorf("block %d is signed by %s, not its miner %s", b.Header.Number, signer.Hex(), b.Header.Miner.Hex())
+	}
+	return nil
+}
+
+func (e *PoA) VerifyHeader(state *State, b Block) error {
+	if err := e.VerifySeal(b); err != nil {
+		return err
+	}
+
+	signer := b.Header.Miner
+	if !state.authority.IsSigner(signer) {
+		return fmt.Errorf("block %d signer %s: %w", b.Header.Number, signer.Hex(), ErrUnauthorizedSigner)
+	}
+	if err := state.authority.checkTurn(state, signer, b.Header); err != nil {
+		return err
+	}
+
+	if b.Header.Vote != nil {
+		return state.authority.validateVote(*b.Header.Vote)
+	}
+	return nil
+}
+
+func (e *PoA) Finalize(state *State, b Block) error {
+	if err := accumulateRewards(state, b); err != nil {
+		return err
+	}
+
+	if b.Header.Vote != nil {
+		state.authority.cast(b.Header.Miner, *b.Header.Vote)
+	}
+	return nil
+}
+
+// sealHash is the hash a PoA signer signs, the block hash without signature.
+func sealHash(b Block) (Hash, error) {
+	b.Header.Signature = nil
+	return b.Hash()
+}
+
+func blockSigner(b Block) (Account, error) {
+	if len(b.Header.Signature) == 0 {
+		return Account{}, fmt.Errorf("block %d isn't signed", b.Header.Number)
+	}
+
+	hash, err := sealHash(b)
+	if err != nil {
+		return Account{}, err
+	}
+
+	pubkey, err := crypto.SigToPub(crypto.Keccak256(hash[:]), b.Header.Signature)
+	if err != nil {
+		return Account{}, fmt.Errorf("invalid block %d signature: %v", b.Header.Number, err)
+	}
+	return Account(crypto.PubkeyToAddress(*pubkey)), nil
+}
@@ -0,0 +1,181 @@
+package database
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestAuthorityVotes(t *testing.T) {
+	alice, bob, carol := NewAccount("0x01"), NewAccount("0x02"), NewAccount("0x03")
+
+	authority := newAuthority([]Account{alice, bob})
+
+	authority.cast(alice, Vote{carol, true})
+	if authority.IsSigner(carol) {
+		t.Fatal("a single vote out of 2 signers shouldn't authorise carol")
+	}
+
+	authority.cast(bob, Vote{carol, true})
+	if !authority.IsSigner(carol) || len(authority.Votes) != 0 {
+		t.Fatalf("carol should be authorised and the votes cleared, got %+v", authority)
+	}
+
+	if authority.InTurn(2) != carol {
+		t.Fatalf("expected carol in turn at block 2, got %s", authority.InTurn(2).Hex())
+	}
+
+	authority.cast(alice, Vote{bob, false})
+	authority.cast(bob, Vote{alice, false})
+	authority.cast(carol, Vote{bob, false})
+	if authority.IsSigner(bob) {
+		t.Fatal("bob should be removed")
+	}
+	if _, ok := authority.Votes[alice][bob]; ok {
+		t.Fatal("the removed signer's votes should be dropped")
+	}
+
+	if err := authority.validateVote(Vote{alice, true}); err == nil {
+		t.Fatal("expected error authorising an existing signer")
+	}
+}
+
+func TestPoASeal(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := Account(crypto.PubkeyToAddress(key.PublicKey))
+	other := NewAccount("0x01")
+
+	engine := NewPoA()
+	engine.Authorize(signer, func(hash Hash) ([]byte, error) {
+		return crypto.Sign(crypto.Keccak256(hash[:]), key)
+	})
+
+	state := &State{engine: engine, authority: newAuthority([]Account{signer, other})}
+
+	sealed, err := engine.Seal(context.Background(), state, NewBlock(Hash{}, 0, 1, 0, signer, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.VerifyHeader(state, sealed); err != nil {
+		t.Fatalf("sealed block should be valid: %v", err)
+	}
+
+	sealed.Header.Time++
+	if err := engine.VerifySeal(sealed); err == nil {
+		t.Fatal("expected error for a block modified after sealing")
+	}
+
+	if _, err := engine.Seal(context.Background(), state, NewBlock(Hash{}, 1, 1, 0, signer, nil)); err == nil {
+		t.Fatal("expected error sealing out of turn")
+	}
+}
+
+func TestPoAVoteAddBlock(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := Account(crypto.PubkeyToAddress(key.PublicKey))
+	carol := NewAccount("0x03")
+
+	state := newTestChainState(t, genesis{
+		Consensus: &ConsensusConfig{Engine: EnginePoA, Signers: []Account{signer}},
+		Balances:  map[Account]Amount{},
+	})
+	state.Engine().(*PoA).Authorize(signer, func(hash Hash) ([]byte, error) {
+		return crypto.Sign(crypto.Keccak256(hash[:]), key)
+	})
+
+	block := NewBlock(Hash{}, 0, 1, 0, signer, nil)
+	block.Header.Vote = &Vote{carol, true}
+	sealed, err := state.Seal(context.Background(), block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := state.AddBlock(sealed); err != nil {
+		t.Fatal(err)
+	}
+
+	if !state.Authority().IsSigner(carol) {
+		t.Fatal("expected the vote of the only signer to authorise carol")
+	}
+}
+
+func TestPoAOfflineSigner(t *testing.T) {
+	keys := make(map[Account]*ecdsa.PrivateKey)
+	var signers []Account
+	for i := 0; i < 3; i++ {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		signer := Account(crypto.PubkeyToAddress(key.PublicKey))
+		keys[signer] = key
+		signers = append(signers, signer)
+	}
+	// bob, in turn for block 1, is offline
+	alice, bob, carol := signers[0], signers[1], signers[2]
+
+	state := newTestChainState(t, genesis{
+		Consensus: &ConsensusConfig{Engine: EnginePoA, Signers: signers},
+		Balances:  map[Account]Amount{},
+	})
+	sign := func(signer Account) SignerFn {
+		return func(hash Hash) ([]byte, error) {
+			return crypto.Sign(crypto.Keccak256(hash[:]), keys[signer])
+		}
+	}
+	seal := func(signer Account, time uint64, vote *Vote) (Block, error) {
+		state.Engine().(*PoA).Authorize(signer, sign(signer))
+		block := NewBlock(state.LatestBlockHash(), state.NextBlockNumber(), time, 0, signer, nil)
+		block.Header.Vote = vote
+		return state.Seal(context.Background(), block)
+	}
+	addBlock := func(signer Account, time uint64, vote *Vote) {
+		block, err := seal(signer, time, vote)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := state.AddBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	addBlock(alice, 100, nil)
+
+	// carol comes right after bob, alice after carol
+	for signer, earliest := range map[Account]uint64{carol: 100 + OutOfTurnDelaySecs, alice: 100 + 2*OutOfTurnDelaySecs} {
+		if _, err := seal(signer, earliest-1, nil); !errors.Is(err, ErrNotInTurn) {
+			t.Fatalf("expected %s not to seal block 1 before time %d, got %v", signer.Hex(), earliest, err)
+		}
+
+		// nor can it sign such a block itself
+		block := NewBlock(state.LatestBlockHash(), 1, earliest-1, 0, signer, nil)
+		hash, err := sealHash(block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if block.Header.Signature, err = sign(signer)(hash); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := state.AddBlock(block); err == nil {
+			t.Fatalf("expected a block 1 of %s before time %d to be rejected", signer.Hex(), earliest)
+		}
+	}
+
+	addBlock(carol, 100+OutOfTurnDelaySecs, nil)
+
+	// the online signers go on in turn and vote bob out
+	addBlock(carol, 131, &Vote{bob, false})
+	addBlock(alice, 132, &Vote{bob, false})
+	if authority := state.Authority(); authority.IsSigner(bob) || len(authority.Signers) != 2 {
+		t.Fatalf("expected bob voted out, got %+v", authority)
+	}
+	addBlock(alice, 133, nil)
+}
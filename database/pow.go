@@ -0,0 +1,258 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"math"
+	"math/big"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// powBatch is how many nonces a worker tries between two cancellation checks.
+const powBatch = 1 << 12
+
+// PoW is the proof-of-work engine: a block is valid when its hash starts with
+// three zero bytes, miners search the header nonce making it so. Sealing runs
+// a configurable number of workers over disjoint nonce ranges.
+type PoW struct {
+	mu sync.RWMutex
+
+	workers int
+	// hashrate of the last seal, in hashes per second
+	hashrate float64
+}
+
+func NewPoW() *PoW {
+	return &PoW{workers: runtime.NumCPU()}
+}
+
+// SetWorkers sets the number of mining goroutines, 0 means one per CPU.
+func (e *PoW) SetWorkers(workers int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	e.workers = workers
+}
+
+func (e *PoW) Workers() int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.workers
+}
+
+// Hashrate returns the hashes per second of the last seal.
+func (e *PoW) Hashrate() float64 {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.hashrate
+}
+
+func (e *PoW) Name() string {
+	return EnginePoW
+}
+
+func (e *PoW) Prepare(_ *State, header *BlockHeader) error {
+	header.Nonce = 0
+	return nil
+}
+
+func (e *PoW) Seal(ctx context.Context, _ *State, b Block) (Block, error) {
+	prefix, suffix, err := SplitOnNonce(b)
+	if err != nil {
+		return Block{}, fmt.Errorf("can't mine block: %s", err.Error())
+	}
+
+	base, err := RandomNonce()
+	if err != nil {
+		return Block{}, err
+	}
+
+	workers := e.Workers()
+	span := (uint64(math.MaxUint32) + 1) / uint64(workers)
+
+	fmt.Printf("Mining %d pending TXs with %d workers\n", len(b.TXs), workers)
+
+	searchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	start := time.Now()
+	attempts := uint64(0)
+	found := make(chan uint32, workers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(first uint32) {
+			defer wg.Done()
+			searchNonce(searchCtx, prefix, suffix, first, span, &attempts, found)
+		}(base + uint32(uint64(i)*span))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	var nonce uint32
+	solved := false
+	select {
+	case nonce = <-found:
+		solved = true
+	case <-done:
+		// every worker stopped: cancelled, or the nonce space is exhausted
+		select {
+		case nonce = <-found:
+			solved = true
+		default:
+		}
+	}
+	cancel()
+	<-done
+
+	elapsed := time.Since(start)
+	e.mu.Lock()
+	e.hashrate = float64(attempts) / elapsed.Seconds()
+	hashrate := e.hashrate
+	e.mu.Unlock()
+
+	if !solved {
+		if ctx.Err() != nil {
+			return Block{}, fmt.Errorf("stop mining after %d attempts with error: %s", attempts, ctx.Err())
+		}
+		return Block{}, fmt.Errorf("no valid nonce after %d attempts", attempts)
+	}
+
+	b.Header.Nonce = nonce
+	hash, err := b.Hash()
+	if err != nil {
+		return Block{}, fmt.Errorf("can't mine block: %s", err.Error())
+	}
+	if !hash.IsBlockHashValid() {
+		return Block{}, fmt.Errorf("mined nonce %d doesn't give a valid block hash %x", nonce, hash)
+	}
+
+	fmt.Printf("Mined new Block using PoW '%x':\n", hash)
+	fmt.Printf("\tHeight: %d\n", b.Header.Number)
+	fmt.Printf("\tNonce: %d\n", b.Header.Nonce)
+	fmt.Printf("\tCreated: %v\n", b.Header.Time)
+	fmt.Printf("\tMiner: %x\n", b.Header.Miner)
+	fmt.Printf("\tParent: %x\n", b.Header.Parent)
+	fmt.Printf("\tAttempts: %d\n", attempts)
+	fmt.Printf("\tTime mining: %s\n", elapsed)
+	fmt.Printf("\tHashrate: %.0f H/s\n", hashrate)
+
+	return b, nil
+}
+
+// SplitOnNonce serialises the block once and splits its JSON around the nonce
+// value, hashing prefix + nonce + suffix gives the block hash.
+func SplitOnNonce(b Block) ([]byte, []byte, error) {
+	b.Header.Nonce = 0
+
+	blockJSON, err := b.hashedJSON()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the header comes first in the block JSON
+	marker := []byte(`"nonce":0`)
+	i := bytes.Index(blockJSON, marker)
+	if i < 0 {
+		return nil, nil, fmt.Errorf("no nonce in the block JSON")
+	}
+
+	prefix := append([]byte{}, blockJSON[:i+len(marker)-1]...)
+	suffix := append([]byte{}, blockJSON[i+len(marker):]...)
+	return prefix, suffix, nil
+}
+
+// searchNonce tries count nonces from first, it sends the first one giving a
+// valid block hash.
+func searchNonce(ctx context.Context, prefix, suffix []byte, first uint32, count uint64, attempts *uint64, found chan<- uint32) {
+	buf := make([]byte, 0, len(prefix)+10+len(suffix))
+	nonce := first
+
+	tried, counted := uint64(0), uint64(0)
+	defer func() {
+		atomic.AddUint64(attempts, tried-counted)
+	}()
+
+	for ; tried < count; tried++ {
+		if tried%powBatch == 0 && tried > 0 {
+			atomic.AddUint64(attempts, tried-counted)
+			counted = tried
+
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+		}
+
+		buf = append(buf[:0], prefix...)
+		buf = strconv.AppendUint(buf, uint64(nonce), 10)
+		buf = append(buf, suffix...)
+
+		if Hash(sha256.Sum256(buf)).IsBlockHashValid() {
+			tried++
+			found <- nonce
+			return
+		}
+		nonce++
+	}
+}
+
+func (e *PoW) VerifySeal(b Block) error {
+	if len(b.Header.Signature) > 0 || b.Header.Vote != nil {
+		return fmt.Errorf("proof-of-work block can't be signed or carry a vote")
+	}
+
+	hash, err := b.Hash()
+	if err != nil {
+		return err
+	}
+	if !hash.IsBlockHashValid() {
+		return fmt.Errorf("invalid block hash %x", hash)
+	}
+	return nil
+}
+
+func (e *PoW) VerifyHeader(_ *State, b Block) error {
+	return e.VerifySeal(b)
+}
+
+func (e *PoW) Finalize(state *State, b Block) error {
+	return accumulateRewards(state, b)
+}
+
+// PoWTarget is the highest valid block hash. IsBlockHashValid also rejects
+// hashes whose fourth byte is zero.
+var PoWTarget = Hash{0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+// IsBlockHashValid tells whether the hash meets the PoW target: three zero
+// bytes followed by a non-zero byte.
+func (h Hash) IsBlockHashValid() bool {
+	return h[0] == 0 && h[1] == 0 && h[2] == 0 && h[3] != 0
+}
+
+func RandomNonce() (uint32, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(math.MaxUint32))
+	if err != nil {
+		return 0, err
+	}
+	return uint32(n.Int64()), nil
+}
@@ -0,0 +1,52 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSplitOnNonce(t *testing.T) {
+	tx := SignedTx{TX: TX{From: NewAccount("0x01"), To: NewAccount("0x02"), Value: 10, Data: `"nonce":0`}}
+	b := NewBlock(Hash{1}, 7, 1600000000, 0, NewAccount("0x03"), []SignedTx{tx})
+
+	prefix, suffix, err := SplitOnNonce(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, nonce := range []uint32{0, 9, 4294967295} {
+		b.Header.Nonce = nonce
+		expected, err := json.Marshal(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := string(prefix) + strconv.FormatUint(uint64(nonce), 10) + string(suffix)
+		if got != string(expected) {
+			t.Fatalf("nonce %d: expected %s, got %s", nonce, expected, got)
+		}
+	}
+}
+
+func TestPoWSealCancel(t *testing.T) {
+	engine := NewPoW()
+	engine.SetWorkers(2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// a block can still be found by luck, otherwise sealing stops with the ctx
+	b, err := engine.Seal(ctx, nil, NewBlock(Hash{}, 0, 1, 0, NewAccount("0x01"), nil))
+	if err == nil {
+		if err := engine.VerifySeal(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if engine.Hashrate() <= 0 {
+		t.Fatalf("expected a hashrate, got %f", engine.Hashrate())
+	}
+}
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"fmt"
+	"os"
+)
+
+// SetPruning makes the state drop the TXs of all but the last keep blocks
+// each time it snapshots itself, 0 keeps every block.
+func (s *State) SetPruning(keep uint64) {
+	s.pruneKeep = keep
+}
+
+// Prune snapshots the state and drops the TXs of all but the last keep
+// blocks, their headers stay in blocks.db. The pruned blocks can't be replayed
+// or served to peers anymore. It returns the number of blocks pruned.
+func (s *State) Prune(keep uint64) (int, error) {
+	if keep == 0 {
+		return 0, fmt.Errorf("at least the latest block must be kept")
+	}
+	if !s.hasGenesisBlock || s.latestBlock.Header.Number < keep {
+		return 0, nil
+	}
+
+	// the state can't be replayed through the pruned blocks anymore
+	if _, err := s.CreateSnapshot(); err != nil {
+		return 0, err
+	}
+
+	return s.pruneBodies(s.latestBlock.Header.Number + 1 - keep)
+}
+
+// pruneBodies rewrites blocks.db with the blocks below the given height
+// reduced to their header.
+func (s *State) pruneBodies(below uint64) (int, error) {
+	if below <= s.PrunedBelow() {
+		return 0, nil
+	}
+
+	path := getBlocksDBFilePath(s.dataDir)
+	tmpPath := path + ".prune"
+
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmpPath)
+	defer tmp.Close()
+
+	// readers go on with the current file while the pruned one is written
+	pruned := 0
+	err = s.forEachBlockFS(func(blockFS BlockFS) (bool, error) {
+		if blockFS.Block.Header.Number < below && !blockFS.Pruned {
+			blockFS.Block.TXs = nil
+			blockFS.Pruned = true
+			pruned++
+		}
+
+		line, err := encodeBlockFS(blockFS)
+		if err != nil {
+			return false, err
+		}
+		_, err = tmp.Write(line)
+		return err == nil, err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return 0, err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_RDWR, 0600)
+	if err != nil {
+		return 0, err
+	}
+	locations, err := recoverBlocksDB(f)
+	if err != nil {
+		f.Close()
+		return 0, err
+	}
+
+	s.dbMu.Lock()
+	s.dbFile.Close()
+	s.dbFile = f
+	s.setBlockLocations(locations)
+	s.dbMu.Unlock()
+
+	fmt.Printf("Pruned %d blocks, blocks.db keeps the TXs from block %d\n", pruned, below)
+	return pruned, nil
+}
+
+func errPruned(number uint64, prunedBelow uint64) error {
+	return fmt.Errorf("block %d is pruned, blocks.db keeps the TXs from block %d", number, prunedBelow)
+}
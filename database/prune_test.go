@@ -0,0 +1,176 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestPrune(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := Account(crypto.PubkeyToAddress(key.PublicKey))
+	bob, miner := NewAccount("0x02"), NewAccount("0x03")
+
+	state := newTestChainState(t, genesis{
+		Consensus: &ConsensusConfig{Engine: EngineInstant},
+		Balances:  map[Account]Amount{alice: 1000},
+	})
+
+	hashes := []Hash{}
+	var parent Hash
+	for i := uint64(0); i < 5; i++ {
+		tx := signTestTx(t, TX{From: alice, To: bob, Value: 10, Time: i}, key)
+		parent, err = state.AddBlock(NewBlock(parent, i, i, 0, miner, []SignedTx{tx}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, parent)
+	}
+
+	pruned, err := state.Prune(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned != 3 || state.PrunedBelow() != 3 {
+		t.Fatalf("expected blocks 0-2 pruned, got %d pruned below %d", pruned, state.PrunedBelow())
+	}
+
+	blockFS, err := state.GetBlockByNumber(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !blockFS.Pruned || blockFS.BlockHash != hashes[1] || len(blockFS.Block.TXs) != 0 {
+		t.Fatalf("expected block 1 reduced to its header, got %+v", blockFS)
+	}
+
+	if _, err := state.GetBlocksAfter(hashes[0]); err == nil {
+		t.Fatal("expected pruned blocks not to be served")
+	}
+	blocks, err := state.GetBlocksAfter(hashes[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 2 || len(blocks[0].TXs) != 1 {
+		t.Fatalf("expected blocks 3 and 4 with their TXs, got %v", blocks)
+	}
+
+	// the chain keeps growing and reloads from the snapshot taken by Prune
+	tx := signTestTx(t, TX{From: alice, To: bob, Value: 10, Time: 5}, key)
+	if _, err := state.AddBlock(NewBlock(parent, 5, 5, 0, miner, []SignedTx{tx})); err != nil {
+		t.Fatal(err)
+	}
+	state.Close()
+
+	state, err = NewStateFromDisk(state.dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state.Balances[bob] != 60 || state.LatestBlock().Header.Number != 5 || state.PrunedBelow() != 3 {
+		t.Fatalf("unexpected state after reload: bob %d at block %d", state.Balances[bob], state.LatestBlock().Header.Number)
+	}
+	state.Close()
+
+	// an index missing the last block, e.g. after a crash, is rebuilt from
+	// the snapshot taken by Prune as the pruned blocks can't be replayed
+	if err := os.Remove(getIndexFilePath(state.dataDir, "receipts")); err != nil {
+		t.Fatal(err)
+	}
+	state, err = NewStateFromDisk(state.dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	txHash, err := tx.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := state.GetReceipt(txHash); !ok || state.Balances[bob] != 60 {
+		t.Fatalf("expected the receipt of block 5 to be indexed again and bob balance 60, got %d", state.Balances[bob])
+	}
+}
+
+func TestPruneWhileReading(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := Account(crypto.PubkeyToAddress(key.PublicKey))
+	bob, miner := NewAccount("0x02"), NewAccount("0x03")
+
+	state := newTestChainState(t, genesis{
+		Consensus: &ConsensusConfig{Engine: EngineInstant},
+		Balances:  map[Account]Amount{alice: 1000000},
+	})
+	defer state.Close()
+	state.SetPruning(10)
+
+	var mu sync.Mutex
+	hashes := []Hash{}
+
+	// explorer and peer requests read blocks while AddBlock prunes
+	stop := make(chan struct{})
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			mu.Lock()
+			known := append([]Hash{}, hashes...)
+			mu.Unlock()
+			if len(known) < 2 {
+				continue
+			}
+
+			number := uint64(i % len(known))
+			blockFS, err := state.GetBlockByNumber(number)
+			if err == nil && blockFS.BlockHash != known[number] {
+				err = fmt.Errorf("read block %x at height %d, expected %x", blockFS.BlockHash, number, known[number])
+			}
+			if err == nil {
+				var blocks []Block
+				blocks, err = state.GetBlocksAfter(known[len(known)-2])
+				if err == nil && len(blocks) == 0 {
+					err = fmt.Errorf("expected the blocks after %x", known[len(known)-2])
+				}
+			}
+			if err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+
+	var parent Hash
+	for i := uint64(0); i <= 2*SnapshotInterval; i++ {
+		tx := signTestTx(t, TX{From: alice, To: bob, Value: 1, Time: i}, key)
+		parent, err = state.AddBlock(NewBlock(parent, i, i, 0, miner, []SignedTx{tx}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mu.Lock()
+		hashes = append(hashes, parent)
+		mu.Unlock()
+	}
+	close(stop)
+
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	if state.PrunedBelow() != 2*SnapshotInterval-9 {
+		t.Fatalf("expected the blocks below %d pruned, got %d", 2*SnapshotInterval-9, state.PrunedBelow())
+	}
+}
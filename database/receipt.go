@@ -0,0 +1,186 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+const (
+	ReceiptStatusSuccess = "success"
+	// ReceiptStatusFailed is a contract call that failed, it paid its fee
+	// but changed no storage.
+	ReceiptStatusFailed = "failed"
+)
+
+// Receipt records the outcome of a transaction included in a block.
+type Receipt struct {
+	TxHash Hash `json:"tx_hash"`
+	TxLocation
+	Status string `json:"status"`
+	Fee    Amount `json:"fee"`
+	// Asset of the balances, the native currency when empty.
+	Asset string `json:"asset,omitempty"`
+	// Balances of the sender and the recipient right after the transaction.
+	Balances map[Account]Amount `json:"balances"`
+	// Contract, GasUsed, Return and Error are the execution of contract TXs.
+	Contract *Account `json:"contract,omitempty"`
+	GasUsed  uint64   `json:"gas_used,omitempty"`
+	Return   []uint64 `json:"return,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+func (r *Receipt) setExecution(execution Execution) {
+	r.Contract = &execution.Contract
+	r.GasUsed = execution.GasUsed
+	r.Return = execution.Return
+	if execution.Err != nil {
+		r.Status = ReceiptStatusFailed
+		r.Error = execution.Err.Error()
+	}
+}
+
+// receiptRecord holds the receipts of one block, in block order.
+type receiptRecord struct {
+	BlockHash   Hash      `json:"block_hash"`
+	BlockNumber uint64    `json:"block_number"`
+	Receipts    []Receipt `json:"receipts"`
+}
+
+// receiptIndex maps transaction hashes to their receipt.
+type receiptIndex struct {
+	mu sync.RWMutex
+
+	f        *os.File
+	receipts map[Hash]Receipt
+	last     Hash
+}
+
+func openReceiptIndex(dataDir string) (*receiptIndex, error) {
+	f, err := openIndexFile(getIndexFilePath(dataDir, "receipts"))
+	if err != nil {
+		return nil, err
+	}
+
+	idx := &receiptIndex{f: f, receipts: make(map[Hash]Receipt)}
+
+	err = readIndexFile(f, func(line []byte) error {
+		var record receiptRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return err
+		}
+		idx.add(record)
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("Rebuilding receipts index: %v\n", err)
+		return idx, idx.reset()
+	}
+
+	return idx, nil
+}
+
+func (idx *receiptIndex) name() string {
+	return "receipts"
+}
+
+func (idx *receiptIndex) lastIndexed() Hash {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return idx.last
+}
+
+func (idx *receiptIndex) indexSnapshot(snapshot Snapshot) error {
+	return idx.append(receiptRecord{snapshot.Block.BlockHash, snapshot.Number(), []Receipt{}})
+}
+
+func (idx *receiptIndex) indexBlock(block indexedBlock) error {
+	return idx.append(receiptRecord{block.BlockHash, block.Block.Header.Number, block.Receipts})
+}
+
+func (idx *receiptIndex) reset() error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.receipts = make(map[Hash]Receipt)
+	idx.last = Hash{}
+	return truncateIndexFile(idx.f)
+}
+
+func (idx *receiptIndex) close() error {
+	return idx.f.Close()
+}
+
+func (idx *receiptIndex) append(record receiptRecord) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.add(record)
+	return appendIndexRecord(idx.f, record)
+}
+
+func (idx *receiptIndex) add(record receiptRecord) {
+	for _, receipt := range record.Receipts {
+		idx.receipts[receipt.TxHash] = receipt
+	}
+	idx.last = record.BlockHash
+}
+
+func (idx *receiptIndex) receipt(txHash Hash) (Receipt, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	receipt, ok := idx.receipts[txHash]
+	return receipt, ok
+}
+
+// GetReceipt returns the receipt of a mined transaction.
+func (s *State) GetReceipt(txHash Hash) (Receipt, bool) {
+	return s.indexes.receipts.receipt(txHash)
+}
+
+// FilterTxs applies the transactions in order on top of the current state as
+// part of a block with the given header and splits them into the ones the
+// block can include and the ones failing, together with the reason. The TXs
+// not valid yet at the block are neither. The state itself isn't modified.
+func (s *State) FilterTxs(txs []SignedTx, header BlockHeader) ([]SignedTx, map[Hash]error) {
+	pendingState := s.copy()
+
+	valid := []SignedTx{}
+	rejected := make(map[Hash]error)
+
+	// a TX may spend what a later one pays it, the failing TXs are retried
+	// after the others until a pass includes none of them
+	for len(txs) > 0 {
+		var failed []SignedTx
+
+		for _, tx := range txs {
+			txHash, err := tx.Hash()
+			if err != nil {
+				continue
+			}
+
+			if err := tx.CheckValidity(header); errors.Is(err, ErrTxNotYetValid) {
+				continue
+			}
+
+			if _, err := pendingState.apply(tx, header); err != nil {
+				rejected[txHash] = err
+				failed = append(failed, tx)
+				continue
+			}
+			delete(rejected, txHash)
+			valid = append(valid, tx)
+		}
+
+		if len(failed) == len(txs) {
+			break
+		}
+		txs = failed
+	}
+
+	return valid, rejected
+}
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"encoding/hex"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestReceipts(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := Account(crypto.PubkeyToAddress(key.PublicKey))
+	bob, miner := NewAccount("0x02"), NewAccount("0x03")
+
+	state := newTestChainState(t, genesis{
+		Consensus: &ConsensusConfig{Engine: EngineInstant},
+		Balances:  map[Account]Amount{alice: 100000},
+	})
+
+	code, err := Assemble(counterContract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deploy := signTestTx(t, TX{From: alice, To: alice, Data: hex.EncodeToString(code), Fee: 1000, GasLimit: 1000, Time: 0, Type: TxTypeContractDeploy}, key)
+	deployHash, _ := deploy.Hash()
+	contract := ContractAccount(deployHash)
+
+	transfer := signTestTx(t, TX{From: alice, To: bob, Value: 10, Fee: 3, Time: 1}, key)
+	// the counter reverts above 100, the call fails but stays in the block
+	reverted := signTestTx(t, TX{From: alice, To: contract, Data: "101", Fee: 500, GasLimit: 500, Time: 2, Type: TxTypeContractCall}, key)
+	hash, err := state.AddBlock(NewBlock(Hash{}, 0, 0, 0, miner, []SignedTx{deploy, transfer, reverted}))
+	if err != nil {
+		t.Fatalf("expected the block with a failed TX to be accepted: %v", err)
+	}
+
+	receipt := getTestReceipt(t, state, transfer)
+	expected := map[Account]Amount{alice: 100000 - 1000 - 13, bob: 10}
+	if receipt.Status != ReceiptStatusSuccess || receipt.Fee != 3 || !reflect.DeepEqual(receipt.Balances, expected) {
+		t.Fatalf("expected a successful receipt with fee 3 and balances %v, got %+v", expected, receipt)
+	}
+	if receipt.BlockHash != hash || receipt.BlockNumber != 0 || receipt.Index != 1 {
+		t.Fatalf("expected the receipt located at TX 1 of block %x, got %+v", hash, receipt.TxLocation)
+	}
+
+	receipt = getTestReceipt(t, state, reverted)
+	if receipt.Status != ReceiptStatusFailed || receipt.Error == "" || receipt.Fee != 500 || receipt.Balances[alice] != 100000-1000-13-500 {
+		t.Fatalf("expected a failed receipt paying its fee of 500, got %+v", receipt)
+	}
+	if state.Balances[alice] != 100000-1513 || state.Balances[miner] != BlockReward+1503 {
+		t.Fatalf("expected the fees paid by alice to go to the miner, got %d and %d", state.Balances[alice], state.Balances[miner])
+	}
+
+	// the receipts are the same read back from disk and rebuilt from blocks.db
+	receipts := make(map[Hash]Receipt)
+	for _, tx := range []SignedTx{deploy, transfer, reverted} {
+		txHash, _ := tx.Hash()
+		receipts[txHash] = getTestReceipt(t, state, tx)
+	}
+	for _, removeIndex := range []bool{false, true} {
+		state.Close()
+		if removeIndex {
+			if err := os.Remove(getIndexFilePath(state.dataDir, "receipts")); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if state, err = NewStateFromDisk(state.dataDir); err != nil {
+			t.Fatal(err)
+		}
+		for txHash, expected := range receipts {
+			if receipt, ok := state.GetReceipt(txHash); !ok || !reflect.DeepEqual(receipt, expected) {
+				t.Fatalf("expected the same receipt after reopening (index removed: %v), got %+v", removeIndex, receipt)
+			}
+		}
+	}
+	state.Close()
+}
@@ -0,0 +1,250 @@
+package database
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// blockRecord is one line of blocks.db as found on disk.
+type blockRecord struct {
+	Offset  int64
+	Length  int64
+	BlockFS BlockFS
+	Err     error
+	// Torn is set when the record lacks its terminating newline, the write
+	// of the record was interrupted.
+	Torn bool
+}
+
+func (r blockRecord) End() int64 {
+	return r.Offset + r.Length
+}
+
+// encodeBlockFS serializes a block as a blocks.db line protected by a CRC32
+// checksum of its JSON encoding without the checksum field.
+func encodeBlockFS(blockFS BlockFS) ([]byte, error) {
+	blockFS.Checksum = ""
+
+	blockFSJSON, err := json.Marshal(blockFS)
+	if err != nil {
+		return nil, err
+	}
+
+	blockFS.Checksum = fmt.Sprintf("%08x", crc32.Checksum(blockFSJSON, crcTable))
+
+	blockFSJSON, err = json.Marshal(blockFS)
+	if err != nil {
+		return nil, err
+	}
+	return append(blockFSJSON, '\n'), nil
+}
+
+// decodeBlockFS parses a blocks.db line. Records written before checksums
+// were introduced have none and are accepted as they are.
+func decodeBlockFS(line []byte) (BlockFS, error) {
+	if len(line) == 0 || line[len(line)-1] != '\n' {
+		return BlockFS{}, fmt.Errorf("incomplete record")
+	}
+
+	var blockFS BlockFS
+	if err := json.Unmarshal(line, &blockFS); err != nil {
+		return BlockFS{}, err
+	}
+
+	if blockFS.Checksum == "" {
+		return blockFS, nil
+	}
+
+	checksum := blockFS.Checksum
+	blockFS.Checksum = ""
+
+	blockFSJSON, err := json.Marshal(blockFS)
+	if err != nil {
+		return BlockFS{}, err
+	}
+
+	if expected := fmt.Sprintf("%08x", crc32.Checksum(blockFSJSON, crcTable)); checksum != expected {
+		return BlockFS{}, fmt.Errorf("checksum mismatch: record has %s, content is %s", checksum, expected)
+	}
+
+	blockFS.Checksum = checksum
+	return blockFS, nil
+}
+
+// scanBlockRecords reads blocks.db from the first byte. Undecodable records
+// are passed to fn with Err set, fn returns false to stop the scan.
+func scanBlockRecords(f *os.File, fn func(record blockRecord) (bool, error)) error {
+	// the file offset is left alone, concurrent scans share the handle
+	reader := bufio.NewReader(io.NewSectionReader(f, 0, math.MaxInt64))
+	offset := int64(0)
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) == 0 && errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+
+		record := blockRecord{Offset: offset, Length: int64(len(line)), Torn: line[len(line)-1] != '\n'}
+		record.BlockFS, record.Err = decodeBlockFS(line)
+		offset += record.Length
+
+		next, fnErr := fn(record)
+		if fnErr != nil {
+			return fnErr
+		}
+		if !next {
+			return nil
+		}
+	}
+}
+
+// recoverBlocksDB truncates a torn last record, left behind by a crash in the
+// middle of a write. Corruption anywhere else, including a complete last
+// record, is reported, not repaired. It returns where every block of
+// blocks.db is stored.
+func recoverBlocksDB(f *os.File) ([]blockLocation, error) {
+	locations := []blockLocation{}
+	var bad *blockRecord
+	var size int64
+
+	err := scanBlockRecords(f, func(record blockRecord) (bool, error) {
+		if bad != nil {
+			return false, fmt.Errorf("blocks.db is corrupted at offset %d: %v, run 'tbb db check --repair'", bad.Offset, bad.Err)
+		}
+
+		if record.Err != nil {
+			r := record
+			bad = &r
+		} else {
+			locations = append(locations, newBlockLocation(record))
+		}
+
+		size = record.End()
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if bad != nil && !bad.Torn {
+		return nil, fmt.Errorf("blocks.db is corrupted at offset %d: %v, run 'tbb db check --repair'", bad.Offset, bad.Err)
+	}
+	if bad != nil {
+		fmt.Printf("Truncating torn record at the end of blocks.db (offset %d, %d bytes): %v\n", bad.Offset, size-bad.Offset, bad.Err)
+		if err := f.Truncate(bad.Offset); err != nil {
+			return nil, err
+		}
+		if err := f.Sync(); err != nil {
+			return nil, err
+		}
+	}
+
+	return locations, nil
+}
+
+type BlocksDBProblem struct {
+	Offset int64  `json:"offset"`
+	Reason string `json:"reason"`
+}
+
+type BlocksDBReport struct {
+	Records  int               `json:"records"`
+	Valid    int               `json:"valid"`
+	Size     int64             `json:"size"`
+	Problems []BlocksDBProblem `json:"problems"`
+	Repaired bool              `json:"repaired"`
+}
+
+// CheckBlocksDB verifies the integrity of every blocks.db record: encoding,
+// checksum, stored hash and the link to the previous record. With repair the
+// file is truncated right before the first bad record, the dropped blocks are
+// then synced again from peers.
+func CheckBlocksDB(dataDir string, repair bool) (BlocksDBReport, error) {
+	report := BlocksDBReport{Problems: []BlocksDBProblem{}}
+
+	flag := os.O_RDONLY
+	if repair {
+		flag = os.O_RDWR
+	}
+
+	f, err := os.OpenFile(getBlocksDBFilePath(dataDir), flag, 0600)
+	if err != nil {
+		return report, err
+	}
+	defer f.Close()
+
+	var prev *BlockFS
+	firstBad := int64(-1)
+
+	err = scanBlockRecords(f, func(record blockRecord) (bool, error) {
+		report.Records++
+		report.Size = record.End()
+
+		problem := checkBlockRecord(record, prev)
+		if problem != nil {
+			report.Problems = append(report.Problems, *problem)
+			if firstBad < 0 {
+				firstBad = record.Offset
+			}
+			return true, nil
+		}
+
+		if firstBad < 0 {
+			report.Valid++
+		}
+		blockFS := record.BlockFS
+		prev = &blockFS
+		return true, nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	if repair && firstBad >= 0 {
+		if err := f.Truncate(firstBad); err != nil {
+			return report, err
+		}
+		if err := f.Sync(); err != nil {
+			return report, err
+		}
+		report.Repaired = true
+	}
+
+	return report, nil
+}
+
+func checkBlockRecord(record blockRecord, prev *BlockFS) *BlocksDBProblem {
+	if record.Err != nil {
+		return &BlocksDBProblem{Offset: record.Offset, Reason: record.Err.Error()}
+	}
+
+	header := record.BlockFS.Block.Header
+	reason := ""
+
+	hash, err := record.BlockFS.Block.Hash()
+	switch {
+	case err != nil:
+		reason = err.Error()
+	case !record.BlockFS.Pruned && hash != record.BlockFS.BlockHash:
+		reason = fmt.Sprintf("stored hash %x doesn't match block content %x", record.BlockFS.BlockHash, hash)
+	case prev != nil && header.Number != prev.Block.Header.Number+1:
+		reason = fmt.Sprintf("expected block number %d", prev.Block.Header.Number+1)
+	case prev != nil && header.Parent != prev.BlockHash:
+		reason = fmt.Sprintf("parent %x doesn't match previous block %x", header.Parent, prev.BlockHash)
+	default:
+		return nil
+	}
+
+	return &BlocksDBProblem{Offset: record.Offset, Reason: fmt.Sprintf("block %d: %s", header.Number, reason)}
+}
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestEncodeDecodeBlockFS(t *testing.T) {
+	blockFS := BlockFS{Block: NewBlock(Hash{}, 1, 1, 2, NewAccount("0x01"), nil)}
+
+	record, err := encodeBlockFS(blockFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := decodeBlockFS(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Checksum == "" || decoded.Block.Header.Nonce != 2 {
+		t.Fatalf("unexpected decoded record %+v", decoded)
+	}
+
+	tampered := bytes.Replace(record, []byte(`"nonce":2`), []byte(`"nonce":3`), 1)
+	if _, err := decodeBlockFS(tampered); err == nil {
+		t.Fatal("expected checksum mismatch")
+	}
+}
+
+func TestRecoverBlocksDB_TruncatesTornRecord(t *testing.T) {
+	f, err := ioutil.TempFile("", "blocks.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	record, err := encodeBlockFS(BlockFS{Block: NewBlock(Hash{}, 0, 1, 2, NewAccount("0x01"), nil)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Write(append(record, record[:len(record)/2]...)); err != nil {
+		t.Fatal(err)
+	}
+
+	locations, err := recoverBlocksDB(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locations) != 1 {
+		t.Fatalf("expected a single block left in blocks.db, got %d", len(locations))
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != int64(len(record)) {
+		t.Fatalf("expected blocks.db of %d bytes, got %d", len(record), info.Size())
+	}
+}
+
+func TestRecoverBlocksDB_ReportsCorruptedLastRecord(t *testing.T) {
+	f, err := ioutil.TempFile("", "blocks.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	record, err := encodeBlockFS(BlockFS{Block: NewBlock(Hash{}, 0, 1, 2, NewAccount("0x01"), nil)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a complete record whose content no longer matches its checksum
+	corrupted := bytes.Replace(record, []byte(`"time":1`), []byte(`"time":7`), 1)
+	if bytes.Equal(corrupted, record) {
+		t.Fatal("expected the record to hold the block time")
+	}
+	if _, err := f.Write(append(record, corrupted...)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := recoverBlocksDB(f); err == nil {
+		t.Fatal("expected a complete record with a bad checksum to be reported")
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != int64(2*len(record)) {
+		t.Fatalf("expected blocks.db to be left untouched, got %d bytes", info.Size())
+	}
+}
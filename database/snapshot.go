@@ -0,0 +1,365 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+)
+
+// SnapshotInterval is the number of blocks between two automatic snapshots.
+const SnapshotInterval = 100
+
+const snapshotsToKeep = 2
+
+var errSnapshotMismatch = errors.New("snapshot doesn't match blocks.db")
+
+// Snapshot is the state right after Block was applied. It lets a node start
+// without replaying and re-validating every block since genesis.
+type Snapshot struct {
+	Block    BlockFS            `json:"block"`
+	Balances map[Account]Amount `json:"balances"`
+	// Authority is the PoA signer set, empty for other engines.
+	Authority *Authority `json:"authority,omitempty"`
+	// Escrows are the HTLC escrows, settled ones included.
+	Escrows map[Hash]Escrow `json:"escrows,omitempty"`
+	// Tokens are the issued tokens with their balances.
+	Tokens map[string]*Token `json:"tokens,omitempty"`
+	// Contracts are the deployed contracts with their storage.
+	Contracts map[Account]*Contract `json:"contracts,omitempty"`
+	Checksum  Hash                  `json:"checksum"`
+}
+
+func (s Snapshot) Number() uint64 {
+	return s.Block.Block.Header.Number
+}
+
+func (s Snapshot) computeChecksum() (Hash, error) {
+	s.Checksum = Hash{}
+
+	snapshotJSON, err := json.Marshal(s)
+	if err != nil {
+		return Hash{}, err
+	}
+	return sha256.Sum256(snapshotJSON), nil
+}
+
+// Validate checks the snapshot wasn't corrupted and that its block is sealed
+// according to the engine. It doesn't prove the balances, see VerifySnapshot.
+func (s Snapshot) Validate(engine Engine) error {
+	checksum, err := s.computeChecksum()
+	if err != nil {
+		return err
+	}
+	if checksum != s.Checksum {
+		return fmt.Errorf("invalid snapshot checksum %x, expected %x", s.Checksum, checksum)
+	}
+
+	hash, err := s.Block.Block.Hash()
+	if err != nil {
+		return err
+	}
+	if hash != s.Block.BlockHash {
+		return fmt.Errorf("snapshot block hash is %x, expected %x", s.Block.BlockHash, hash)
+	}
+
+	return engine.VerifySeal(s.Block.Block)
+}
+
+// Snapshot captures the current state.
+func (s *State) Snapshot() (Snapshot, error) {
+	if !s.hasGenesisBlock {
+		return Snapshot{}, fmt.Errorf("can't snapshot a chain without blocks")
+	}
+
+	snapshot := Snapshot{
+		Block:    BlockFS{BlockHash: s.latestBlockHash, Block: s.latestBlock},
+		Balances: make(map[Account]Amount, len(s.Balances)),
+	}
+	for account, balance := range s.Balances {
+		snapshot.Balances[account] = balance
+	}
+	if s.engine.Name() == EnginePoA {
+		authority := s.authority.copy()
+		snapshot.Authority = &authority
+	}
+	if len(s.escrows) > 0 {
+		snapshot.Escrows = copyEscrows(s.escrows)
+	}
+	if len(s.tokens) > 0 {
+		snapshot.Tokens = copyTokens(s.tokens)
+	}
+	if len(s.contracts) > 0 {
+		snapshot.Contracts = copyContracts(s.contracts)
+	}
+
+	checksum, err := snapshot.computeChecksum()
+	if err != nil {
+		return Snapshot{}, err
+	}
+	snapshot.Checksum = checksum
+
+	return snapshot, nil
+}
+
+// CreateSnapshot writes a snapshot of the current state into the data dir
+// and removes the older ones.
+func (s *State) CreateSnapshot() (Snapshot, error) {
+	snapshot, err := s.Snapshot()
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	if err := WriteSnapshot(getSnapshotFilePath(s.dataDir, snapshot.Block.BlockHash), snapshot); err != nil {
+		return Snapshot{}, err
+	}
+
+	return snapshot, pruneSnapshots(s.dataDir, s.engine)
+}
+
+func (s *State) loadSnapshot(snapshot Snapshot) {
+	s.Balances = make(map[Account]Amount, len(snapshot.Balances))
+	for account, balance := range snapshot.Balances {
+		s.Balances[account] = balance
+	}
+
+	if snapshot.Authority != nil {
+		s.authority = snapshot.Authority.copy()
+	}
+	s.escrows = copyEscrows(snapshot.Escrows)
+	s.tokens = copyTokens(snapshot.Tokens)
+	s.contracts = copyContracts(snapshot.Contracts)
+
+	s.latestBlock = snapshot.Block.Block
+	s.latestBlockHash = snapshot.Block.BlockHash
+	s.hasGenesisBlock = true
+}
+
+func LoadSnapshot(path string) (Snapshot, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	var snapshot Snapshot
+	if err := json.Unmarshal(contents, &snapshot); err != nil {
+		return Snapshot{}, err
+	}
+	return snapshot, nil
+}
+
+func WriteSnapshot(path string, snapshot Snapshot) error {
+	snapshotJSON, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	// write to a temporary file first so a crash never leaves half a snapshot
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, snapshotJSON, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// ImportSnapshot installs a snapshot file into the data dir, a node with an
+// empty blocks.db then starts from it and syncs only the blocks after it.
+//
+// The checksum only detects corruption, anyone can recompute it. The snapshot
+// block must therefore be anchored: its hash is a checkpoint of the chain or
+// the trusted hash given by the operator, and that hash commits to the whole
+// header chain below it. A block committing to its state must then match the
+// snapshot state. A block from before state commitments has no root, its
+// snapshot state is trusted along with the anchor.
+func ImportSnapshot(dataDir string, path string, trustedHash Hash) (Snapshot, error) {
+	if err := initDataDirIfNotExists(dataDir); err != nil {
+		return Snapshot{}, err
+	}
+
+	genesis, err := loadGenesis(getGenesisJSONFilePath(dataDir))
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	snapshot, err := LoadSnapshot(path)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	if err := snapshot.Validate(genesis.engine); err != nil {
+		return Snapshot{}, err
+	}
+
+	if err := snapshot.verifyAnchor(genesis, trustedHash); err != nil {
+		return Snapshot{}, err
+	}
+
+	return snapshot, WriteSnapshot(getSnapshotFilePath(dataDir, snapshot.Block.BlockHash), snapshot)
+}
+
+// verifyAnchor checks the snapshot block is the checkpoint at its height or
+// the trusted hash, and the snapshot state against the block state root.
+func (s Snapshot) verifyAnchor(genesis genesis, trustedHash Hash) error {
+	checkpoint, isCheckpoint := genesis.checkpoints[s.Number()]
+	switch {
+	case isCheckpoint && checkpoint != s.Block.BlockHash:
+		return fmt.Errorf("snapshot block %d is '%x', but checkpoint requires '%x'", s.Number(), s.Block.BlockHash, checkpoint)
+	case !isCheckpoint && trustedHash != s.Block.BlockHash:
+		return fmt.Errorf("snapshot block %d '%x' is neither a checkpoint nor the trusted hash", s.Number(), s.Block.BlockHash)
+	}
+
+	state := &State{forks: genesis.forks}
+	state.loadSnapshot(s)
+	return verifyStateRoot(state, s.Block.Block)
+}
+
+// VerifySnapshot replays blocks.db from genesis up to the snapshot's block
+// and compares the resulting balances with the snapshot.
+func VerifySnapshot(dataDir string, snapshot Snapshot) error {
+	genesis, err := loadGenesis(getGenesisJSONFilePath(dataDir))
+	if err != nil {
+		return err
+	}
+
+	if err := snapshot.Validate(genesis.engine); err != nil {
+		return err
+	}
+
+	f, err := os.Open(getBlocksDBFilePath(dataDir))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	state := newGenesisState(dataDir, genesis, f)
+
+	reached := false
+	err = state.forEachBlockFS(func(blockFS BlockFS) (bool, error) {
+		if blockFS.Pruned {
+			return false, fmt.Errorf("block %d is pruned, the snapshot can't be verified", blockFS.Block.Header.Number)
+		}
+		if _, err := applyBlock(state, blockFS.Block); err != nil {
+			return false, err
+		}
+
+		state.latestBlock = blockFS.Block
+		state.latestBlockHash = blockFS.BlockHash
+		state.hasGenesisBlock = true
+
+		reached = blockFS.Block.Header.Number >= snapshot.Number()
+		return !reached, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if !reached {
+		return fmt.Errorf("blocks.db ends before snapshot height %d", snapshot.Number())
+	}
+
+	if state.latestBlockHash != snapshot.Block.BlockHash {
+		return fmt.Errorf("block %d is '%x', snapshot has '%x'", snapshot.Number(), state.latestBlockHash, snapshot.Block.BlockHash)
+	}
+
+	for account, balance := range state.Balances {
+		if snapshot.Balances[account] != balance {
+			return fmt.Errorf("account %s balance is %d, snapshot has %d", account.Hex(), balance, snapshot.Balances[account])
+		}
+	}
+	for account, balance := range snapshot.Balances {
+		if _, ok := state.Balances[account]; !ok && balance != 0 {
+			return fmt.Errorf("account %s is unknown, snapshot has balance %d", account.Hex(), balance)
+		}
+	}
+
+	if snapshot.Authority != nil && !reflect.DeepEqual(snapshot.Authority.Signers, state.authority.Signers) {
+		return fmt.Errorf("signers are %v, snapshot has %v", state.authority.Signers, snapshot.Authority.Signers)
+	}
+
+	if len(state.escrows) != len(snapshot.Escrows) {
+		return fmt.Errorf("%d escrows, snapshot has %d", len(state.escrows), len(snapshot.Escrows))
+	}
+	for id, escrow := range state.escrows {
+		if snapshot.Escrows[id] != escrow {
+			return fmt.Errorf("escrow %x is %+v, snapshot has %+v", id, escrow, snapshot.Escrows[id])
+		}
+	}
+
+	if len(state.tokens) != len(snapshot.Tokens) {
+		return fmt.Errorf("%d tokens, snapshot has %d", len(state.tokens), len(snapshot.Tokens))
+	}
+	for symbol, token := range state.tokens {
+		if !reflect.DeepEqual(snapshot.Tokens[symbol], token) {
+			return fmt.Errorf("token '%s' is %+v, snapshot has %+v", symbol, token, snapshot.Tokens[symbol])
+		}
+	}
+
+	if len(state.contracts) != len(snapshot.Contracts) {
+		return fmt.Errorf("%d contracts, snapshot has %d", len(state.contracts), len(snapshot.Contracts))
+	}
+	for account, contract := range state.contracts {
+		if !reflect.DeepEqual(snapshot.Contracts[account], contract) {
+			return fmt.Errorf("contract %s is %+v, snapshot has %+v", account.Hex(), contract, snapshot.Contracts[account])
+		}
+	}
+
+	return nil
+}
+
+// loadSnapshots returns the valid snapshots of the data dir, newest first.
+func loadSnapshots(dataDir string, engine Engine) ([]Snapshot, error) {
+	files, err := ioutil.ReadDir(getSnapshotsDirPath(dataDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]Snapshot, 0, len(files))
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+
+		snapshot, err := LoadSnapshot(filepath.Join(getSnapshotsDirPath(dataDir), file.Name()))
+		if err == nil {
+			err = snapshot.Validate(engine)
+		}
+		if err != nil {
+			fmt.Printf("Ignoring snapshot '%s': %v\n", file.Name(), err)
+			continue
+		}
+
+		snapshots = append(snapshots, snapshot)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Number() > snapshots[j].Number()
+	})
+
+	return snapshots, nil
+}
+
+func pruneSnapshots(dataDir string, engine Engine) error {
+	snapshots, err := loadSnapshots(dataDir, engine)
+	if err != nil {
+		return err
+	}
+
+	for i := snapshotsToKeep; i < len(snapshots); i++ {
+		if err := os.Remove(getSnapshotFilePath(dataDir, snapshots[i].Block.BlockHash)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
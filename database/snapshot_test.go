@@ -0,0 +1,63 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestImportSnapshot(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := Account(crypto.PubkeyToAddress(key.PublicKey))
+	bob, miner := NewAccount("0x02"), NewAccount("0x03")
+
+	g := genesis{
+		Consensus: &ConsensusConfig{Engine: EngineInstant},
+		Balances:  map[Account]Amount{alice: 1000},
+	}
+	state := newTestChainState(t, g)
+
+	tx := signTestTx(t, TX{From: alice, To: bob, Value: 10, Time: 0}, key)
+	block, err := state.Seal(context.Background(), NewBlock(Hash{}, 0, 0, 0, miner, []SignedTx{tx}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := state.AddBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := state.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	if err := WriteSnapshot(path, snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	dataDir := newTestChainState(t, g).dataDir
+	if _, err := ImportSnapshot(dataDir, path, Hash{}); err == nil {
+		t.Fatal("expected a snapshot without anchor to be rejected")
+	}
+	if _, err := ImportSnapshot(dataDir, path, hash); err != nil {
+		t.Fatal(err)
+	}
+
+	// a peer regenerating the checksum of forged balances
+	snapshot.Balances[bob] = 500
+	if snapshot.Checksum, err = snapshot.computeChecksum(); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteSnapshot(path, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ImportSnapshot(dataDir, path, hash); err == nil {
+		t.Fatal("expected a snapshot not matching its block state root to be rejected")
+	}
+}
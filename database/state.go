@@ -1,22 +1,49 @@
 package database
 
 import (
-	"bufio"
 	"bytes"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"os"
+	"sync"
+	"time"
 )
 
-const BlockReward = 100
+const BlockReward Amount = 100
 
 type State struct {
-	Balances  map[Account]uint `json:"balances"`
+	Balances  map[Account]Amount `json:"balances"`
 	txMempool []SignedTx
 
+	denomination Denomination
+
+	engine    Engine
+	authority Authority
+	// escrows are the HTLC escrows by lock TX hash
+	escrows map[Hash]Escrow
+	// tokens are the issued tokens by symbol
+	tokens map[string]*Token
+	// contracts are the deployed contracts by account
+	contracts map[Account]*Contract
+
+	checkpoints Checkpoints
+	forks       Forks
+	fastSync    bool
+	pruneKeep   uint64
+	// sigsChecked are the blocks to add whose TX signatures were checked
+	// ahead, or that a checkpoint vouches for with fast sync
+	sigsChecked map[Hash]bool
+
+	dataDir string
+	// dbMu guards the blocks.db handle, which pruning swaps, and keeps the
+	// block locations matching the file read with them
+	dbMu   sync.RWMutex
 	dbFile *os.File
 
+	indexes *chainIndexes
+
+	blockLocator
+
 	latestBlock     Block
 	latestBlockHash Hash
 	hasGenesisBlock bool
@@ -33,44 +60,223 @@ func NewStateFromDisk(dir string) (*State, error) {
 		return nil, err
 	}
 
-	balances := make(map[Account]uint, len(genesis.Balances))
-	for account, balance := range genesis.Balances {
-		balances[account] = balance
+	f, err := os.OpenFile(getBlocksDBFilePath(dir), os.O_APPEND|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
 	}
 
-	f, err := os.OpenFile(getBlocksDBFilePath(dir), os.O_APPEND|os.O_RDWR, 0600)
+	locations, err := recoverBlocksDB(f)
 	if err != nil {
+		f.Close()
 		return nil, err
 	}
 
-	state := &State{balances, make([]SignedTx, 0), f, Block{}, Hash{}, false}
+	snapshots, err := loadSnapshots(dir, genesis.engine)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
 
-	scanner := bufio.NewScanner(f)
+	indexes, err := openIndexes(dir, genesis)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
 
-	for scanner.Scan() {
-		if err := scanner.Err(); err != nil {
-			return nil, err
+	// with an empty blocks.db, the chain tip is the snapshot the node is
+	// bootstrapped from, if any
+	tip := Hash{}
+	if len(locations) > 0 {
+		tip = locations[len(locations)-1].Hash
+	} else if len(snapshots) > 0 {
+		tip = snapshots[0].Block.BlockHash
+	}
+
+	stale := staleIndexes(indexes.all(), tip)
+	if len(stale) > 0 {
+		fmt.Printf("Rebuilding %d indexes from blocks.db\n", len(stale))
+		for _, index := range stale {
+			if err := index.reset(); err != nil {
+				indexes.close()
+				f.Close()
+				return nil, err
+			}
 		}
 
-		var blockFS BlockFS
-		if err := json.Unmarshal(scanner.Bytes(), &blockFS); err != nil {
-			return nil, err
+		// indexes need every block after the snapshot applied: a snapshot
+		// the chain was bootstrapped from can be used and, once blocks were
+		// pruned, one no pruned block follows. The indexes then start there.
+		prunedBelow := prunedHeight(locations)
+		indexSnapshots := []Snapshot{}
+		for _, snapshot := range snapshots {
+			bootstrap := len(locations) == 0 || snapshot.Number() < locations[0].Number
+			if bootstrap || (prunedBelow > 0 && snapshot.Number()+1 >= prunedBelow) {
+				indexSnapshots = append(indexSnapshots, snapshot)
+			}
+		}
+		snapshots = indexSnapshots
+	}
+
+	// try the most recent snapshot first and fall back to older ones
+	// (finally to a full replay from genesis) when it doesn't match blocks.db
+	for i := 0; i <= len(snapshots); i++ {
+		var snapshot *Snapshot
+		if i < len(snapshots) {
+			snapshot = &snapshots[i]
 		}
 
-		if err := applyBlock(state, blockFS.Block); err != nil {
+		state := newGenesisState(dir, genesis, f)
+		state.indexes = indexes
+		state.setBlockLocations(locations)
+
+		err := state.replay(snapshot, stale)
+		if err == nil {
+			replayedFrom := uint64(0)
+			if snapshot != nil {
+				fmt.Printf("Loaded state from snapshot at height %d\n", snapshot.Number())
+				replayedFrom = snapshot.Number()
+			}
+
+			if state.hasGenesisBlock && state.latestBlock.Header.Number-replayedFrom >= SnapshotInterval {
+				if _, err := state.CreateSnapshot(); err != nil {
+					fmt.Printf("Error: unable to snapshot state: %v\n", err)
+				}
+			}
+			return state, nil
+		}
+
+		if !errors.Is(err, errSnapshotMismatch) {
+			state.Close()
 			return nil, err
 		}
+		fmt.Printf("Skipping snapshot '%x': %v\n", snapshot.Block.BlockHash, err)
+
+		for _, index := range stale {
+			if err := index.reset(); err != nil {
+				state.Close()
+				return nil, err
+			}
+		}
+	}
+
+	// unreachable, a replay without snapshot never reports a mismatch
+	indexes.close()
+	f.Close()
+	return nil, errSnapshotMismatch
+}
+
+func newGenesisState(dir string, genesis genesis, f *os.File) *State {
+	balances := make(map[Account]Amount, len(genesis.Balances))
+	for account, balance := range genesis.Balances {
+		balances[account] = balance
+	}
+
+	return &State{
+		Balances:     balances,
+		txMempool:    make([]SignedTx, 0),
+		denomination: *genesis.Denomination,
+		engine:       genesis.engine,
+		authority:    newAuthority(genesis.Consensus.Signers),
+		escrows:      make(map[Hash]Escrow),
+		tokens:       make(map[string]*Token),
+		contracts:    make(map[Account]*Contract),
+		checkpoints:  genesis.checkpoints,
+		forks:        genesis.forks,
+		sigsChecked:  make(map[Hash]bool),
+		dataDir:      dir,
+		dbFile:       f,
+	}
+}
+
+// replay rebuilds the state from blocks.db. Blocks up to the snapshot height
+// are only decoded, not validated, the snapshot provides their resulting state.
+// Every applied block is fed to the given indexes.
+func (s *State) replay(snapshot *Snapshot, indexes []blockIndex) error {
+	snapshotLoaded := false
+	skipped := false
+
+	loadSnapshot := func() error {
+		s.loadSnapshot(*snapshot)
+		snapshotLoaded = true
+
+		for _, index := range indexes {
+			if err := index.indexSnapshot(*snapshot); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	err := s.forEachBlockFS(func(blockFS BlockFS) (bool, error) {
+		number := blockFS.Block.Header.Number
+
+		if snapshot != nil && !snapshotLoaded {
+			if number < snapshot.Number() {
+				skipped = true
+				return true, nil
+			}
+
+			if number == snapshot.Number() {
+				if blockFS.BlockHash != snapshot.Block.BlockHash {
+					return false, fmt.Errorf("%w: block %d is '%x'", errSnapshotMismatch, number, blockFS.BlockHash)
+				}
+				return true, loadSnapshot()
+			}
+
+			// blocks.db starts after the snapshot, the node was bootstrapped from it
+			if blockFS.Block.Header.Parent != snapshot.Block.BlockHash {
+				return false, fmt.Errorf("%w: block %d doesn't extend it", errSnapshotMismatch, number)
+			}
+			if err := loadSnapshot(); err != nil {
+				return false, err
+			}
+		}
 
-		state.latestBlock = blockFS.Block
-		state.latestBlockHash = blockFS.BlockHash
-		state.hasGenesisBlock = true
+		if blockFS.Pruned {
+			return false, fmt.Errorf("%v, the state can only be loaded from a snapshot after it", errPruned(number, s.PrunedBelow()))
+		}
+
+		receipts, err := applyBlock(s, blockFS.Block)
+		if err != nil {
+			return false, err
+		}
+
+		s.latestBlock = blockFS.Block
+		s.latestBlockHash = blockFS.BlockHash
+		s.hasGenesisBlock = true
+
+		return true, s.indexBlock(indexes, blockFS, s.Balances, receipts)
+	})
+	if err != nil {
+		return err
 	}
 
-	return state, nil
+	if snapshot != nil && !snapshotLoaded {
+		if skipped {
+			return fmt.Errorf("%w: blocks.db ends before height %d", errSnapshotMismatch, snapshot.Number())
+		}
+		return loadSnapshot()
+	}
+
+	return nil
+}
+
+// forEachBlockFS decodes blocks.db record by record from the first byte,
+// fn returns false to stop the iteration.
+func (s *State) forEachBlockFS(fn func(blockFS BlockFS) (bool, error)) error {
+	s.dbMu.RLock()
+	defer s.dbMu.RUnlock()
+
+	return scanBlockRecords(s.dbFile, func(record blockRecord) (bool, error) {
+		if record.Err != nil {
+			return false, fmt.Errorf("invalid blocks.db record at offset %d: %v", record.Offset, record.Err)
+		}
+		return fn(record.BlockFS)
+	})
 }
 
 func (s *State) AddTx(tx SignedTx) error {
-	if err := s.apply(tx); err != nil {
+	if _, err := s.apply(tx, s.NextBlockHeader()); err != nil {
 		return err
 	}
 	s.txMempool = append(s.txMempool, tx)
@@ -80,7 +286,8 @@ func (s *State) AddTx(tx SignedTx) error {
 func (s *State) AddBlock(b Block) (Hash, error) {
 	pendingState := s.copy()
 
-	if err := applyBlock(pendingState, b); err != nil {
+	receipts, err := applyBlock(pendingState, b)
+	if err != nil {
 		return Hash{}, err
 	}
 
@@ -89,89 +296,255 @@ func (s *State) AddBlock(b Block) (Hash, error) {
 		return Hash{}, err
 	}
 
-	blockFS := BlockFS{hash, b}
-	blockFSJSON, err := json.Marshal(blockFS)
+	blockFS := BlockFS{BlockHash: hash, Block: b}
+	record, err := encodeBlockFS(blockFS)
 	if err != nil {
 		return Hash{}, err
 	}
 
 	fmt.Printf("Persist new block to disk\n")
-	fmt.Printf("\t%s\n", blockFSJSON)
-	if _, err := s.dbFile.Write(append(blockFSJSON, '\n')); err != nil {
+	fmt.Printf("\t%s", record)
+	offset, err := s.persistRecord(record)
+	if err != nil {
 		return Hash{}, err
 	}
+	s.addBlockLocation(blockLocation{offset, hash, b.Header.Number, false})
+
+	if s.indexes != nil {
+		if err := s.indexBlock(s.indexes.all(), blockFS, pendingState.Balances, receipts); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+	}
+
+	delete(s.sigsChecked, hash)
 
 	s.Balances = pendingState.Balances
+	s.authority = pendingState.authority
+	s.escrows = pendingState.escrows
+	s.tokens = pendingState.tokens
+	s.contracts = pendingState.contracts
 	s.latestBlock = b
 	s.latestBlockHash = hash
 	s.hasGenesisBlock = true
 
+	if b.Header.Number > 0 && b.Header.Number%SnapshotInterval == 0 {
+		if _, err := s.CreateSnapshot(); err != nil {
+			fmt.Printf("Error: unable to snapshot state at %x: %v\n", hash, err)
+		} else if s.pruneKeep > 0 && b.Header.Number >= s.pruneKeep {
+			if _, err := s.pruneBodies(b.Header.Number + 1 - s.pruneKeep); err != nil {
+				fmt.Printf("Error: unable to prune blocks.db: %v\n", err)
+			}
+		}
+	}
+
 	return hash, nil
 }
 
-func (s *State) apply(tx SignedTx) error {
+// persistRecord appends a record to blocks.db and flushes it to stable
+// storage, it returns the record offset. A failed write is rolled back so the
+// file never ends with a partial record while the node keeps running.
+func (s *State) persistRecord(record []byte) (int64, error) {
+	s.dbMu.Lock()
+	defer s.dbMu.Unlock()
+
+	info, err := s.dbFile.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := s.dbFile.Write(record); err != nil {
+		if truncErr := s.dbFile.Truncate(info.Size()); truncErr != nil {
+			return 0, fmt.Errorf("%v, and rolling back failed: %v", err, truncErr)
+		}
+		return 0, err
+	}
+
+	return info.Size(), s.dbFile.Sync()
+}
+
+// apply applies the TX as part of the block with the given header, it returns
+// the execution of contract TXs.
+func (s *State) apply(tx SignedTx, header BlockHeader) (*Execution, error) {
 	isAuth, err := tx.IsAuthentic()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if !isAuth {
-		return fmt.Errorf("wrong TX. Sender '%s' is forged", tx.From.Hex())
+		return nil, fmt.Errorf("wrong TX. Sender '%s' is forged", tx.From.Hex())
+	}
+
+	return s.applyUnsigned(tx, header)
+}
+
+// applyUnsigned applies the TX without checking its signature.
+func (s *State) applyUnsigned(tx SignedTx, header BlockHeader) (*Execution, error) {
+	if err := tx.CheckValidity(header); err != nil {
+		return nil, err
 	}
 
 	if tx.IsReward() {
-		s.Balances[tx.To] += tx.Value
-		return nil
+		if tx.Fee != 0 || tx.Type != TxTypeTransfer || tx.Asset != "" || tx.GasLimit != 0 {
+			return nil, fmt.Errorf("wrong TX. Reward can't carry a fee, a type, an asset nor a gas limit")
+		}
+		return nil, s.credit(tx.To, tx.Value)
 	}
 
-	if s.Balances[tx.From] < tx.Value {
-		return fmt.Errorf("wrong TX. Sender %s balance is %d, but cost is %d", tx.From.Hex(), s.Balances[tx.From], tx.Value)
+	if tx.Type == TxTypeContractDeploy || tx.Type == TxTypeContractCall {
+		if tx.HTLC != nil {
+			return nil, fmt.Errorf("wrong TX. Contract TX can't carry HTLC parameters")
+		}
+		return s.applyContract(tx, header)
+	}
+	if tx.GasLimit != 0 {
+		return nil, fmt.Errorf("wrong TX. Only contract TXs have a gas limit")
 	}
 
-	s.Balances[tx.From] -= tx.Value
-	s.Balances[tx.To] += tx.Value
+	switch tx.Type {
+	case TxTypeTransfer:
+	case TxTypeTokenIssue, TxTypeTokenMint, TxTypeTokenBurn:
+		if tx.HTLC != nil {
+			return nil, fmt.Errorf("wrong TX. Token TX can't carry HTLC parameters")
+		}
+		return nil, s.applyToken(tx)
+	default:
+		return nil, s.applyHTLC(tx, header)
+	}
+	if tx.HTLC != nil {
+		return nil, fmt.Errorf("wrong TX. Transfer can't carry HTLC parameters")
+	}
 
+	if err := s.chargeTx(tx); err != nil {
+		return nil, err
+	}
+	return nil, s.creditAsset(tx.To, tx.Asset, tx.Value)
+}
+
+func (s *State) credit(account Account, value Amount) error {
+	balance, err := s.Balances[account].Add(value)
+	if err != nil {
+		return fmt.Errorf("wrong TX. Account %s balance overflow: %v", account.Hex(), err)
+	}
+	s.Balances[account] = balance
+	return nil
+}
+
+func (s *State) debit(account Account, value Amount) error {
+	balance, err := s.Balances[account].Sub(value)
+	if err != nil {
+		return fmt.Errorf("wrong TX. Account %s balance underflow: %v", account.Hex(), err)
+	}
+	s.Balances[account] = balance
 	return nil
 }
 
-func applyBlock(state *State, b Block) error {
+// applyBlock validates and applies the block to the state, it returns the
+// receipts of the block transactions.
+func applyBlock(state *State, b Block) ([]Receipt, error) {
 	nextExpectedBlockNumber := state.NextBlockNumber()
 	if state.hasGenesisBlock {
 		if b.Header.Number != nextExpectedBlockNumber {
-			return fmt.Errorf("expected block number %d, got %d", nextExpectedBlockNumber, b.Header.Number)
+			return nil, fmt.Errorf("expected block number %d, got %d", nextExpectedBlockNumber, b.Header.Number)
 		}
 		if state.latestBlock.Header.Number > 0 && !bytes.Equal(state.latestBlockHash[:], b.Header.Parent[:]) {
-			return fmt.Errorf("expected block hash %d, got %d", state.latestBlockHash[:], b.Header.Parent[:])
+			return nil, fmt.Errorf("expected block hash %d, got %d", state.latestBlockHash[:], b.Header.Parent[:])
 		}
 	}
 
+	var parent *BlockHeader
+	if state.hasGenesisBlock {
+		parent = &state.latestBlock.Header
+	}
+	if err := verifyBlockTime(state.forks, parent, b.Header); err != nil {
+		return nil, err
+	}
+
 	hash, err := b.Hash()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if !hash.IsBlockHashValid() {
-		return fmt.Errorf("invalid block hash %x", hash)
+	if err := state.checkpoints.verify(b.Header.Number, hash); err != nil {
+		return nil, err
 	}
 
-	for _, tx := range b.TXs {
-		if err := state.apply(tx); err != nil {
-			return err
-		}
+	if err := state.engine.VerifyHeader(state, b); err != nil {
+		return nil, err
 	}
 
-	state.Balances[b.Header.Miner] += BlockReward
+	if err := verifyTxRoot(state, b); err != nil {
+		return nil, err
+	}
 
-	return nil
+	receipts, err := applyBlockTXs(state, b, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return receipts, verifyStateRoot(state, b)
+}
+
+// applyBlockTXs applies the block TXs and the engine's finalization without
+// checking the header.
+func applyBlockTXs(state *State, b Block, hash Hash) ([]Receipt, error) {
+	apply := state.apply
+	if state.sigsChecked[hash] {
+		apply = state.applyUnsigned
+	}
+
+	receipts := make([]Receipt, 0, len(b.TXs))
+	for i, tx := range b.TXs {
+		execution, err := apply(tx, b.Header)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := state.credit(b.Header.Miner, tx.Fee); err != nil {
+			return nil, err
+		}
+
+		txHash, err := tx.Hash()
+		if err != nil {
+			return nil, err
+		}
+
+		receipt := Receipt{
+			TxHash:     txHash,
+			TxLocation: TxLocation{hash, b.Header.Number, i},
+			Status:     ReceiptStatusSuccess,
+			Fee:        tx.Fee,
+			Asset:      tx.Asset,
+			Balances: map[Account]Amount{
+				tx.From: state.BalanceOf(tx.From, tx.Asset),
+				tx.To:   state.BalanceOf(tx.To, tx.Asset),
+			},
+		}
+		if execution != nil {
+			receipt.setExecution(*execution)
+		}
+		receipts = append(receipts, receipt)
+	}
+
+	return receipts, state.engine.Finalize(state, b)
 }
 
 func (s *State) LatestBlock() Block {
 	return s.latestBlock
 }
 
+// NextBlockHeader is the header of a block extending the state now, the TXs
+// a new block can include are checked against it.
+func (s *State) NextBlockHeader() BlockHeader {
+	return BlockHeader{Parent: s.latestBlockHash, Number: s.NextBlockNumber(), Time: uint64(time.Now().Unix())}
+}
+
 func (s *State) LatestBlockHash() Hash {
 	return s.latestBlockHash
 }
 
+func (s *State) Denomination() Denomination {
+	return s.denomination
+}
+
 func (s *State) NextBlockNumber() uint64 {
 	if !s.hasGenesisBlock {
 		return 0
@@ -207,20 +580,19 @@ func (s *State) NextBlockNumber() uint64 {
 // }
 
 func (s *State) Close() error {
+	if s.indexes != nil {
+		if err := s.indexes.close(); err != nil {
+			return err
+		}
+	}
+
+	s.dbMu.Lock()
+	defer s.dbMu.Unlock()
+
 	return s.dbFile.Close()
 }
 
 func (s *State) GetBlocksAfter(hash Hash) ([]Block, error) {
-	currentOffset, err := s.dbFile.Seek(0, io.SeekCurrent)
-	if err != nil {
-		return nil, err
-	}
-
-	// re-read the whole file from the first byte
-	if _, err := s.dbFile.Seek(0, io.SeekStart); err != nil {
-		return nil, err
-	}
-
 	blocks := []Block{}
 	startCollect := false
 
@@ -228,29 +600,22 @@ func (s *State) GetBlocksAfter(hash Hash) ([]Block, error) {
 		startCollect = true
 	}
 
-	scanner := bufio.NewScanner(s.dbFile)
-
-	for scanner.Scan() {
-		if err := scanner.Err(); err != nil {
-			return nil, err
-		}
-
-		var blockFS BlockFS
-		if err := json.Unmarshal(scanner.Bytes(), &blockFS); err != nil {
-			return nil, err
-		}
-
+	// re-read the whole file from the first byte
+	err := s.forEachBlockFS(func(blockFS BlockFS) (bool, error) {
 		if startCollect {
+			if blockFS.Pruned {
+				return false, errPruned(blockFS.Block.Header.Number, s.PrunedBelow())
+			}
 			blocks = append(blocks, blockFS.Block)
-			continue
+			return true, nil
 		}
 
 		if bytes.Equal(hash[:], blockFS.BlockHash[:]) {
 			startCollect = true
 		}
-	}
-
-	if _, err := s.dbFile.Seek(currentOffset, io.SeekStart); err != nil {
+		return true, nil
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -260,7 +625,7 @@ func (s *State) GetBlocksAfter(hash Hash) ([]Block, error) {
 func (s *State) copy() *State {
 	cp := &State{}
 
-	cp.Balances = make(map[Account]uint)
+	cp.Balances = make(map[Account]Amount)
 	for accout, balance := range s.Balances {
 		cp.Balances[accout] = balance
 	}
@@ -268,6 +633,19 @@ func (s *State) copy() *State {
 	cp.txMempool = make([]SignedTx, len(s.txMempool))
 	cp.txMempool = append(cp.txMempool, s.txMempool...)
 
+	cp.denomination = s.denomination
+	cp.engine = s.engine
+	cp.authority = s.authority.copy()
+	cp.escrows = copyEscrows(s.escrows)
+	cp.tokens = copyTokens(s.tokens)
+	cp.contracts = copyContracts(s.contracts)
+	cp.checkpoints = s.checkpoints
+	cp.forks = s.forks
+	cp.fastSync = s.fastSync
+	cp.sigsChecked = make(map[Hash]bool, len(s.sigsChecked))
+	for hash := range s.sigsChecked {
+		cp.sigsChecked[hash] = true
+	}
 	cp.latestBlock = s.latestBlock
 	cp.latestBlockHash = s.latestBlockHash
 	cp.hasGenesisBlock = s.hasGenesisBlock
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// LockTimeThreshold splits the TX lock values: below it they're block
+// heights, from it on Unix timestamps, as Bitcoin's nLockTime.
+const LockTimeThreshold = 500000000
+
+// maxBlockTimeDrift bounds how far in the future a block time can be, time
+// locks would mean nothing if a miner could pick any block time.
+const maxBlockTimeDrift = 2 * time.Hour
+
+var ErrTxNotYetValid = errors.New("TX isn't valid yet")
+var ErrTxExpired = errors.New("TX expired")
+
+func isLockTime(lock uint64) bool {
+	return lock >= LockTimeThreshold
+}
+
+// lockReached tells whether the block is at or past the lock, a height or a
+// time.
+func lockReached(lock uint64, header BlockHeader) bool {
+	if isLockTime(lock) {
+		return header.Time >= lock
+	}
+	return header.Number >= lock
+}
+
+// CheckValidity checks a block with the given header can include the TX: the
+// block is at or past ValidAfter and before ValidBefore.
+func (tx *TX) CheckValidity(header BlockHeader) error {
+	if tx.ValidAfter != 0 && tx.ValidBefore != 0 && isLockTime(tx.ValidAfter) == isLockTime(tx.ValidBefore) && tx.ValidAfter >= tx.ValidBefore {
+		return fmt.Errorf("wrong TX. Valid after %d isn't before valid before %d", tx.ValidAfter, tx.ValidBefore)
+	}
+	if tx.ValidBefore != 0 && lockReached(tx.ValidBefore, header) {
+		return fmt.Errorf("%w: valid before %d, block %d at %d", ErrTxExpired, tx.ValidBefore, header.Number, header.Time)
+	}
+	if tx.ValidAfter != 0 && !lockReached(tx.ValidAfter, header) {
+		return fmt.Errorf("%w: valid after %d, block %d at %d", ErrTxNotYetValid, tx.ValidAfter, header.Number, header.Time)
+	}
+	return nil
+}
+
+// verifyBlockTime checks the block time doesn't go back from the parent's
+// and isn't too far in the future, from the block time fork on.
+func verifyBlockTime(forks Forks, parent *BlockHeader, header BlockHeader) error {
+	if !forkActive(forks.BlockTime, header.Number) {
+		return nil
+	}
+	if parent != nil && header.Time < parent.Time {
+		return fmt.Errorf("block %d time %d is before its parent time %d", header.Number, header.Time, parent.Time)
+	}
+	if limit := uint64(time.Now().Add(maxBlockTimeDrift).Unix()); header.Time > limit {
+		return fmt.Errorf("block %d time %d is more than %v in the future", header.Number, header.Time, maxBlockTimeDrift)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestTxValidity(t *testing.T) {
+	now := uint64(time.Now().Unix())
+	block := BlockHeader{Number: 10, Time: now}
+
+	for _, c := range []struct {
+		validAfter, validBefore uint64
+		err                     error
+	}{
+		{0, 0, nil},
+		{10, 11, nil},
+		{11, 0, ErrTxNotYetValid},
+		{0, 10, ErrTxExpired},
+		{now, now + 1, nil},
+		{now + 1, 0, ErrTxNotYetValid},
+		{0, now, ErrTxExpired},
+		// a height and a time
+		{5, now + 60, nil},
+		{now - 60, 11, nil},
+	} {
+		tx := TX{ValidAfter: c.validAfter, ValidBefore: c.validBefore}
+		if err := tx.CheckValidity(block); !errors.Is(err, c.err) {
+			t.Fatalf("expected TX valid after %d before %d to give '%v', got '%v'", c.validAfter, c.validBefore, c.err, err)
+		}
+	}
+
+	tx := TX{ValidAfter: 12, ValidBefore: 12}
+	if err := tx.CheckValidity(block); err == nil || errors.Is(err, ErrTxNotYetValid) {
+		t.Fatalf("expected an empty window to be wrong, got '%v'", err)
+	}
+}
+
+func TestTimeLocks(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := Account(crypto.PubkeyToAddress(key.PublicKey))
+	bob, miner := NewAccount("0x02"), NewAccount("0x03")
+
+	state := newTestChainState(t, genesis{
+		Consensus: &ConsensusConfig{Engine: EngineInstant},
+		Balances:  map[Account]Amount{alice: 1000},
+		Forks:     &Forks{BlockTime: forkHeight(1)},
+	})
+
+	parent, err := state.AddBlock(NewBlock(Hash{}, 0, 1, 0, miner, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scheduled := signTestTx(t, TX{From: alice, To: bob, Value: 10, Time: 1, ValidAfter: 2}, key)
+	expired := signTestTx(t, TX{From: alice, To: bob, Value: 20, Time: 2, ValidBefore: 1}, key)
+	plain := signTestTx(t, TX{From: alice, To: bob, Value: 30, Time: 3}, key)
+
+	header := BlockHeader{Parent: parent, Number: 1, Time: 2}
+	valid, rejected := state.FilterTxs([]SignedTx{scheduled, expired, plain}, header)
+	expiredHash, _ := expired.Hash()
+	if len(valid) != 1 || len(rejected) != 1 || !errors.Is(rejected[expiredHash], ErrTxExpired) {
+		t.Fatalf("expected the plain TX valid, the expired one rejected and the scheduled one left out, got %v and %v", valid, rejected)
+	}
+
+	if _, err := state.AddBlock(NewBlock(parent, 1, 2, 0, miner, []SignedTx{scheduled})); !errors.Is(err, ErrTxNotYetValid) {
+		t.Fatalf("expected a block including a TX before its window to be rejected, got '%v'", err)
+	}
+	if parent, err = state.AddBlock(NewBlock(parent, 1, 2, 0, miner, valid)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := state.AddBlock(NewBlock(parent, 2, 1, 0, miner, nil)); err == nil {
+		t.Fatal("expected a block older than its parent to be rejected")
+	}
+	future := uint64(time.Now().Add(maxBlockTimeDrift + time.Minute).Unix())
+	if _, err := state.AddBlock(NewBlock(parent, 2, future, 0, miner, nil)); err == nil {
+		t.Fatal("expected a block too far in the future to be rejected")
+	}
+
+	// blocks before the fork were accepted with any time and still replay
+	if err := verifyBlockTime(Forks{BlockTime: forkHeight(3)}, &BlockHeader{Number: 1, Time: 2}, BlockHeader{Number: 2, Time: 1}); err != nil {
+		t.Fatalf("expected a block older than its parent before the fork to be accepted: %v", err)
+	}
+
+	if _, err := state.AddBlock(NewBlock(parent, 2, 3, 0, miner, []SignedTx{scheduled})); err != nil {
+		t.Fatal(err)
+	}
+	if state.Balances[bob] != 40 {
+		t.Fatalf("expected bob to get the plain and the scheduled TXs, got %d", state.Balances[bob])
+	}
+}
@@ -0,0 +1,218 @@
+package database
+
+import (
+	"fmt"
+)
+
+// The token TX types let an account issue a named fungible token, then
+// control its supply as its issuer. Tokens move with plain transfers setting
+// the TX asset, fees are always paid in the native currency.
+const (
+	TxTypeTokenIssue TxType = "token_issue"
+	TxTypeTokenMint  TxType = "token_mint"
+	TxTypeTokenBurn  TxType = "token_burn"
+)
+
+const maxAssetSymbolLen = 12
+
+// Token is a fungible token identified by its symbol, its amounts have no
+// decimals.
+type Token struct {
+	Issuer   Account            `json:"issuer"`
+	Supply   Amount             `json:"supply"`
+	Balances map[Account]Amount `json:"balances"`
+}
+
+func (t *Token) copy() *Token {
+	cp := &Token{Issuer: t.Issuer, Supply: t.Supply, Balances: make(map[Account]Amount, len(t.Balances))}
+	for account, balance := range t.Balances {
+		cp.Balances[account] = balance
+	}
+	return cp
+}
+
+func copyTokens(tokens map[string]*Token) map[string]*Token {
+	cp := make(map[string]*Token, len(tokens))
+	for symbol, token := range tokens {
+		cp[symbol] = token.copy()
+	}
+	return cp
+}
+
+// ValidateAssetSymbol checks the symbol of a new token: 1 to 12 upper case
+// letters and digits.
+func ValidateAssetSymbol(symbol string) error {
+	if len(symbol) == 0 || len(symbol) > maxAssetSymbolLen {
+		return fmt.Errorf("token symbol must have 1 to %d characters, got '%s'", maxAssetSymbolLen, symbol)
+	}
+	for _, c := range symbol {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return fmt.Errorf("token symbol must be upper case letters and digits, got '%s'", symbol)
+		}
+	}
+	return nil
+}
+
+// Token returns a copy of the token with the given symbol.
+func (s *State) Token(symbol string) (Token, bool) {
+	token, ok := s.tokens[symbol]
+	if !ok {
+		return Token{}, false
+	}
+	return *token.copy(), true
+}
+
+// Tokens returns the symbols of the issued tokens.
+func (s *State) Tokens() []string {
+	symbols := make([]string, 0, len(s.tokens))
+	for symbol := range s.tokens {
+		symbols = append(symbols, symbol)
+	}
+	return symbols
+}
+
+// AssetDenomination returns the denomination of the asset amounts, the
+// native one when the asset is empty.
+func (s *State) AssetDenomination(asset string) (Denomination, error) {
+	if asset == "" {
+		return s.denomination, nil
+	}
+	if _, ok := s.tokens[asset]; !ok {
+		return Denomination{}, fmt.Errorf("unknown token '%s'", asset)
+	}
+	return Denomination{Symbol: asset, Unit: asset}, nil
+}
+
+// BalanceOf returns the account balance in the asset, the native currency
+// when the asset is empty.
+func (s *State) BalanceOf(account Account, asset string) Amount {
+	if asset == "" {
+		return s.Balances[account]
+	}
+	if token, ok := s.tokens[asset]; ok {
+		return token.Balances[account]
+	}
+	return 0
+}
+
+func (s *State) applyToken(tx SignedTx) error {
+	if tx.Asset == "" {
+		return fmt.Errorf("wrong TX. %s TX without asset", tx.Type)
+	}
+	if tx.Type == TxTypeTokenIssue {
+		return s.issueToken(tx)
+	}
+
+	token, ok := s.tokens[tx.Asset]
+	if !ok {
+		return fmt.Errorf("wrong TX. Unknown token '%s'", tx.Asset)
+	}
+	if tx.From != token.Issuer {
+		return fmt.Errorf("wrong TX. Only the issuer %s controls the supply of '%s'", token.Issuer.Hex(), tx.Asset)
+	}
+	if tx.Value == 0 {
+		return fmt.Errorf("wrong TX. %s of no value", tx.Type)
+	}
+
+	if tx.Type == TxTypeTokenMint {
+		supply, err := token.Supply.Add(tx.Value)
+		if err != nil {
+			return fmt.Errorf("wrong TX. Token '%s' supply overflow: %v", tx.Asset, err)
+		}
+		if err := s.payFee(tx); err != nil {
+			return err
+		}
+		token.Supply = supply
+		return s.creditAsset(tx.To, tx.Asset, tx.Value)
+	}
+
+	if tx.To != tx.From {
+		return fmt.Errorf("wrong TX. Token burn can't have a recipient")
+	}
+	if err := s.chargeTx(tx); err != nil {
+		return err
+	}
+	token.Supply -= tx.Value
+	return nil
+}
+
+// issueToken creates the token with the TX sender as issuer, the value is
+// the initial supply credited to the recipient.
+func (s *State) issueToken(tx SignedTx) error {
+	if err := ValidateAssetSymbol(tx.Asset); err != nil {
+		return fmt.Errorf("wrong TX. %v", err)
+	}
+	if tx.Asset == s.denomination.Symbol {
+		return fmt.Errorf("wrong TX. '%s' is the native currency", tx.Asset)
+	}
+	if _, exists := s.tokens[tx.Asset]; exists {
+		return fmt.Errorf("wrong TX. Token '%s' already issued", tx.Asset)
+	}
+
+	if err := s.payFee(tx); err != nil {
+		return err
+	}
+	s.tokens[tx.Asset] = &Token{Issuer: tx.From, Supply: tx.Value, Balances: make(map[Account]Amount)}
+	return s.creditAsset(tx.To, tx.Asset, tx.Value)
+}
+
+// chargeTx debits the TX sender of the value in the TX asset and of the fee
+// in the native currency.
+func (s *State) chargeTx(tx SignedTx) error {
+	if tx.Asset == "" {
+		cost, err := tx.Cost()
+		if err != nil {
+			return fmt.Errorf("wrong TX. %v", err)
+		}
+
+		if s.Balances[tx.From] < cost {
+			return fmt.Errorf("wrong TX. Sender %s balance is %d, but cost is %d", tx.From.Hex(), s.Balances[tx.From], cost)
+		}
+		return s.debit(tx.From, cost)
+	}
+
+	token, ok := s.tokens[tx.Asset]
+	if !ok {
+		return fmt.Errorf("wrong TX. Unknown token '%s'", tx.Asset)
+	}
+	if token.Balances[tx.From] < tx.Value {
+		return fmt.Errorf("wrong TX. Sender %s balance is %d %s, but value is %d", tx.From.Hex(), token.Balances[tx.From], tx.Asset, tx.Value)
+	}
+	if err := s.payFee(tx); err != nil {
+		return err
+	}
+
+	token.Balances[tx.From] -= tx.Value
+	if token.Balances[tx.From] == 0 {
+		delete(token.Balances, tx.From)
+	}
+	return nil
+}
+
+func (s *State) payFee(tx SignedTx) error {
+	if s.Balances[tx.From] < tx.Fee {
+		return fmt.Errorf("wrong TX. Sender %s balance is %d, but fee is %d", tx.From.Hex(), s.Balances[tx.From], tx.Fee)
+	}
+	return s.debit(tx.From, tx.Fee)
+}
+
+// creditAsset credits the account in the asset, the native currency when the
+// asset is empty.
+func (s *State) creditAsset(account Account, asset string, value Amount) error {
+	if asset == "" {
+		return s.credit(account, value)
+	}
+
+	token, ok := s.tokens[asset]
+	if !ok {
+		return fmt.Errorf("wrong TX. Unknown token '%s'", asset)
+	}
+	balance, err := token.Balances[account].Add(value)
+	if err != nil {
+		return fmt.Errorf("wrong TX. Account %s balance of '%s' overflow: %v", account.Hex(), asset, err)
+	}
+	if balance > 0 {
+		token.Balances[account] = balance
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestTokens(t *testing.T) {
+	aliceKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := Account(crypto.PubkeyToAddress(aliceKey.PublicKey))
+	bob := Account(crypto.PubkeyToAddress(bobKey.PublicKey))
+	miner := NewAccount("0x03")
+
+	state := newTestChainState(t, genesis{
+		Consensus: &ConsensusConfig{Engine: EngineInstant},
+		Balances:  map[Account]Amount{alice: 1000, bob: 10},
+	})
+
+	// alice issues 100 GOLD to herself and sends bob 30 of them
+	issue := signTestTx(t, TX{From: alice, To: alice, Value: 100, Asset: "GOLD", Fee: 1, Time: 0, Type: TxTypeTokenIssue}, aliceKey)
+	transfer := signTestTx(t, TX{From: alice, To: bob, Value: 30, Asset: "GOLD", Fee: 1, Time: 1}, aliceKey)
+	parent, err := state.AddBlock(NewBlock(Hash{}, 0, 0, 0, miner, []SignedTx{issue, transfer}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.BalanceOf(alice, "GOLD") != 70 || state.BalanceOf(bob, "GOLD") != 30 {
+		t.Fatalf("expected alice and bob to hold 70 and 30 GOLD, got %d and %d", state.BalanceOf(alice, "GOLD"), state.BalanceOf(bob, "GOLD"))
+	}
+	if state.Balances[alice] != 998 || state.Balances[bob] != 10 {
+		t.Fatalf("expected alice to pay 2 native fees and bob's native balance untouched, got %d and %d", state.Balances[alice], state.Balances[bob])
+	}
+
+	transferHash, _ := transfer.Hash()
+	receipt, ok := state.GetReceipt(transferHash)
+	if !ok || receipt.Asset != "GOLD" || receipt.Balances[bob] != 30 {
+		t.Fatalf("expected the receipt to hold the GOLD balances, got %+v", receipt)
+	}
+
+	for name, tx := range map[string]SignedTx{
+		"a mint by another account":      signTestTx(t, TX{From: bob, To: bob, Value: 5, Asset: "GOLD", Time: 2, Type: TxTypeTokenMint}, bobKey),
+		"a transfer above the balance":   signTestTx(t, TX{From: bob, To: alice, Value: 31, Asset: "GOLD", Time: 2}, bobKey),
+		"a transfer of an unknown token": signTestTx(t, TX{From: bob, To: alice, Value: 1, Asset: "SILVER", Time: 2}, bobKey),
+		"a token issued twice":           signTestTx(t, TX{From: bob, To: bob, Value: 5, Asset: "GOLD", Time: 2, Type: TxTypeTokenIssue}, bobKey),
+		"the native currency issued":     signTestTx(t, TX{From: bob, To: bob, Value: 5, Asset: DefaultDenomination.Symbol, Time: 2, Type: TxTypeTokenIssue}, bobKey),
+		"a wrong symbol":                 signTestTx(t, TX{From: bob, To: bob, Value: 5, Asset: "gold", Time: 2, Type: TxTypeTokenIssue}, bobKey),
+		"a burn to another account":      signTestTx(t, TX{From: alice, To: bob, Value: 5, Asset: "GOLD", Time: 2, Type: TxTypeTokenBurn}, aliceKey),
+		"a burn above the balance":       signTestTx(t, TX{From: alice, To: alice, Value: 71, Asset: "GOLD", Time: 2, Type: TxTypeTokenBurn}, aliceKey),
+		"a token fee above the balance":  signTestTx(t, TX{From: bob, To: alice, Value: 1, Asset: "GOLD", Fee: 11, Time: 2}, bobKey),
+	} {
+		if _, err := state.AddBlock(NewBlock(parent, 1, 1, 0, miner, []SignedTx{tx})); err == nil {
+			t.Fatalf("expected a block with %s to be rejected", name)
+		}
+	}
+
+	// the issuer mints 50 to bob and burns 20 of its own
+	mint := signTestTx(t, TX{From: alice, To: bob, Value: 50, Asset: "GOLD", Time: 2, Type: TxTypeTokenMint}, aliceKey)
+	burn := signTestTx(t, TX{From: alice, To: alice, Value: 20, Asset: "GOLD", Time: 3, Type: TxTypeTokenBurn}, aliceKey)
+	if parent, err = state.AddBlock(NewBlock(parent, 1, 1, 0, miner, []SignedTx{mint, burn})); err != nil {
+		t.Fatal(err)
+	}
+	token, ok := state.Token("GOLD")
+	if !ok || token.Issuer != alice || token.Supply != 130 || token.Balances[alice] != 50 || token.Balances[bob] != 80 {
+		t.Fatalf("expected a supply of 130 GOLD split 50 and 80, got %+v", token)
+	}
+
+	// tokens can be escrowed too
+	hashLock := NewHashLock([]byte("secret"))
+	lock := signTestTx(t, TX{From: bob, To: alice, Value: 80, Asset: "GOLD", Time: 4, Type: TxTypeHTLCLock, HTLC: &HTLC{HashLock: &hashLock, Timeout: 10}}, bobKey)
+	if _, err = state.AddBlock(NewBlock(parent, 2, 2, 0, miner, []SignedTx{lock})); err != nil {
+		t.Fatal(err)
+	}
+	if state.BalanceOf(bob, "GOLD") != 0 {
+		t.Fatalf("expected bob to lock all of his GOLD, got %d", state.BalanceOf(bob, "GOLD"))
+	}
+	id, _ := lock.Hash()
+	claim := signTestTx(t, TX{From: alice, To: alice, Time: 5, Type: TxTypeHTLCClaim, HTLC: &HTLC{Escrow: &id, Preimage: "736563726574"}}, aliceKey)
+	if _, err = state.AddBlock(NewBlock(state.LatestBlockHash(), 3, 3, 0, miner, []SignedTx{claim})); err != nil {
+		t.Fatal(err)
+	}
+	if state.BalanceOf(alice, "GOLD") != 130 {
+		t.Fatalf("expected alice to claim the escrowed GOLD, got %d", state.BalanceOf(alice, "GOLD"))
+	}
+
+	// the tokens survive a restart and snapshots
+	snapshot, err := state.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifySnapshot(state.dataDir, snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	state.Close()
+	state, err = NewStateFromDisk(state.dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	if reloaded, _ := state.Token("GOLD"); reloaded.Supply != 130 || reloaded.Balances[alice] != 130 {
+		t.Fatalf("expected the token reloaded, got %+v", reloaded)
+	}
+}
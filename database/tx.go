@@ -3,26 +3,55 @@ package database
 import (
 	"crypto/sha256"
 	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/ethereum/go-ethereum/crypto"
 )
 
+// TxType selects how a TX is applied, a plain transfer by default.
+type TxType string
+
+const TxTypeTransfer TxType = ""
+
 type TX struct {
 	From  Account `json:"from"`
 	To    Account `json:"to"`
-	Value uint    `json:"value"`
-	Data  string  `json:"data"`
-	Time  uint64  `json:"time"`
+	Value Amount  `json:"value"`
+	// Asset is the symbol of the token the value is in, the native currency
+	// when empty. The fee is always in the native currency.
+	Asset string `json:"asset,omitempty"`
+	Fee   Amount `json:"fee,omitempty"`
+	Data  string `json:"data"`
+	Time  uint64 `json:"time"`
+	// ValidAfter and ValidBefore bound the blocks able to include the TX,
+	// each a block height below LockTimeThreshold, a Unix time from it on,
+	// 0 when unset. The TX is valid from ValidAfter until before ValidBefore.
+	ValidAfter  uint64 `json:"valid_after,omitempty"`
+	ValidBefore uint64 `json:"valid_before,omitempty"`
+	Type        TxType `json:"type,omitempty"`
+	// GasLimit bounds the execution of the contract TX types.
+	GasLimit uint64 `json:"gas_limit,omitempty"`
+	// HTLC holds the parameters of the HTLC TX types.
+	HTLC *HTLC `json:"htlc,omitempty"`
 }
 
 type SignedTx struct {
 	TX
 	Sign []byte `json:"signature"`
+	// Multisig TXs carry the definition of the sender account and its
+	// signers' signatures instead of Sign.
+	Multisig *Multisig `json:"multisig,omitempty"`
+	Signs    [][]byte  `json:"signatures,omitempty"`
+}
+
+func NewTX(from string, to string, value Amount, data string) TX {
+	return TX{From: NewAccount(from), To: NewAccount(to), Value: value, Data: data, Time: uint64(time.Now().Unix())}
 }
 
-func NewTX(from string, to string, value uint, data string) TX {
-	return TX{NewAccount(from), NewAccount(to), value, data, uint64(time.Now().Unix())}
+// Cost is what the sender pays: the value plus the fee going to the miner.
+func (tx *TX) Cost() (Amount, error) {
+	return tx.Value.Add(tx.Fee)
 }
 
 func (tx *TX) IsReward() bool {
@@ -42,12 +71,22 @@ func (tx *TX) Encode() ([]byte, error) {
 }
 
 func (t *SignedTx) IsAuthentic() (bool, error) {
+	if t.Multisig != nil {
+		if err := t.verifyMultisig(); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	if len(t.Signs) > 0 {
+		return false, fmt.Errorf("wrong TX. Sender '%s' isn't a multisig account", t.From.Hex())
+	}
+
 	txEncoded, err := t.TX.Encode()
 	if err != nil {
 		return false, err
 	}
 
-	pubkey, err := crypto.SigToPub(txEncoded[:], t.Sign)
+	pubkey, err := crypto.SigToPub(crypto.Keccak256(txEncoded), t.Sign)
 	if err != nil {
 		return false, err
 	}
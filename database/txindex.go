@@ -0,0 +1,141 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// TxLocation is where a mined transaction was included.
+type TxLocation struct {
+	BlockHash   Hash   `json:"block_hash"`
+	BlockNumber uint64 `json:"block_number"`
+	Index       int    `json:"index"`
+}
+
+// txIndexRecord lists the transactions of one block, in block order.
+type txIndexRecord struct {
+	BlockHash   Hash   `json:"block_hash"`
+	BlockNumber uint64 `json:"block_number"`
+	TXs         []Hash `json:"txs"`
+}
+
+// txIndex maps transaction hashes to the block that included them.
+type txIndex struct {
+	mu sync.RWMutex
+
+	f         *os.File
+	locations map[Hash]TxLocation
+	last      Hash
+}
+
+func openTxIndex(dataDir string) (*txIndex, error) {
+	f, err := openIndexFile(getIndexFilePath(dataDir, "txs"))
+	if err != nil {
+		return nil, err
+	}
+
+	idx := &txIndex{f: f, locations: make(map[Hash]TxLocation)}
+
+	err = readIndexFile(f, func(line []byte) error {
+		var record txIndexRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return err
+		}
+		idx.add(record)
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("Rebuilding transactions index: %v\n", err)
+		return idx, idx.reset()
+	}
+
+	return idx, nil
+}
+
+func (idx *txIndex) name() string {
+	return "txs"
+}
+
+func (idx *txIndex) lastIndexed() Hash {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return idx.last
+}
+
+func (idx *txIndex) indexSnapshot(snapshot Snapshot) error {
+	return idx.append(txIndexRecord{snapshot.Block.BlockHash, snapshot.Number(), []Hash{}})
+}
+
+func (idx *txIndex) indexBlock(block indexedBlock) error {
+	record := txIndexRecord{block.BlockHash, block.Block.Header.Number, make([]Hash, 0, len(block.Block.TXs))}
+
+	for _, tx := range block.Block.TXs {
+		txHash, err := tx.Hash()
+		if err != nil {
+			return err
+		}
+		record.TXs = append(record.TXs, txHash)
+	}
+
+	return idx.append(record)
+}
+
+func (idx *txIndex) reset() error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.locations = make(map[Hash]TxLocation)
+	idx.last = Hash{}
+	return truncateIndexFile(idx.f)
+}
+
+func (idx *txIndex) close() error {
+	return idx.f.Close()
+}
+
+func (idx *txIndex) append(record txIndexRecord) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.add(record)
+	return appendIndexRecord(idx.f, record)
+}
+
+func (idx *txIndex) add(record txIndexRecord) {
+	for i, txHash := range record.TXs {
+		idx.locations[txHash] = TxLocation{record.BlockHash, record.BlockNumber, i}
+	}
+	idx.last = record.BlockHash
+}
+
+func (idx *txIndex) location(txHash Hash) (TxLocation, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	location, ok := idx.locations[txHash]
+	return location, ok
+}
+
+// GetTx looks a mined transaction up by its hash.
+func (s *State) GetTx(txHash Hash) (SignedTx, TxLocation, bool, error) {
+	location, ok := s.indexes.txs.location(txHash)
+	if !ok {
+		return SignedTx{}, TxLocation{}, false, nil
+	}
+
+	blockFS, err := s.GetBlockByHash(location.BlockHash)
+	if err != nil {
+		return SignedTx{}, TxLocation{}, false, err
+	}
+
+	if blockFS.Pruned {
+		return SignedTx{}, TxLocation{}, false, errPruned(location.BlockNumber, s.PrunedBelow())
+	}
+	if location.Index >= len(blockFS.Block.TXs) {
+		return SignedTx{}, TxLocation{}, false, fmt.Errorf("transaction %x is missing from block %x", txHash, location.BlockHash)
+	}
+	return blockFS.Block.TXs[location.Index], location, true, nil
+}
@@ -0,0 +1,190 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+)
+
+// verifyBatch is the number of blocks whose TX signatures are checked in
+// parallel before the blocks are applied.
+const verifyBatch = 256
+
+// ChainProblem is the first block failing the verification.
+type ChainProblem struct {
+	Number uint64 `json:"number"`
+	Hash   Hash   `json:"hash"`
+	Offset int64  `json:"offset"`
+	Reason string `json:"reason"`
+}
+
+type ChainReport struct {
+	Blocks       int           `json:"blocks"`
+	TXs          int           `json:"txs"`
+	LatestNumber uint64        `json:"latest_number"`
+	LatestHash   Hash          `json:"latest_hash"`
+	Problem      *ChainProblem `json:"problem,omitempty"`
+}
+
+// VerifyChain replays blocks.db from genesis and checks every block: its
+// record, parent link and height, its seal, the TX signatures and the balance
+// transition. The report tells the blocks verified and the first bad one.
+// TX signatures are checked by the given number of goroutines, 0 means one per
+// CPU.
+func VerifyChain(dataDir string, workers int) (ChainReport, error) {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	genesis, err := loadGenesis(getGenesisJSONFilePath(dataDir))
+	if err != nil {
+		return ChainReport{}, err
+	}
+
+	f, err := os.Open(getBlocksDBFilePath(dataDir))
+	if err != nil {
+		return ChainReport{}, err
+	}
+	defer f.Close()
+
+	state := newGenesisState(dataDir, genesis, f)
+	report := ChainReport{}
+
+	var prev *BlockFS
+	batch := make([]blockRecord, 0, verifyBatch)
+
+	verify := func() {
+		sigErrs := checkSignatures(batch, workers)
+
+		for i, record := range batch {
+			problem := verifyRecord(state, record, prev, sigErrs[i])
+			if problem != nil {
+				report.Problem = problem
+				return
+			}
+
+			blockFS := record.BlockFS
+			prev = &blockFS
+			report.Blocks++
+			report.TXs += len(blockFS.Block.TXs)
+			report.LatestNumber = blockFS.Block.Header.Number
+			report.LatestHash = blockFS.BlockHash
+		}
+		batch = batch[:0]
+	}
+
+	err = scanBlockRecords(f, func(record blockRecord) (bool, error) {
+		batch = append(batch, record)
+		if len(batch) == verifyBatch {
+			verify()
+		}
+		return report.Problem == nil, nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	if report.Problem == nil && len(batch) > 0 {
+		verify()
+	}
+	return report, nil
+}
+
+func verifyRecord(state *State, record blockRecord, prev *BlockFS, sigErr error) *ChainProblem {
+	problem := &ChainProblem{
+		Number: record.BlockFS.Block.Header.Number,
+		Hash:   record.BlockFS.BlockHash,
+		Offset: record.Offset,
+	}
+
+	if recordProblem := checkBlockRecord(record, prev); recordProblem != nil {
+		problem.Reason = recordProblem.Reason
+		return problem
+	}
+
+	block := record.BlockFS.Block
+	if prev == nil && (block.Header.Number != 0 || !block.Header.Parent.IsEmpty()) {
+		problem.Reason = fmt.Sprintf("blocks.db starts at block %d instead of the genesis block", block.Header.Number)
+		return problem
+	}
+
+	if record.BlockFS.Pruned {
+		problem.Reason = fmt.Sprintf("block %d is pruned, only an archive chain can be verified", block.Header.Number)
+		return problem
+	}
+
+	if sigErr != nil {
+		problem.Reason = fmt.Sprintf("block %d: %v", block.Header.Number, sigErr)
+		return problem
+	}
+
+	// the signatures were checked above
+	state.sigsChecked[record.BlockFS.BlockHash] = true
+	defer delete(state.sigsChecked, record.BlockFS.BlockHash)
+
+	if _, err := applyBlock(state, block); err != nil {
+		problem.Reason = fmt.Sprintf("block %d: %v", block.Header.Number, err)
+		return problem
+	}
+
+	state.latestBlock = block
+	state.latestBlockHash = record.BlockFS.BlockHash
+	state.hasGenesisBlock = true
+
+	return nil
+}
+
+// checkSignatures returns, for each record, the first TX with an invalid
+// signature.
+func checkSignatures(records []blockRecord, workers int) []error {
+	type sigJob struct {
+		record int
+		tx     int
+	}
+
+	errs := make([]error, len(records))
+	firstBad := make([]int, len(records))
+	var mu sync.Mutex
+
+	jobs := make(chan sigJob)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for job := range jobs {
+				tx := records[job.record].BlockFS.Block.TXs[job.tx]
+
+				isAuth, err := tx.IsAuthentic()
+				if err == nil && !isAuth {
+					err = fmt.Errorf("wrong TX. Sender '%s' is forged", tx.From.Hex())
+				}
+				if err == nil {
+					continue
+				}
+
+				mu.Lock()
+				if errs[job.record] == nil || job.tx < firstBad[job.record] {
+					errs[job.record] = fmt.Errorf("TX %d: %v", job.tx, err)
+					firstBad[job.record] = job.tx
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for i, record := range records {
+		if record.Err != nil {
+			continue
+		}
+		for j := range record.BlockFS.Block.TXs {
+			jobs <- sigJob{i, j}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return errs
+}
@@ -0,0 +1,66 @@
+package database
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestVerifyChain(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := Account(crypto.PubkeyToAddress(key.PublicKey))
+	bob, miner := NewAccount("0x02"), NewAccount("0x03")
+
+	state := newTestChainState(t, genesis{
+		Consensus: &ConsensusConfig{Engine: EngineInstant},
+		Balances:  map[Account]Amount{alice: 1000},
+	})
+
+	var parent Hash
+	for i := uint64(0); i < 3; i++ {
+		tx := signTestTx(t, TX{From: alice, To: bob, Value: 10, Time: i}, key)
+		parent, err = state.AddBlock(NewBlock(parent, i, i, 0, miner, []SignedTx{tx, tx}))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := VerifyChain(state.dataDir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Problem != nil || report.Blocks != 3 || report.TXs != 6 || report.LatestHash != parent {
+		t.Fatalf("unexpected report of a valid chain %+v", report)
+	}
+
+	// a block stored without going through AddBlock, its TX is forged
+	forged := signTestTx(t, TX{From: alice, To: bob, Value: 10, Time: 3}, key)
+	forged.Value = 900
+	block := NewBlock(parent, 3, 3, 0, miner, []SignedTx{forged})
+	hash, err := block.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err := encodeBlockFS(BlockFS{BlockHash: hash, Block: block})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := state.persistRecord(record); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err = VerifyChain(state.dataDir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Blocks != 3 || report.Problem == nil || report.Problem.Number != 3 || report.Problem.Hash != hash {
+		t.Fatalf("expected block 3 reported, got %+v", report)
+	}
+	if !strings.Contains(report.Problem.Reason, "forged") {
+		t.Fatalf("expected a forged TX reason, got %q", report.Problem.Reason)
+	}
+}
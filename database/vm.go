@@ -0,0 +1,468 @@
+package database
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The contract VM is a stack machine over uint64 words. An instruction is one
+// opcode byte, PUSH is followed by its 8 bytes big endian operand. Every
+// instruction costs gas, so an execution is bounded by its gas limit, and the
+// VM has no access to anything but its arguments, its contract storage and
+// the block header, so it's deterministic.
+type Opcode byte
+
+const (
+	OpStop Opcode = iota
+	OpPush
+	OpPop
+	OpDup
+	OpSwap
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+	OpEq
+	OpLt
+	OpGt
+	OpNot
+	OpAnd
+	OpOr
+	OpJump
+	OpJumpI
+	OpLoad
+	OpStore
+	OpArg
+	OpArgc
+	OpNumber
+	OpTime
+	OpReturn
+	OpRevert
+)
+
+const (
+	maxCodeSize     = 4096
+	maxStackSize    = 1024
+	maxContractArgs = 16
+	// MaxGasLimit bounds the gas of one contract TX.
+	MaxGasLimit = 1000000
+	// deployGasPerByte is the gas a deploy TX uses per code byte.
+	deployGasPerByte = 10
+)
+
+type opcodeInfo struct {
+	name string
+	gas  uint64
+}
+
+var opcodeInfos = [...]opcodeInfo{
+	OpStop:   {"STOP", 1},
+	OpPush:   {"PUSH", 1},
+	OpPop:    {"POP", 1},
+	OpDup:    {"DUP", 1},
+	OpSwap:   {"SWAP", 1},
+	OpAdd:    {"ADD", 2},
+	OpSub:    {"SUB", 2},
+	OpMul:    {"MUL", 3},
+	OpDiv:    {"DIV", 3},
+	OpMod:    {"MOD", 3},
+	OpEq:     {"EQ", 2},
+	OpLt:     {"LT", 2},
+	OpGt:     {"GT", 2},
+	OpNot:    {"NOT", 2},
+	OpAnd:    {"AND", 2},
+	OpOr:     {"OR", 2},
+	OpJump:   {"JUMP", 4},
+	OpJumpI:  {"JUMPI", 4},
+	OpLoad:   {"LOAD", 20},
+	OpStore:  {"STORE", 100},
+	OpArg:    {"ARG", 2},
+	OpArgc:   {"ARGC", 2},
+	OpNumber: {"NUMBER", 2},
+	OpTime:   {"TIME", 2},
+	OpReturn: {"RETURN", 1},
+	OpRevert: {"REVERT", 1},
+}
+
+var (
+	ErrOutOfGas = errors.New("out of gas")
+	ErrReverted = errors.New("execution reverted")
+)
+
+func (op Opcode) String() string {
+	if int(op) < len(opcodeInfos) {
+		return opcodeInfos[op].name
+	}
+	return fmt.Sprintf("0x%02x", byte(op))
+}
+
+func opcodeSize(op Opcode) int {
+	if op == OpPush {
+		return 9
+	}
+	return 1
+}
+
+// ValidateCode checks the contract code has known opcodes only and no
+// truncated PUSH, it returns the offsets of its instructions, the valid jump
+// destinations.
+func ValidateCode(code []byte) (map[uint64]bool, error) {
+	if len(code) == 0 || len(code) > maxCodeSize {
+		return nil, fmt.Errorf("contract code must have 1 to %d bytes, got %d", maxCodeSize, len(code))
+	}
+
+	instructions := make(map[uint64]bool)
+	for pc := 0; pc < len(code); {
+		op := Opcode(code[pc])
+		if int(op) >= len(opcodeInfos) {
+			return nil, fmt.Errorf("unknown opcode %s at %d", op, pc)
+		}
+		if pc+opcodeSize(op) > len(code) {
+			return nil, fmt.Errorf("truncated %s at %d", op, pc)
+		}
+		instructions[uint64(pc)] = true
+		pc += opcodeSize(op)
+	}
+	return instructions, nil
+}
+
+// vm executes one contract call.
+type vm struct {
+	code    []byte
+	jumps   map[uint64]bool
+	args    []uint64
+	storage map[uint64]uint64
+	header  BlockHeader
+
+	gasLimit uint64
+	gasUsed  uint64
+	stack    []uint64
+}
+
+// runContract executes the code, it writes to the given storage and returns
+// the values of RETURN. The gas used is returned on failures too.
+func runContract(code []byte, args []uint64, storage map[uint64]uint64, header BlockHeader, gasLimit uint64) ([]uint64, uint64, error) {
+	jumps, err := ValidateCode(code)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	m := &vm{code: code, jumps: jumps, args: args, storage: storage, header: header, gasLimit: gasLimit}
+	ret, err := m.run()
+	return ret, m.gasUsed, err
+}
+
+func (m *vm) run() ([]uint64, error) {
+	for pc := uint64(0); pc < uint64(len(m.code)); {
+		op := Opcode(m.code[pc])
+		if m.gasUsed+opcodeInfos[op].gas > m.gasLimit {
+			m.gasUsed = m.gasLimit
+			return nil, ErrOutOfGas
+		}
+		m.gasUsed += opcodeInfos[op].gas
+
+		next := pc + uint64(opcodeSize(op))
+		switch op {
+		case OpStop:
+			return nil, nil
+		case OpPush:
+			if err := m.push(binary.BigEndian.Uint64(m.code[pc+1 : next])); err != nil {
+				return nil, err
+			}
+		case OpPop:
+			if _, err := m.pop(); err != nil {
+				return nil, err
+			}
+		case OpDup:
+			a, err := m.pop()
+			if err != nil {
+				return nil, err
+			}
+			if err := m.push(a, a); err != nil {
+				return nil, err
+			}
+		case OpSwap:
+			b, a, err := m.pop2()
+			if err != nil {
+				return nil, err
+			}
+			if err := m.push(b, a); err != nil {
+				return nil, err
+			}
+		case OpAdd, OpSub, OpMul, OpDiv, OpMod, OpEq, OpLt, OpGt, OpAnd, OpOr:
+			b, a, err := m.pop2()
+			if err != nil {
+				return nil, err
+			}
+			r, err := binaryOp(op, a, b)
+			if err != nil {
+				return nil, fmt.Errorf("%s at %d: %v", op, pc, err)
+			}
+			if err := m.push(r); err != nil {
+				return nil, err
+			}
+		case OpNot:
+			a, err := m.pop()
+			if err != nil {
+				return nil, err
+			}
+			if err := m.push(boolWord(a == 0)); err != nil {
+				return nil, err
+			}
+		case OpJump, OpJumpI:
+			dest, err := m.pop()
+			if err != nil {
+				return nil, err
+			}
+			if op == OpJumpI {
+				cond, err := m.pop()
+				if err != nil {
+					return nil, err
+				}
+				if cond == 0 {
+					break
+				}
+			}
+			if !m.jumps[dest] {
+				return nil, fmt.Errorf("%s at %d to %d, not an instruction", op, pc, dest)
+			}
+			next = dest
+		case OpLoad:
+			key, err := m.pop()
+			if err != nil {
+				return nil, err
+			}
+			if err := m.push(m.storage[key]); err != nil {
+				return nil, err
+			}
+		case OpStore:
+			key, value, err := m.pop2()
+			if err != nil {
+				return nil, err
+			}
+			if value == 0 {
+				delete(m.storage, key)
+			} else {
+				m.storage[key] = value
+			}
+		case OpArg:
+			i, err := m.pop()
+			if err != nil {
+				return nil, err
+			}
+			if i >= uint64(len(m.args)) {
+				return nil, fmt.Errorf("ARG at %d: argument %d of %d", pc, i, len(m.args))
+			}
+			if err := m.push(m.args[i]); err != nil {
+				return nil, err
+			}
+		case OpArgc:
+			if err := m.push(uint64(len(m.args))); err != nil {
+				return nil, err
+			}
+		case OpNumber:
+			if err := m.push(m.header.Number); err != nil {
+				return nil, err
+			}
+		case OpTime:
+			if err := m.push(m.header.Time); err != nil {
+				return nil, err
+			}
+		case OpReturn:
+			n, err := m.pop()
+			if err != nil {
+				return nil, err
+			}
+			if n > uint64(len(m.stack)) {
+				return nil, fmt.Errorf("RETURN at %d of %d values, stack has %d", pc, n, len(m.stack))
+			}
+			return m.stack[uint64(len(m.stack))-n:], nil
+		case OpRevert:
+			return nil, ErrReverted
+		}
+		pc = next
+	}
+	return nil, nil
+}
+
+func (m *vm) push(words ...uint64) error {
+	if len(m.stack)+len(words) > maxStackSize {
+		return fmt.Errorf("stack overflow")
+	}
+	m.stack = append(m.stack, words...)
+	return nil
+}
+
+func (m *vm) pop() (uint64, error) {
+	if len(m.stack) == 0 {
+		return 0, fmt.Errorf("stack underflow")
+	}
+	top := m.stack[len(m.stack)-1]
+	m.stack = m.stack[:len(m.stack)-1]
+	return top, nil
+}
+
+// pop2 pops the top of the stack then the word below it.
+func (m *vm) pop2() (uint64, uint64, error) {
+	if len(m.stack) < 2 {
+		return 0, 0, fmt.Errorf("stack underflow")
+	}
+	top, below := m.stack[len(m.stack)-1], m.stack[len(m.stack)-2]
+	m.stack = m.stack[:len(m.stack)-2]
+	return top, below, nil
+}
+
+// binaryOp applies op to a, pushed first, and b. Arithmetic overflows fail
+// rather than wrap around, as Amount does.
+func binaryOp(op Opcode, a, b uint64) (uint64, error) {
+	switch op {
+	case OpAdd:
+		if a+b < a {
+			return 0, fmt.Errorf("overflow")
+		}
+		return a + b, nil
+	case OpSub:
+		if b > a {
+			return 0, fmt.Errorf("underflow")
+		}
+		return a - b, nil
+	case OpMul:
+		if a != 0 && (a*b)/a != b {
+			return 0, fmt.Errorf("overflow")
+		}
+		return a * b, nil
+	case OpDiv, OpMod:
+		if b == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		if op == OpDiv {
+			return a / b, nil
+		}
+		return a % b, nil
+	case OpEq:
+		return boolWord(a == b), nil
+	case OpLt:
+		return boolWord(a < b), nil
+	case OpGt:
+		return boolWord(a > b), nil
+	case OpAnd:
+		return boolWord(a != 0 && b != 0), nil
+	case OpOr:
+		return boolWord(a != 0 || b != 0), nil
+	}
+	return 0, fmt.Errorf("not a binary opcode")
+}
+
+func boolWord(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Assemble compiles contract assembly into code: one instruction per line,
+// '#' starts a comment, 'name:' labels the next instruction and PUSH takes a
+// decimal number or a label, e.g.
+//
+//	PUSH 0
+//	LOAD
+//	PUSH 1
+//	ADD
+//	PUSH 0
+//	STORE
+func Assemble(src string) ([]byte, error) {
+	type line struct {
+		no      int
+		op      Opcode
+		operand string
+	}
+
+	opcodes := make(map[string]Opcode, len(opcodeInfos))
+	for op, info := range opcodeInfos {
+		opcodes[info.name] = Opcode(op)
+	}
+
+	var lines []line
+	labels := make(map[string]uint64)
+	offset := uint64(0)
+	for i, text := range strings.Split(src, "\n") {
+		if j := strings.IndexByte(text, '#'); j >= 0 {
+			text = text[:j]
+		}
+		fields := strings.Fields(text)
+
+		for len(fields) > 0 && strings.HasSuffix(fields[0], ":") {
+			label := strings.TrimSuffix(fields[0], ":")
+			if _, exists := labels[label]; exists || label == "" {
+				return nil, fmt.Errorf("line %d: wrong or duplicate label '%s'", i+1, label)
+			}
+			labels[label] = offset
+			fields = fields[1:]
+		}
+		if len(fields) == 0 {
+			continue
+		}
+
+		op, ok := opcodes[strings.ToUpper(fields[0])]
+		if !ok {
+			return nil, fmt.Errorf("line %d: unknown instruction '%s'", i+1, fields[0])
+		}
+		if (op == OpPush) != (len(fields) == 2) || len(fields) > 2 {
+			return nil, fmt.Errorf("line %d: only PUSH takes one operand", i+1)
+		}
+
+		l := line{no: i + 1, op: op}
+		if op == OpPush {
+			l.operand = fields[1]
+		}
+		lines = append(lines, l)
+		offset += uint64(opcodeSize(op))
+	}
+
+	code := make([]byte, 0, offset)
+	for _, l := range lines {
+		code = append(code, byte(l.op))
+		if l.op != OpPush {
+			continue
+		}
+
+		value, ok := labels[l.operand]
+		if !ok {
+			var err error
+			if value, err = strconv.ParseUint(l.operand, 10, 64); err != nil {
+				return nil, fmt.Errorf("line %d: '%s' is neither a number nor a label", l.no, l.operand)
+			}
+		}
+		var operand [8]byte
+		binary.BigEndian.PutUint64(operand[:], value)
+		code = append(code, operand[:]...)
+	}
+
+	if _, err := ValidateCode(code); err != nil {
+		return nil, err
+	}
+	return code, nil
+}
+
+// ParseContractArgs parses the arguments of a contract call, the TX data
+// holding whitespace separated decimal numbers.
+func ParseContractArgs(data string) ([]uint64, error) {
+	fields := strings.Fields(data)
+	if len(fields) > maxContractArgs {
+		return nil, fmt.Errorf("a contract call takes up to %d arguments, got %d", maxContractArgs, len(fields))
+	}
+
+	args := make([]uint64, len(fields))
+	for i, field := range fields {
+		arg, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("contract argument %d '%s' isn't a number", i, field)
+		}
+		args[i] = arg
+	}
+	return args, nil
+}
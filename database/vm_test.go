@@ -0,0 +1,107 @@
+package database
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRunContract(t *testing.T) {
+	// sums the arguments into storage key 0 and returns the sum and the count
+	sum := `
+		PUSH 0          # i
+	loop:
+		DUP
+		ARGC
+		LT
+		NOT
+		PUSH done
+		JUMPI
+		DUP
+		ARG
+		PUSH 0
+		LOAD
+		ADD
+		PUSH 0
+		STORE
+		PUSH 1
+		ADD
+		PUSH loop
+		JUMP
+	done:
+		PUSH 0
+		LOAD
+		SWAP
+		PUSH 2
+		RETURN
+	`
+	code, err := Assemble(sum)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storage := map[uint64]uint64{0: 10}
+	ret, gasUsed, err := runContract(code, []uint64{1, 2, 3}, storage, BlockHeader{}, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ret, []uint64{16, 3}) || storage[0] != 16 {
+		t.Fatalf("expected to return 16 and 3 and store 16, got %v and %v", ret, storage)
+	}
+
+	// the same execution always uses the same gas, and fails without enough
+	if _, _, err := runContract(code, []uint64{1, 2, 3}, map[uint64]uint64{}, BlockHeader{}, gasUsed-1); !errors.Is(err, ErrOutOfGas) {
+		t.Fatalf("expected to run out of gas below %d, got '%v'", gasUsed, err)
+	}
+	if _, used, err := runContract(code, []uint64{1, 2, 3}, map[uint64]uint64{}, BlockHeader{}, gasUsed); err != nil || used != gasUsed {
+		t.Fatalf("expected to run with exactly %d gas, got %d and '%v'", gasUsed, used, err)
+	}
+
+	loop, err := Assemble("start: PUSH start\nJUMP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, used, err := runContract(loop, nil, map[uint64]uint64{}, BlockHeader{}, 5000); !errors.Is(err, ErrOutOfGas) || used != 5000 {
+		t.Fatalf("expected an endless loop to use up its gas, got %d and '%v'", used, err)
+	}
+
+	for src, expected := range map[string]error{
+		"REVERT":              ErrReverted,
+		"PUSH 1\nPUSH 0\nDIV": nil,
+		"PUSH 0\nPUSH 1\nSUB": nil,
+		"ADD":                 nil,
+		"PUSH 1\nARG":         nil,
+		"PUSH 3\nJUMP":        nil,
+	} {
+		code, err := Assemble(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := runContract(code, nil, map[uint64]uint64{}, BlockHeader{}, 100); err == nil || (expected != nil && !errors.Is(err, expected)) {
+			t.Fatalf("expected '%s' to fail, got '%v'", src, err)
+		}
+	}
+}
+
+func TestAssemble(t *testing.T) {
+	code, err := Assemble("top: PUSH top # comment\n\nnumber")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(code, []byte{byte(OpPush), 0, 0, 0, 0, 0, 0, 0, 0, byte(OpNumber)}) {
+		t.Fatalf("unexpected code %x", code)
+	}
+
+	for _, src := range []string{"", "FOO", "PUSH", "PUSH nowhere", "ADD 1", "a: a: STOP"} {
+		if _, err := Assemble(src); err == nil {
+			t.Fatalf("expected '%s' not to assemble", src)
+		}
+	}
+
+	if _, err := ValidateCode([]byte{byte(OpPush), 1}); err == nil {
+		t.Fatal("expected a truncated PUSH to be wrong")
+	}
+	if _, err := ValidateCode([]byte{0xff}); err == nil {
+		t.Fatal("expected an unknown opcode to be wrong")
+	}
+}
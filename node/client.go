@@ -0,0 +1,148 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/1412335/the-blockchain-bar/database"
+)
+
+const endpointAddTx = "/tx/add"
+const endpointSubmitTx = "/tx/submit"
+
+// SendTx submits a transaction to the node listening at address (ip:port).
+func SendTx(ctx context.Context, address string, txAddReq TxAddReq) (TxAddRes, error) {
+	reqJSON, err := json.Marshal(txAddReq)
+	if err != nil {
+		return TxAddRes{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://%s%s", address, endpointAddTx), bytes.NewReader(reqJSON))
+	if err != nil {
+		return TxAddRes{}, err
+	}
+
+	var txAddRes TxAddRes
+	if err := doRequest(req, &txAddRes); err != nil {
+		return TxAddRes{}, err
+	}
+	return txAddRes, nil
+}
+
+// SubmitTx submits a transaction signed by the caller, e.g. a co-signed
+// multisig transaction, to the node listening at address.
+func SubmitTx(ctx context.Context, address string, tx database.SignedTx) (TxAddRes, error) {
+	reqJSON, err := json.Marshal(tx)
+	if err != nil {
+		return TxAddRes{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://%s%s", address, endpointSubmitTx), bytes.NewReader(reqJSON))
+	if err != nil {
+		return TxAddRes{}, err
+	}
+
+	var txAddRes TxAddRes
+	if err := doRequest(req, &txAddRes); err != nil {
+		return TxAddRes{}, err
+	}
+	return txAddRes, nil
+}
+
+// QueryTx looks a transaction up on the node listening at address.
+func QueryTx(ctx context.Context, address string, hash database.Hash) (TxRes, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s%s%x", address, endpointTx, hash), nil)
+	if err != nil {
+		return TxRes{}, err
+	}
+
+	var txRes TxRes
+	if err := doRequest(req, &txRes); err != nil {
+		return TxRes{}, err
+	}
+	return txRes, nil
+}
+
+// QueryEscrow looks an HTLC escrow up on the node listening at address.
+func QueryEscrow(ctx context.Context, address string, id database.Hash) (EscrowRes, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s%s%x", address, endpointEscrow, id), nil)
+	if err != nil {
+		return EscrowRes{}, err
+	}
+
+	var escrowRes EscrowRes
+	if err := doRequest(req, &escrowRes); err != nil {
+		return EscrowRes{}, err
+	}
+	return escrowRes, nil
+}
+
+// QueryContract looks a contract up on the node listening at address.
+func QueryContract(ctx context.Context, address string, account database.Account) (ContractRes, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s%s%s", address, endpointContract, account.Hex()), nil)
+	if err != nil {
+		return ContractRes{}, err
+	}
+
+	var contractRes ContractRes
+	if err := doRequest(req, &contractRes); err != nil {
+		return ContractRes{}, err
+	}
+	return contractRes, nil
+}
+
+// WaitForReceipt polls the node until the transaction is mined with at least
+// the given number of confirmations. It fails if the node drops the
+// transaction.
+func WaitForReceipt(ctx context.Context, address string, hash database.Hash, confirmations uint64, interval time.Duration) (TxRes, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		txRes, err := QueryTx(ctx, address, hash)
+		if err != nil {
+			return TxRes{}, err
+		}
+
+		switch {
+		case txRes.Status == TxStatusFailed:
+			return txRes, fmt.Errorf("transaction %x failed: %s", hash, txRes.Error)
+		case txRes.Status == TxStatusMined && txRes.Receipt != nil && txRes.Confirmations >= confirmations:
+			return txRes, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return txRes, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func doRequest(req *http.Request, res interface{}) error {
+	r, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+
+	rBodyJSON, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+
+	if r.StatusCode != http.StatusOK {
+		var errRes ErrRes
+		if err := json.Unmarshal(rBodyJSON, &errRes); err != nil || errRes.Error == "" {
+			return fmt.Errorf("node responded %s", r.Status)
+		}
+		return fmt.Errorf("node: %s", errRes.Error)
+	}
+
+	return json.Unmarshal(rBodyJSON, res)
+}
@@ -0,0 +1,24 @@
+package node
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+const endpointExplorer = "/explorer/"
+
+// explorerFS holds the web block explorer, a static page browsing the chain
+// through the node's own HTTP API.
+//
+//go:embed explorer
+var explorerFS embed.FS
+
+func explorerHandler() (http.Handler, error) {
+	files, err := fs.Sub(explorerFS, "explorer")
+	if err != nil {
+		return nil, err
+	}
+
+	return http.StripPrefix(endpointExplorer, http.FileServer(http.FS(files))), nil
+}
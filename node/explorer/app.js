@@ -0,0 +1,237 @@
+// The explorer is a single page rendering the node's HTTP API, routed by the
+// URL fragment: #/, #/block/{height|hash}, #/tx/{hash}, #/account/{address}
+// and #/node.
+(function () {
+  "use strict";
+
+  var content = document.getElementById("content");
+  var denomination = { symbol: "TBB", decimals: 0 };
+
+  function api(path) {
+    return fetch(path).then(function (res) {
+      return res.json().then(function (body) {
+        if (!res.ok || body.error) {
+          throw new Error(body.error || res.statusText);
+        }
+        return body;
+      });
+    });
+  }
+
+  function esc(value) {
+    return String(value).replace(/[&<>"']/g, function (c) {
+      return { "&": "&amp;", "<": "&lt;", ">": "&gt;", '"': "&quot;", "'": "&#39;" }[c];
+    });
+  }
+
+  function link(route, text) {
+    return '<a href="#/' + esc(route) + '" class="hash">' + esc(text) + "</a>";
+  }
+
+  function amount(value) {
+    var units = BigInt(value || 0);
+    var scale = BigInt(10) ** BigInt(denomination.decimals);
+    var text = (units / scale).toString();
+    if (denomination.decimals > 0) {
+      text += "." + (units % scale).toString().padStart(denomination.decimals, "0");
+    }
+    return esc(text + " " + denomination.symbol);
+  }
+
+  function time(seconds) {
+    return esc(new Date(seconds * 1000).toLocaleString());
+  }
+
+  function table(headers, rows) {
+    return "<table><tr>" + headers.map(function (h) { return "<th>" + esc(h) + "</th>"; }).join("") + "</tr>" +
+      rows.map(function (row) { return "<tr><td>" + row.join("</td><td>") + "</td></tr>"; }).join("") +
+      "</table>";
+  }
+
+  function fields(rows) {
+    return "<table>" + rows.map(function (row) {
+      return "<tr><th>" + esc(row[0]) + "</th><td>" + row[1] + "</td></tr>";
+    }).join("") + "</table>";
+  }
+
+  function txRows(txs) {
+    return txs.map(function (tx) {
+      return [
+        tx.hash ? link("tx/" + tx.hash, tx.hash.slice(0, 16) + "…") : "",
+        link("account/" + tx.from, tx.from),
+        link("account/" + tx.to, tx.to),
+        amount(tx.value),
+        amount(tx.fee),
+        esc(tx.data),
+        time(tx.time),
+      ];
+    });
+  }
+
+  var txHeaders = ["Hash", "From", "To", "Value", "Fee", "Data", "Time"];
+
+  function showBlocks(to) {
+    var query = to === undefined ? "" : "?to=" + to;
+    return api("/blocks" + query).then(function (res) {
+      var blocks = res.blocks.slice().reverse();
+      var html = "<h2>Recent blocks</h2>" + table(
+        ["Height", "Hash", "Time", "Miner", "TXs", "Fees", "Size"],
+        blocks.map(function (b) {
+          return [
+            link("block/" + b.number, b.number),
+            link("block/" + b.hash, b.hash.slice(0, 24) + "…"),
+            time(b.block.header.time),
+            link("account/" + b.miner, b.miner),
+            esc(b.tx_count),
+            amount(b.total_fees),
+            esc(b.size) + " B",
+          ];
+        })
+      );
+      if (blocks.length > 0 && blocks[blocks.length - 1].number > 0) {
+        html += '<a href="#/blocks/' + (blocks[blocks.length - 1].number - 1) + '">Older blocks</a>';
+      }
+      content.innerHTML = html;
+    });
+  }
+
+  function showBlock(ref) {
+    var path = /^\d+$/.test(ref) ? "/blocks/" + ref : "/blocks/hash/" + ref;
+    return api(path).then(function (b) {
+      var header = b.block.header;
+      var txs = b.block.payload || [];
+      content.innerHTML = "<h2>Block " + esc(b.number) + "</h2>" + fields([
+        ["Hash", '<span class="hash">' + esc(b.hash) + "</span>"],
+        ["Parent", link("block/" + header.parent, header.parent)],
+        ["Time", time(header.time)],
+        ["Miner", link("account/" + b.miner, b.miner)],
+        ["Nonce", esc(header.nonce)],
+        ["Size", esc(b.size) + " B"],
+        ["Total fees", amount(b.total_fees)],
+        ["Confirmations", esc(b.confirmations)],
+      ]) + "<h3>Transactions (" + esc(b.tx_count) + ")</h3>" + table(txHeaders, txRows(txs));
+    });
+  }
+
+  function showTx(hash) {
+    return api("/tx/" + hash).then(function (res) {
+      var rows = [
+        ["Hash", '<span class="hash">' + esc(res.hash) + "</span>"],
+        ["Status", esc(res.status)],
+      ];
+      if (res.block_hash) {
+        rows.push(["Block", link("block/" + res.block_number, res.block_number)]);
+        rows.push(["Confirmations", esc(res.confirmations)]);
+      }
+      if (res.tx) {
+        rows.push(["From", link("account/" + res.tx.from, res.tx.from)]);
+        rows.push(["To", link("account/" + res.tx.to, res.tx.to)]);
+        rows.push(["Value", amount(res.tx.value)]);
+        rows.push(["Fee", amount(res.tx.fee)]);
+        rows.push(["Data", esc(res.tx.data)]);
+        rows.push(["Time", time(res.tx.time)]);
+      }
+      content.innerHTML = "<h2>Transaction</h2>" + fields(rows);
+    });
+  }
+
+  function showAccount(account, cursors) {
+    cursors = cursors || [""];
+    var cursor = cursors[cursors.length - 1];
+    return Promise.all([
+      api("/balances/list?account=" + encodeURIComponent(account)),
+      api("/accounts/" + encodeURIComponent(account) + "/txs?cursor=" + encodeURIComponent(cursor)),
+    ]).then(function (results) {
+      var balances = results[0], history = results[1];
+      var balance = 0;
+      Object.keys(balances.balances).forEach(function (a) {
+        if (a.toLowerCase() === account.toLowerCase()) {
+          balance = balances.balances[a];
+        }
+      });
+
+      var txs = history.txs.map(function (t) {
+        return Object.assign({}, t.tx, { hash: t.hash });
+      });
+
+      content.innerHTML = "<h2>Account</h2>" + fields([
+        ["Address", '<span class="hash">' + esc(account) + "</span>"],
+        ["Balance", amount(balance)],
+        ["At block", link("block/" + balances.number, balances.number)],
+      ]) + "<h3>Transactions</h3>" + table(txHeaders, txRows(txs)) +
+        (cursors.length > 1 ? '<button id="newer">Newer</button>' : "") +
+        (history.next_cursor ? '<button id="older">Older</button>' : "");
+
+      var newer = document.getElementById("newer");
+      if (newer) {
+        newer.onclick = function () { render(showAccount(account, cursors.slice(0, -1))); };
+      }
+      var older = document.getElementById("older");
+      if (older) {
+        older.onclick = function () { render(showAccount(account, cursors.concat(history.next_cursor))); };
+      }
+    });
+  }
+
+  function showNode() {
+    return api("/node/status").then(function (status) {
+      var peers = Object.keys(status.known_peers || {}).map(function (addr) {
+        var peer = status.known_peers[addr];
+        return [esc(addr), peer.is_bootstrap ? "yes" : "no"];
+      });
+      content.innerHTML = "<h2>Node</h2>" + fields([
+        ["Height", link("block/" + status.block_number, status.block_number)],
+        ["Hash", link("block/" + status.block_hash, status.block_hash)],
+      ]) + "<h3>Mempool (" + esc((status.pending_txs || []).length) + ")</h3>" +
+        table(txHeaders, txRows(status.pending_txs || [])) +
+        "<h3>Peers (" + esc(peers.length) + ")</h3>" + table(["Address", "Bootstrap"], peers);
+    });
+  }
+
+  function render(promise) {
+    promise.catch(function (err) {
+      content.innerHTML = '<p class="error">' + esc(err.message) + "</p>";
+    });
+  }
+
+  function route() {
+    var parts = location.hash.replace(/^#\/?/, "").split("/");
+    switch (parts[0]) {
+      case "blocks":
+        return showBlocks(parseInt(parts[1], 10) || 0);
+      case "block":
+        return showBlock(parts[1]);
+      case "tx":
+        return showTx(parts[1]);
+      case "account":
+        return showAccount(parts[1]);
+      case "node":
+        return showNode();
+      default:
+        return showBlocks();
+    }
+  }
+
+  document.getElementById("search").onsubmit = function (e) {
+    e.preventDefault();
+    var q = this.q.value.trim();
+    if (/^\d+$/.test(q)) {
+      location.hash = "#/block/" + q;
+    } else if (/^0x[0-9a-fA-F]{40}$/.test(q)) {
+      location.hash = "#/account/" + q;
+    } else {
+      // a 32 bytes hash is either a block or a transaction
+      api("/blocks/hash/" + q).then(function () {
+        location.hash = "#/block/" + q;
+      }, function () {
+        location.hash = "#/tx/" + q;
+      });
+    }
+  };
+
+  window.onhashchange = function () { render(route()); };
+
+  render(api("/balances/list").then(function (res) {
+    denomination = res.denomination;
+  }).then(route));
+})();
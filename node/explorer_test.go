@@ -0,0 +1,44 @@
+package node
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExplorerHandler(t *testing.T) {
+	explorer, err := explorerHandler()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := ioutil.ReadFile("explorer/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, contentType := range map[string]string{
+		endpointExplorer:                "text/html",
+		endpointExplorer + "app.js":     "javascript",
+		endpointExplorer + "style.css":  "text/css",
+		endpointExplorer + "missing.js": "",
+	} {
+		recorder := httptest.NewRecorder()
+		explorer.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if contentType == "" {
+			if recorder.Code != http.StatusNotFound {
+				t.Fatalf("expected %s not to be found, got status %d", path, recorder.Code)
+			}
+			continue
+		}
+		if recorder.Code != http.StatusOK || !strings.Contains(recorder.Header().Get("Content-Type"), contentType) {
+			t.Fatalf("expected %s served as %s, got status %d and '%s'", path, contentType, recorder.Code, recorder.Header().Get("Content-Type"))
+		}
+		if path == endpointExplorer && recorder.Body.String() != string(index) {
+			t.Fatalf("expected %s to serve the embedded index", path)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/1412335/the-blockchain-bar/database"
 	"github.com/1412335/the-blockchain-bar/wallet"
@@ -17,21 +18,121 @@ type ErrRes struct {
 }
 
 type BalancesRes struct {
-	Hash     database.Hash             `json:"hash"`
-	Balances map[database.Account]uint `json:"balances"`
+	Hash         database.Hash                        `json:"hash"`
+	Number       uint64                               `json:"number"`
+	Denomination database.Denomination                `json:"denomination"`
+	Balances     map[database.Account]database.Amount `json:"balances"`
+	// Asset, Issuer and Supply are set for the balances of a token.
+	Asset  string            `json:"asset,omitempty"`
+	Issuer *database.Account `json:"issuer,omitempty"`
+	Supply database.Amount   `json:"supply,omitempty"`
 }
 
+// TxAddReq carries the value either in the smallest unit (Value) or as a
+// decimal string in currency units (Amount, e.g. "1.5").
 type TxAddReq struct {
-	From    string `json:"from"`
-	FromPwd string `json:"from_pwd"`
-	To      string `json:"to"`
-	Value   uint   `json:"value"`
-	Data    string `json:"data"`
+	From    string          `json:"from"`
+	FromPwd string          `json:"from_pwd"`
+	To      string          `json:"to"`
+	Value   database.Amount `json:"value"`
+	Amount  string          `json:"amount,omitempty"`
+	Fee     database.Amount `json:"fee"`
+	Data    string          `json:"data"`
+	// ValidAfter and ValidBefore are block heights or Unix times, see
+	// database.TX.
+	ValidAfter  uint64 `json:"valid_after,omitempty"`
+	ValidBefore uint64 `json:"valid_before,omitempty"`
+	// Asset is the token symbol of the value, the native currency when
+	// empty.
+	Asset string `json:"asset,omitempty"`
+	// Type, HTLC and GasLimit build the HTLC, token and contract TXs, a
+	// claim, a refund, a burn or a deploy needs no To.
+	Type     database.TxType `json:"type,omitempty"`
+	HTLC     *database.HTLC  `json:"htlc,omitempty"`
+	GasLimit uint64          `json:"gas_limit,omitempty"`
 }
 
 type TxAddRes struct {
-	// Hash    database.Hash `json:"block_hash"`
-	Success bool `json:"success"`
+	Hash    database.Hash `json:"hash"`
+	Success bool          `json:"success"`
+}
+
+const (
+	TxStatusPending = "pending"
+	TxStatusMined   = "mined"
+	TxStatusFailed  = "failed"
+	TxStatusUnknown = "unknown"
+)
+
+type TxRes struct {
+	Hash   database.Hash      `json:"hash"`
+	Status string             `json:"status"`
+	Tx     *database.SignedTx `json:"tx,omitempty"`
+	*database.TxLocation
+	Confirmations uint64            `json:"confirmations"`
+	Receipt       *database.Receipt `json:"receipt,omitempty"`
+	// Error is why a failed transaction was dropped from the mempool.
+	Error string `json:"error,omitempty"`
+}
+
+type AccountTxsRes struct {
+	Account    database.Account     `json:"account"`
+	TXs        []database.AccountTx `json:"txs"`
+	NextCursor string               `json:"next_cursor"`
+}
+
+type BlockRes struct {
+	Hash          database.Hash    `json:"hash"`
+	Number        uint64           `json:"number"`
+	Size          int              `json:"size"`
+	TxCount       int              `json:"tx_count"`
+	Miner         database.Account `json:"miner"`
+	TotalFees     database.Amount  `json:"total_fees"`
+	Confirmations uint64           `json:"confirmations"`
+	// Pruned blocks, and every block of a light node, only have their header,
+	// TxCount and TotalFees are unknown.
+	Pruned bool           `json:"pruned,omitempty"`
+	Block  database.Block `json:"block"`
+}
+
+type BlocksRes struct {
+	Blocks   []BlockRes `json:"blocks"`
+	NextFrom *uint64    `json:"next_from,omitempty"`
+}
+
+type SignersRes struct {
+	Engine    string                    `json:"engine"`
+	Authority database.Authority        `json:"authority"`
+	Proposals map[database.Account]bool `json:"proposals"`
+}
+
+// WorkRes is a block template for external miners. The block hash is the
+// sha256 of prefix + the nonce in decimal + suffix, the block is mined once
+// the hash is valid, see database.PoWTarget.
+type WorkRes struct {
+	ID     database.Hash        `json:"id"`
+	Header database.BlockHeader `json:"header"`
+	TXs    []database.Hash      `json:"txs"`
+	Target database.Hash        `json:"target"`
+	Prefix []byte               `json:"prefix"`
+	Suffix []byte               `json:"suffix"`
+}
+
+type SubmitWorkReq struct {
+	ID    database.Hash `json:"id"`
+	Nonce uint32        `json:"nonce"`
+}
+
+type SubmitWorkRes struct {
+	Hash     database.Hash `json:"hash"`
+	Accepted bool          `json:"accepted"`
+}
+
+type MiningRes struct {
+	MiningConfig
+	Mining bool `json:"mining"`
+	// Hashrate of the last PoW mining run, in hashes per second.
+	Hashrate float64 `json:"hashrate,omitempty"`
 }
 
 type StatusRes struct {
@@ -40,6 +141,13 @@ type StatusRes struct {
 	KnownPeers map[string]PeerNode `json:"known_peers"`
 
 	PendingTxs []database.SignedTx `json:"pending_txs"`
+	// Hashrate of the last PoW mining run, in hashes per second.
+	Hashrate float64 `json:"hashrate,omitempty"`
+	// ServesFrom is the oldest block a pruned node can serve to peers, the
+	// serving range ends at the latest block.
+	ServesFrom uint64 `json:"serves_from"`
+	// Light nodes only have headers, they serve no blocks to peers.
+	Light bool `json:"light,omitempty"`
 }
 
 type AddPeerRes struct {
@@ -47,15 +155,96 @@ type AddPeerRes struct {
 	Error   string `json:"error"`
 }
 
+type AnnounceBlockReq struct {
+	Peer  PeerNode       `json:"peer"`
+	Block database.Block `json:"block"`
+}
+
+type AnnounceBlockRes struct {
+	Hash    database.Hash `json:"hash"`
+	Orphans int           `json:"orphans"`
+}
+
 type FetchBlocksRes struct {
 	Blocks []database.Block `json:"blocks"`
 }
 
-func listBalancesHandler(w http.ResponseWriter, _ *http.Request, n *Node) {
-	writeResponse(w, BalancesRes{
-		Hash:     n.state.LatestBlockHash(),
-		Balances: n.state.Balances,
-	})
+// TxProofRes has no proof for a TX the node hasn't mined.
+type TxProofRes struct {
+	Hash  database.Hash     `json:"hash"`
+	Proof *database.TxProof `json:"proof,omitempty"`
+}
+
+// listBalancesHandler returns the latest balances, or the balances right after
+// the block given by ?at=<height|hash>. ?account= narrows them to one account,
+// ?asset= lists the latest balances of a token instead.
+func listBalancesHandler(w http.ResponseWriter, r *http.Request, n *Node) {
+	res := BalancesRes{
+		Hash:         n.state.LatestBlockHash(),
+		Number:       n.state.LatestBlock().Header.Number,
+		Denomination: n.state.Denomination(),
+		Balances:     n.state.Balances,
+	}
+
+	at := r.URL.Query().Get("at")
+	accountRaw := r.URL.Query().Get("account")
+
+	if asset := r.URL.Query().Get("asset"); asset != "" {
+		if at != "" {
+			writeErrorResponse(w, fmt.Errorf("only the latest balances of a token are kept, ?at= can't be set with ?asset="))
+			return
+		}
+		token, ok := n.state.Token(asset)
+		if !ok {
+			writeErrorResponse(w, fmt.Errorf("unknown token '%s'", asset))
+			return
+		}
+
+		res.Denomination, _ = n.state.AssetDenomination(asset)
+		res.Asset = asset
+		res.Issuer = &token.Issuer
+		res.Supply = token.Supply
+		res.Balances = token.Balances
+		if accountRaw != "" {
+			account := database.NewAccount(accountRaw)
+			res.Balances = map[database.Account]database.Amount{account: token.Balances[account]}
+		}
+		writeResponse(w, res)
+		return
+	}
+
+	if at != "" {
+		number, err := n.state.ResolveBlockNumber(at)
+		if err != nil {
+			writeErrorResponse(w, err)
+			return
+		}
+		res.Number = number
+
+		if accountRaw != "" {
+			account := database.NewAccount(accountRaw)
+			balance, hash, err := n.state.BalanceAt(account, number)
+			if err != nil {
+				writeErrorResponse(w, err)
+				return
+			}
+			res.Hash = hash
+			res.Balances = map[database.Account]database.Amount{account: balance}
+		} else {
+			balances, hash, err := n.state.BalancesAt(number)
+			if err != nil {
+				writeErrorResponse(w, err)
+				return
+			}
+			res.Hash = hash
+			res.Balances = balances
+		}
+	} else if accountRaw != "" {
+		account := database.NewAccount(accountRaw)
+		res.Balances = map[database.Account]database.Amount{account: n.state.Balances[account]}
+	}
+
+	writeResponse(w, res)
 }
 
 func addTransactionHandler(w http.ResponseWriter, r *http.Request, n *Node) {
@@ -83,7 +272,41 @@ func addTransactionHandler(w http.ResponseWriter, r *http.Request, n *Node) {
 		return
 	}
 
-	tx := database.NewTX(txAddReq.From, txAddReq.To, txAddReq.Value, txAddReq.Data)
+	value := txAddReq.Value
+	if txAddReq.Amount != "" {
+		if value != 0 {
+			writeErrorResponse(w, fmt.Errorf("only one of value and amount can be set"))
+			return
+		}
+
+		// a token isn't issued yet when its issue TX is added
+		denomination := database.Denomination{Symbol: txAddReq.Asset}
+		if txAddReq.Type != database.TxTypeTokenIssue {
+			if denomination, err = n.state.AssetDenomination(txAddReq.Asset); err != nil {
+				writeErrorResponse(w, err)
+				return
+			}
+		}
+
+		value, err = denomination.Parse(txAddReq.Amount)
+		if err != nil {
+			writeErrorResponse(w, err)
+			return
+		}
+	}
+
+	tx := database.NewTX(txAddReq.From, txAddReq.To, value, txAddReq.Data)
+	tx.Asset = txAddReq.Asset
+	tx.Fee = txAddReq.Fee
+	tx.ValidAfter = txAddReq.ValidAfter
+	tx.ValidBefore = txAddReq.ValidBefore
+	tx.Type = txAddReq.Type
+	tx.HTLC = txAddReq.HTLC
+	tx.GasLimit = txAddReq.GasLimit
+	switch tx.Type {
+	case database.TxTypeHTLCClaim, database.TxTypeHTLCRefund, database.TxTypeTokenBurn, database.TxTypeContractDeploy:
+		tx.To = tx.From
+	}
 
 	signedTx, err := wallet.SignTxWithKeystoreAccount(tx, from, txAddReq.FromPwd, wallet.GetKeystoreDirPath(n.dataDir))
 	if err != nil {
@@ -116,10 +339,59 @@ func addTransactionHandler(w http.ResponseWriter, r *http.Request, n *Node) {
 	// 	return
 	// }
 
-	writeResponse(w, TxAddRes{true})
+	txHash, err := signedTx.Hash()
+	if err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+
+	writeResponse(w, TxAddRes{txHash, true})
+}
+
+// submitTransactionHandler adds a TX signed outside the node, e.g. a multisig
+// TX its signers co-signed offline.
+func submitTransactionHandler(w http.ResponseWriter, r *http.Request, n *Node) {
+	reqBodyJSON, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+	defer r.Body.Close()
+
+	var signedTx database.SignedTx
+	if err = json.Unmarshal(reqBodyJSON, &signedTx); err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+
+	isAuth, err := signedTx.IsAuthentic()
+	if err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+	if !isAuth {
+		writeErrorResponse(w, fmt.Errorf("wrong TX. Sender '%s' is forged", signedTx.From.Hex()))
+		return
+	}
+
+	if err := n.AddPendingTX(signedTx, NewPeerNode(n.ip, n.port, false, true)); err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+
+	txHash, err := signedTx.Hash()
+	if err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+
+	writeResponse(w, TxAddRes{txHash, true})
 }
 
 func nodeStatusHandler(w http.ResponseWriter, _ *http.Request, n *Node) {
+	n.chainMu.Lock()
+	defer n.chainMu.Unlock()
+
 	var pendingTxs []database.SignedTx
 	for _, tx := range n.pendingTxs {
 		pendingTxs = append(pendingTxs, tx)
@@ -130,6 +402,10 @@ func nodeStatusHandler(w http.ResponseWriter, _ *http.Request, n *Node) {
 		Number:     n.state.LatestBlock().Header.Number,
 		KnownPeers: n.knownPeers,
 		PendingTxs: pendingTxs,
+		ServesFrom: n.state.PrunedBelow(),
+	}
+	if pow, ok := n.state.Engine().(*database.PoW); ok {
+		res.Hashrate = pow.Hashrate()
 	}
 	writeResponse(w, res)
 }
@@ -151,6 +427,34 @@ func addPeerHandler(w http.ResponseWriter, r *http.Request, n *Node) {
 	writeResponse(w, AddPeerRes{true, ""})
 }
 
+func announceBlockHandler(w http.ResponseWriter, r *http.Request, n *Node) {
+	reqBodyJSON, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+	defer r.Body.Close()
+
+	var req AnnounceBlockReq
+	if err = json.Unmarshal(reqBodyJSON, &req); err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+
+	hash, err := req.Block.Hash()
+	if err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+
+	if err := n.handOverBlock(r.Context(), req.Peer, req.Block); err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+
+	writeResponse(w, AnnounceBlockRes{hash, n.orphans.len()})
+}
+
 func fetchBlocksHandler(w http.ResponseWriter, r *http.Request, n *Node) {
 	hashRaw := r.URL.Query().Get("hash")
 
@@ -168,3 +472,483 @@ func fetchBlocksHandler(w http.ResponseWriter, r *http.Request, n *Node) {
 
 	writeResponse(w, FetchBlocksRes{blocks})
 }
+
+// fetchHeadersHandler serves /node/headers?hash= to light nodes, the blocks
+// after the given one reduced to their header when it commits to the TXs.
+func fetchHeadersHandler(w http.ResponseWriter, r *http.Request, n *Node) {
+	hash := database.Hash{}
+	if err := hash.UnmarshalText([]byte(r.URL.Query().Get("hash"))); err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+
+	blocks, err := n.state.GetHeadersAfter(hash, maxFetchHeaders)
+	if err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+
+	writeResponse(w, FetchBlocksRes{blocks})
+}
+
+// balanceProofHandler serves /proof/balance?account=&asset=&at=<height|hash>,
+// the proof of the balance in the asset right after the given block, the
+// latest by default.
+func balanceProofHandler(w http.ResponseWriter, r *http.Request, n *Node) {
+	account := database.NewAccount(r.URL.Query().Get("account"))
+	asset := r.URL.Query().Get("asset")
+
+	n.chainMu.Lock()
+	latest := n.state.LatestBlock().Header.Number
+	number := latest
+	if at := r.URL.Query().Get("at"); at != "" {
+		var err error
+		if number, err = n.state.ResolveBlockNumber(at); err != nil {
+			n.chainMu.Unlock()
+			writeErrorResponse(w, err)
+			return
+		}
+	}
+
+	var proof database.BalanceProof
+	var err error
+	if number >= latest {
+		proof, err = n.state.BalanceProof(account, asset, number)
+		n.chainMu.Unlock()
+	} else {
+		// a past state is replayed from blocks.db, mining and sync go on
+		n.chainMu.Unlock()
+		proof, err = n.state.BalanceProof(account, asset, number)
+	}
+	if err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+
+	writeResponse(w, proof)
+}
+
+// txProofHandler serves /proof/tx/{hash}, the proof a mined TX is in its
+// block.
+func txProofHandler(w http.ResponseWriter, r *http.Request, n *Node) {
+	hash := database.Hash{}
+	if err := hash.UnmarshalText([]byte(strings.TrimPrefix(r.URL.Path, endpointTxProof))); err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+
+	proof, isMined, err := n.state.TxProof(hash)
+	if err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+
+	res := TxProofRes{Hash: hash}
+	if isMined {
+		res.Proof = &proof
+	}
+	writeResponse(w, res)
+}
+
+type EscrowRes struct {
+	ID database.Hash `json:"id"`
+	database.Escrow
+}
+
+// escrowHandler serves /escrows/{id}, the escrow locked by the HTLC lock TX
+// with the given hash.
+func escrowHandler(w http.ResponseWriter, r *http.Request, n *Node) {
+	id := database.Hash{}
+	if err := id.UnmarshalText([]byte(strings.TrimPrefix(r.URL.Path, endpointEscrow))); err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+
+	escrow, ok := n.state.GetEscrow(id)
+	if !ok {
+		writeErrorResponse(w, fmt.Errorf("unknown escrow %x", id))
+		return
+	}
+
+	writeResponse(w, EscrowRes{id, escrow})
+}
+
+type ContractRes struct {
+	Account database.Account `json:"account"`
+	database.Contract
+}
+
+// contractHandler serves /contracts/{account}, the contract code and storage.
+func contractHandler(w http.ResponseWriter, r *http.Request, n *Node) {
+	raw := strings.TrimPrefix(r.URL.Path, endpointContract)
+	if !common.IsHexAddress(raw) {
+		writeErrorResponse(w, fmt.Errorf("invalid contract account '%s'", raw))
+		return
+	}
+	account := database.NewAccount(raw)
+
+	contract, ok := n.state.GetContract(account)
+	if !ok {
+		writeErrorResponse(w, fmt.Errorf("no contract at %s", account.Hex()))
+		return
+	}
+
+	writeResponse(w, ContractRes{account, contract})
+}
+
+func getTransactionHandler(w http.ResponseWriter, r *http.Request, n *Node) {
+	hash := database.Hash{}
+	if err := hash.UnmarshalText([]byte(strings.TrimPrefix(r.URL.Path, endpointTx))); err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+
+	n.chainMu.Lock()
+	defer n.chainMu.Unlock()
+
+	res := TxRes{Hash: hash, Status: TxStatusUnknown}
+
+	if tx, isPending := n.pendingTxs[hash.Hex()]; isPending {
+		res.Status = TxStatusPending
+		res.Tx = &tx
+		writeResponse(w, res)
+		return
+	}
+
+	if reason, isRejected := n.rejectedTxs[hash.Hex()]; isRejected {
+		res.Status = TxStatusFailed
+		res.Error = reason
+		writeResponse(w, res)
+		return
+	}
+
+	tx, location, isMined, err := n.state.GetTx(hash)
+	if err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+
+	if isMined {
+		res.Status = TxStatusMined
+		res.Tx = &tx
+		res.TxLocation = &location
+		res.Confirmations = n.state.LatestBlock().Header.Number - location.BlockNumber + 1
+
+		if receipt, ok := n.state.GetReceipt(hash); ok {
+			res.Receipt = &receipt
+		}
+	}
+
+	writeResponse(w, res)
+}
+
+// accountTxsHandler serves /accounts/{addr}/txs?cursor=&limit=
+func accountTxsHandler(w http.ResponseWriter, r *http.Request, n *Node) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, endpointAccounts), "/")
+	if len(parts) != 2 || parts[1] != "txs" {
+		writeErrorResponse(w, fmt.Errorf("unknown endpoint %s", r.URL.Path))
+		return
+	}
+	account := database.NewAccount(parts[0])
+
+	limit := 0
+	if limitRaw := r.URL.Query().Get("limit"); limitRaw != "" {
+		var err error
+		if limit, err = strconv.Atoi(limitRaw); err != nil {
+			writeErrorResponse(w, err)
+			return
+		}
+	}
+
+	txs, next, err := n.state.AccountTxs(account, r.URL.Query().Get("cursor"), limit)
+	if err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+
+	writeResponse(w, AccountTxsRes{account, txs, next})
+}
+
+const defaultBlocksLimit = 20
+const maxBlocksLimit = 100
+
+func newBlockRes(blockFS database.BlockFS, latest uint64) (BlockRes, error) {
+	blockJSON, err := json.Marshal(blockFS.Block)
+	if err != nil {
+		return BlockRes{}, err
+	}
+
+	fees, err := blockFS.Block.TotalFees()
+	if err != nil {
+		return BlockRes{}, err
+	}
+
+	return BlockRes{
+		Hash:          blockFS.BlockHash,
+		Number:        blockFS.Block.Header.Number,
+		Size:          len(blockJSON),
+		TxCount:       len(blockFS.Block.TXs),
+		Miner:         blockFS.Block.Header.Miner,
+		TotalFees:     fees,
+		Confirmations: latest - blockFS.Block.Header.Number + 1,
+		Pruned:        blockFS.Pruned,
+		Block:         blockFS.Block,
+	}, nil
+}
+
+// blockHandler serves /blocks/latest, /blocks/{height} and /blocks/hash/{hash}
+func blockHandler(w http.ResponseWriter, r *http.Request, n *Node) {
+	ref := strings.TrimPrefix(r.URL.Path, endpointBlock)
+	blocks := n.blocks()
+	latest := blocks.LatestBlock().Header.Number
+
+	var blockFS database.BlockFS
+	var err error
+
+	switch {
+	case ref == "latest":
+		blockFS, err = blocks.GetBlockByNumber(latest)
+	case strings.HasPrefix(ref, "hash/"):
+		hash := database.Hash{}
+		if err = hash.UnmarshalText([]byte(strings.TrimPrefix(ref, "hash/"))); err == nil {
+			blockFS, err = blocks.GetBlockByHash(hash)
+		}
+	default:
+		var number uint64
+		if number, err = strconv.ParseUint(ref, 10, 64); err == nil {
+			blockFS, err = blocks.GetBlockByNumber(number)
+		}
+	}
+	if err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+
+	res, err := newBlockRes(blockFS, latest)
+	if err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+
+	writeResponse(w, res)
+}
+
+// listBlocksHandler serves /blocks?from=&to=&limit=, blocks in ascending
+// order. Without a range it returns the latest blocks.
+func listBlocksHandler(w http.ResponseWriter, r *http.Request, n *Node) {
+	query := r.URL.Query()
+	blocks := n.blocks()
+	latest := blocks.LatestBlock().Header.Number
+
+	limit := uint64(defaultBlocksLimit)
+	if limitRaw := query.Get("limit"); limitRaw != "" {
+		var err error
+		if limit, err = strconv.ParseUint(limitRaw, 10, 64); err != nil {
+			writeErrorResponse(w, err)
+			return
+		}
+	}
+	if limit == 0 || limit > maxBlocksLimit {
+		limit = maxBlocksLimit
+	}
+
+	to := latest
+	if toRaw := query.Get("to"); toRaw != "" {
+		var err error
+		if to, err = strconv.ParseUint(toRaw, 10, 64); err != nil {
+			writeErrorResponse(w, err)
+			return
+		}
+		if to > latest {
+			to = latest
+		}
+	}
+
+	from := uint64(0)
+	if fromRaw := query.Get("from"); fromRaw != "" {
+		var err error
+		if from, err = strconv.ParseUint(fromRaw, 10, 64); err != nil {
+			writeErrorResponse(w, err)
+			return
+		}
+	} else if to+1 > limit {
+		from = to + 1 - limit
+	}
+
+	res := BlocksRes{Blocks: []BlockRes{}}
+	if from > to {
+		writeResponse(w, res)
+		return
+	}
+
+	if to-from+1 > limit {
+		to = from + limit - 1
+		nextFrom := to + 1
+		res.NextFrom = &nextFrom
+	}
+
+	for number := from; number <= to; number++ {
+		// blocks before a bootstrap snapshot aren't stored locally
+		blockFS, err := blocks.GetBlockByNumber(number)
+		if err != nil {
+			continue
+		}
+
+		blockRes, err := newBlockRes(blockFS, latest)
+		if err != nil {
+			writeErrorResponse(w, err)
+			return
+		}
+		res.Blocks = append(res.Blocks, blockRes)
+	}
+
+	writeResponse(w, res)
+}
+
+func signersHandler(w http.ResponseWriter, _ *http.Request, n *Node) {
+	n.chainMu.Lock()
+	defer n.chainMu.Unlock()
+
+	writeResponse(w, SignersRes{n.state.Engine().Name(), n.state.Authority(), n.proposals})
+}
+
+// voteHandler serves /consensus/vote?account=&authorize=, the node votes for
+// the proposal in the blocks it seals until the signer set reflects it.
+func voteHandler(w http.ResponseWriter, r *http.Request, n *Node) {
+	if _, ok := n.state.Engine().(*database.PoA); !ok {
+		writeErrorResponse(w, fmt.Errorf("voting needs the poa consensus engine, the chain uses %s", n.state.Engine().Name()))
+		return
+	}
+
+	account := database.NewAccount(r.URL.Query().Get("account"))
+	if account == (database.Account{}) {
+		writeErrorResponse(w, fmt.Errorf("account is invalid %s", account.Hex()))
+		return
+	}
+
+	authorize, err := strconv.ParseBool(r.URL.Query().Get("authorize"))
+	if err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+
+	n.chainMu.Lock()
+	defer n.chainMu.Unlock()
+
+	n.proposals[account] = authorize
+
+	writeResponse(w, SignersRes{n.state.Engine().Name(), n.state.Authority(), n.proposals})
+}
+
+// workHandler serves /mining/work?miner=, the template of the next block for
+// the miner account, the node's miner by default.
+func workHandler(w http.ResponseWriter, r *http.Request, n *Node) {
+	miner := n.miner
+	if minerRaw := r.URL.Query().Get("miner"); minerRaw != "" {
+		miner = database.NewAccount(minerRaw)
+	}
+
+	template, err := n.work(miner)
+	if err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+
+	res := WorkRes{
+		ID:     template.id,
+		Header: template.block.Header,
+		TXs:    make([]database.Hash, 0, len(template.block.TXs)),
+		Target: database.PoWTarget,
+		Prefix: template.prefix,
+		Suffix: template.suffix,
+	}
+	for _, tx := range template.block.TXs {
+		txHash, err := tx.Hash()
+		if err != nil {
+			writeErrorResponse(w, err)
+			return
+		}
+		res.TXs = append(res.TXs, txHash)
+	}
+
+	writeResponse(w, res)
+}
+
+func submitWorkHandler(w http.ResponseWriter, r *http.Request, n *Node) {
+	reqBodyJSON, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+	defer r.Body.Close()
+
+	var req SubmitWorkReq
+	if err = json.Unmarshal(reqBodyJSON, &req); err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+
+	hash, err := n.submitWork(req.ID, req.Nonce)
+	if err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+
+	writeResponse(w, SubmitWorkRes{hash, true})
+}
+
+func miningHandler(w http.ResponseWriter, _ *http.Request, n *Node) {
+	writeResponse(w, newMiningRes(n, n.MiningConfig()))
+}
+
+func startMiningHandler(w http.ResponseWriter, _ *http.Request, n *Node) {
+	config := n.MiningConfig()
+	config.Enabled = true
+	n.SetMiningConfig(config)
+
+	writeResponse(w, newMiningRes(n, config))
+}
+
+func stopMiningHandler(w http.ResponseWriter, _ *http.Request, n *Node) {
+	config := n.MiningConfig()
+	config.Enabled = false
+	n.SetMiningConfig(config)
+
+	writeResponse(w, newMiningRes(n, config))
+}
+
+// miningConfigHandler changes the query parameters given, the others keep
+// their value.
+func miningConfigHandler(w http.ResponseWriter, r *http.Request, n *Node) {
+	config := n.MiningConfig()
+
+	if workersRaw := r.URL.Query().Get("workers"); workersRaw != "" {
+		workers, err := strconv.ParseUint(workersRaw, 10, 16)
+		if err != nil {
+			writeErrorResponse(w, err)
+			return
+		}
+		config.Workers = int(workers)
+	}
+
+	if intervalRaw := r.URL.Query().Get("empty_block_interval_secs"); intervalRaw != "" {
+		interval, err := strconv.ParseUint(intervalRaw, 10, 64)
+		if err != nil {
+			writeErrorResponse(w, err)
+			return
+		}
+		config.EmptyBlockIntervalSecs = interval
+	}
+
+	n.SetMiningConfig(config)
+
+	writeResponse(w, newMiningRes(n, config))
+}
+
+func newMiningRes(n *Node, config MiningConfig) MiningRes {
+	res := MiningRes{MiningConfig: config, Mining: n.isMining()}
+	if pow, ok := n.state.Engine().(*database.PoW); ok {
+		res.Hashrate = pow.Hashrate()
+	}
+	return res
+}
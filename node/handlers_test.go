@@ -0,0 +1,240 @@
+package node
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/1412335/the-blockchain-bar/database"
+	"github.com/1412335/the-blockchain-bar/wallet"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// newInstantTestNode returns a node on a fresh instant seal chain funding the
+// returned key.
+func newInstantTestNode(t *testing.T) (*Node, *ecdsa.PrivateKey) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newInstantTestNodeFunding(t, key), key
+}
+
+// newInstantTestNodeFunding returns a node on a fresh instant seal chain
+// funding the key, nodes funding the same key share the genesis.
+func newInstantTestNodeFunding(t *testing.T, key *ecdsa.PrivateKey) *Node {
+	datadir, err := ioutil.TempDir("", "tbb-handlers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(datadir) })
+
+	genesisJSON := fmt.Sprintf(`{"chain_id":"test","consensus":{"engine":"%s"},"balances":{"%s":1000}}`, database.EngineInstant, wallet.PublicKeyToAccount(key.PublicKey).Hex())
+	if err := os.MkdirAll(filepath.Join(datadir, "database"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(datadir, "database", "genesis.json"), []byte(genesisJSON), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(datadir, "database", "blocks.db"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := database.NewStateFromDisk(datadir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { state.Close() })
+
+	n := New(datadir, "127.0.0.1", 8089, database.NewAccount(wallet.BabayagaAccount), NewPeerNode("127.0.0.1", 8087, true, true))
+	n.state = state
+	return n
+}
+
+// addTestBlock seals and adds a block with the TXs on top of the node chain,
+// babayaga mines it.
+func addTestBlock(t *testing.T, n *Node, txs ...database.SignedTx) database.Hash {
+	miner := database.NewAccount(wallet.BabayagaAccount)
+	block := database.NewBlock(n.state.LatestBlockHash(), n.state.NextBlockNumber(), n.state.NextBlockNumber(), 0, miner, txs)
+	block, err := n.state.Seal(context.Background(), block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := n.state.AddBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+// serveTest calls the handler and decodes its JSON answer into res.
+func serveTest(t *testing.T, handler func(http.ResponseWriter, *http.Request, *Node), n *Node, url string, res interface{}) int {
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodGet, url, nil), n)
+
+	if recorder.Code == http.StatusOK && res != nil {
+		if err := json.Unmarshal(recorder.Body.Bytes(), res); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return recorder.Code
+}
+
+func TestBlockHandlers(t *testing.T) {
+	n, key := newInstantTestNode(t)
+
+	if code := serveTest(t, blockHandler, n, "/blocks/latest", nil); code != http.StatusNotFound {
+		t.Fatalf("expected no latest block on an empty chain, got status %d", code)
+	}
+	var blocks BlocksRes
+	if code := serveTest(t, listBlocksHandler, n, "/blocks", &blocks); code != http.StatusOK || len(blocks.Blocks) != 0 {
+		t.Fatalf("expected no block listed on an empty chain, got status %d and %d blocks", code, len(blocks.Blocks))
+	}
+
+	from := wallet.PublicKeyToAccount(key.PublicKey)
+	to := database.NewAccount(wallet.AndrejAccount)
+	var txs []database.SignedTx
+	for i, fee := range []database.Amount{2, 3} {
+		tx := database.TX{From: from, To: to, Value: 10, Fee: fee, Time: uint64(i)}
+		signedTx, err := wallet.SignTx(tx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		txs = append(txs, signedTx)
+	}
+
+	addTestBlock(t, n)
+	addTestBlock(t, n, txs...)
+	latestHash := addTestBlock(t, n)
+
+	var block BlockRes
+	if code := serveTest(t, blockHandler, n, "/blocks/1", &block); code != http.StatusOK {
+		t.Fatalf("expected block 1, got status %d", code)
+	}
+	if block.Number != 1 || block.TxCount != 2 || block.TotalFees != 5 || block.Confirmations != 2 || block.Miner != database.NewAccount(wallet.BabayagaAccount) {
+		t.Fatalf("expected block 1 with 2 TXs paying 5 in fees and 2 confirmations, got %+v", block)
+	}
+
+	for _, url := range []string{"/blocks/latest", fmt.Sprintf("/blocks/hash/%x", latestHash)} {
+		block = BlockRes{}
+		if code := serveTest(t, blockHandler, n, url, &block); code != http.StatusOK || block.Hash != latestHash || block.Confirmations != 1 {
+			t.Fatalf("expected %s to be the latest block with 1 confirmation, got status %d and %+v", url, code, block)
+		}
+	}
+
+	unknownHashURL := fmt.Sprintf("/blocks/hash/%x", database.Hash{1})
+	for url, status := range map[string]int{
+		"/blocks/3":    http.StatusNotFound,
+		unknownHashURL: http.StatusNotFound,
+		"/blocks/abc":  http.StatusInternalServerError,
+	} {
+		if code := serveTest(t, blockHandler, n, url, nil); code != status {
+			t.Fatalf("expected status %d for %s, got %d", status, url, code)
+		}
+	}
+
+	for url, expected := range map[string]struct {
+		numbers  []uint64
+		nextFrom uint64
+	}{
+		"/blocks":                     {[]uint64{0, 1, 2}, 0},
+		"/blocks?limit=1":             {[]uint64{2}, 0},
+		"/blocks?from=0&to=2&limit=2": {[]uint64{0, 1}, 2},
+		"/blocks?from=1&to=9":         {[]uint64{1, 2}, 0},
+		"/blocks?from=2&to=1":         {nil, 0},
+		"/blocks?from=3":              {nil, 0},
+	} {
+		blocks = BlocksRes{}
+		if code := serveTest(t, listBlocksHandler, n, url, &blocks); code != http.StatusOK {
+			t.Fatalf("expected %s to list blocks, got status %d", url, code)
+		}
+
+		var numbers []uint64
+		for _, block := range blocks.Blocks {
+			numbers = append(numbers, block.Number)
+		}
+		nextFrom := uint64(0)
+		if blocks.NextFrom != nil {
+			nextFrom = *blocks.NextFrom
+		}
+		if fmt.Sprint(numbers) != fmt.Sprint(expected.numbers) || nextFrom != expected.nextFrom {
+			t.Fatalf("expected %s to list blocks %v and next from %d, got %v and %d", url, expected.numbers, expected.nextFrom, numbers, nextFrom)
+		}
+	}
+}
+
+func TestWaitForReceipt(t *testing.T) {
+	n, key := newInstantTestNode(t)
+
+	tx := database.TX{From: wallet.PublicKeyToAccount(key.PublicKey), To: database.NewAccount(wallet.AndrejAccount), Value: 10, Fee: 1}
+	signedTx, err := wallet.SignTx(tx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := signedTx.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		getTransactionHandler(w, r, n)
+	}))
+	defer server.Close()
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	type waitRes struct {
+		txRes TxRes
+		err   error
+	}
+	waited := make(chan waitRes, 1)
+	go func() {
+		txRes, err := WaitForReceipt(ctx, address, hash, 3, time.Millisecond*10)
+		waited <- waitRes{txRes, err}
+	}()
+
+	// the wait goes on while the TX is unknown and then short of confirmations
+	for _, txs := range [][]database.SignedTx{{signedTx}, nil, nil} {
+		select {
+		case res := <-waited:
+			t.Fatalf("expected the wait to go on until 3 confirmations, got %+v: %v", res.txRes, res.err)
+		case <-time.After(time.Millisecond * 50):
+		}
+
+		n.chainMu.Lock()
+		addTestBlock(t, n, txs...)
+		n.chainMu.Unlock()
+	}
+
+	select {
+	case res := <-waited:
+		if res.err != nil {
+			t.Fatal(res.err)
+		}
+		if res.txRes.Confirmations != 3 || res.txRes.Receipt == nil || res.txRes.Receipt.BlockNumber != 0 || res.txRes.Receipt.Fee != 1 {
+			t.Fatalf("expected the receipt of block 0 with 3 confirmations, got %+v", res.txRes)
+		}
+	case <-ctx.Done():
+		t.Fatal("expected the wait to return once the TX has 3 confirmations")
+	}
+
+	// a TX dropped from the mempool ends the wait with its reason
+	rejected := database.Hash{1}
+	n.chainMu.Lock()
+	n.rejectedTxs[rejected.Hex()] = "insufficient balance"
+	n.chainMu.Unlock()
+	if _, err := WaitForReceipt(ctx, address, rejected, 1, time.Millisecond*10); err == nil || !strings.Contains(err.Error(), "insufficient balance") {
+		t.Fatalf("expected the wait for a failed TX to fail with its reason, got %v", err)
+	}
+}
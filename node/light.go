@@ -0,0 +1,352 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/1412335/the-blockchain-bar/database"
+)
+
+const endpointFetchHeaders = "/node/headers"
+const endpointBalanceProof = "/proof/balance"
+const endpointTxProof = "/proof/tx/"
+
+// maxFetchHeaders bounds the headers served per request, a light node asks
+// again until it reaches the peer's tip.
+const maxFetchHeaders = 500
+
+const lightSyncIntervalSecs = 10
+
+// blockSource is where the block endpoints read blocks from: the state of a
+// full node, the header chain of a light node.
+type blockSource interface {
+	LatestBlock() database.Block
+	GetBlockByNumber(number uint64) (database.BlockFS, error)
+	GetBlockByHash(hash database.Hash) (database.BlockFS, error)
+}
+
+func (n *Node) blocks() blockSource {
+	if n.light {
+		return n.headers
+	}
+	return n.state
+}
+
+// SetLight makes the node a light node: it syncs and verifies block headers
+// only, and serves balances and TXs proven by its full peers against them.
+func (n *Node) SetLight(enabled bool) {
+	n.light = enabled
+}
+
+func (n *Node) runLight(ctx context.Context) error {
+	fmt.Printf("Listening on HTTP port: %d\n", n.port)
+
+	headers, err := database.NewHeaderChainFromDisk(n.dataDir)
+	if err != nil {
+		return err
+	}
+	defer headers.Close()
+
+	n.headers = headers
+
+	fmt.Println("Light node headers:")
+	fmt.Printf("	- height: %d\n", n.headers.LatestBlock().Header.Number)
+	fmt.Printf("	- hash: %x\n", n.headers.LatestBlockHash())
+	fmt.Printf("Block explorer: http://localhost:%d%s\n", n.port, endpointExplorer)
+
+	go n.syncLight(ctx)
+
+	handler := http.NewServeMux()
+
+	handler.HandleFunc("/balances/list", func(w http.ResponseWriter, r *http.Request) {
+		lightBalancesHandler(w, r, n)
+	})
+
+	handler.HandleFunc(endpointTx, func(w http.ResponseWriter, r *http.Request) {
+		lightTransactionHandler(w, r, n)
+	})
+
+	handler.HandleFunc(endpointBlocks, func(w http.ResponseWriter, r *http.Request) {
+		listBlocksHandler(w, r, n)
+	})
+
+	handler.HandleFunc(endpointBlock, func(w http.ResponseWriter, r *http.Request) {
+		blockHandler(w, r, n)
+	})
+
+	handler.HandleFunc(endpointSigners, func(w http.ResponseWriter, r *http.Request) {
+		lightSignersHandler(w, r, n)
+	})
+
+	handler.HandleFunc(endpointStatus, func(w http.ResponseWriter, r *http.Request) {
+		lightStatusHandler(w, r, n)
+	})
+
+	handler.HandleFunc(endpointAddPeer, func(w http.ResponseWriter, r *http.Request) {
+		addPeerHandler(w, r, n)
+	})
+
+	explorer, err := explorerHandler()
+	if err != nil {
+		return err
+	}
+	handler.Handle(endpointExplorer, explorer)
+
+	return n.serve(ctx, handler)
+}
+
+func (n *Node) syncLight(ctx context.Context) {
+	ticker := time.NewTicker(time.Second * lightSyncIntervalSecs)
+	defer ticker.Stop()
+
+	for {
+		n.fetchNewHeadersAndPeers(ctx)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (n *Node) fetchNewHeadersAndPeers(ctx context.Context) {
+	for _, knownPeer := range n.knownPeers {
+		if knownPeer.IP == n.ip && knownPeer.Port == n.port {
+			continue
+		}
+
+		status, err := queryPeerStatus(ctx, knownPeer)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			fmt.Printf("Peer '%s' was removed from KnownPeers\n", knownPeer.TCPAddress())
+
+			n.RemovePeer(knownPeer)
+			continue
+		}
+
+		n.syncKnownPeers(status.KnownPeers)
+		if status.Light {
+			continue
+		}
+
+		if err := n.syncHeaders(ctx, knownPeer, status); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+	}
+}
+
+// syncHeaders adds the headers of the peer up to its tip.
+func (n *Node) syncHeaders(ctx context.Context, peer PeerNode, status StatusRes) error {
+	if status.Hash.IsEmpty() {
+		return nil
+	}
+
+	for n.headers.NextBlockNumber() <= status.Number {
+		blocks, err := fetchHeadersFromPeer(ctx, peer, n.headers.LatestBlockHash())
+		if err != nil {
+			return err
+		}
+		if len(blocks) == 0 {
+			return nil
+		}
+
+		for _, block := range blocks {
+			if _, err := n.headers.AddHeader(block); err != nil {
+				return fmt.Errorf("peer %s: %v", peer.TCPAddress(), err)
+			}
+		}
+		fmt.Printf("Synced headers up to block %d from Peer %s\n", n.headers.LatestBlock().Header.Number, peer.TCPAddress())
+	}
+	return nil
+}
+
+// proveBalance asks the peers for the proof of the balance in the asset at the
+// given height until one verifies against the synced headers.
+func (n *Node) proveBalance(ctx context.Context, account database.Account, asset string, number uint64) (database.BalanceProof, error) {
+	lastErr := fmt.Errorf("no peer to prove the balance of %s", account.Hex())
+
+	for _, peer := range n.knownPeers {
+		if peer.IP == n.ip && peer.Port == n.port {
+			continue
+		}
+
+		proof, err := fetchBalanceProof(ctx, peer, account, asset, number)
+		if err == nil && (proof.Account != account || proof.Asset != asset || proof.Number != number) {
+			err = fmt.Errorf("proof is for %s '%s' at block %d", proof.Account.Hex(), proof.Asset, proof.Number)
+		}
+		if err == nil {
+			err = n.headers.VerifyBalanceProof(proof)
+		}
+		if err != nil {
+			lastErr = fmt.Errorf("peer %s: %v", peer.TCPAddress(), err)
+			continue
+		}
+		return proof, nil
+	}
+	return database.BalanceProof{}, lastErr
+}
+
+// proveTx asks the peers for the proof of the TX until one verifies against
+// the synced headers. The bool is false when no peer has the TX mined.
+func (n *Node) proveTx(ctx context.Context, hash database.Hash) (database.TxProof, bool, error) {
+	var lastErr error
+
+	for _, peer := range n.knownPeers {
+		if peer.IP == n.ip && peer.Port == n.port {
+			continue
+		}
+
+		res, err := fetchTxProof(ctx, peer, hash)
+		if err == nil && res.Proof == nil {
+			continue
+		}
+		if err == nil {
+			err = n.headers.VerifyTxProof(*res.Proof)
+		}
+		if err == nil {
+			var txHash database.Hash
+			if txHash, err = res.Proof.Tx.Hash(); err == nil && txHash != hash {
+				err = fmt.Errorf("proof is for TX %x", txHash)
+			}
+		}
+		if err != nil {
+			lastErr = fmt.Errorf("peer %s: %v", peer.TCPAddress(), err)
+			continue
+		}
+		return *res.Proof, true, nil
+	}
+	return database.TxProof{}, false, lastErr
+}
+
+// lightBalancesHandler serves /balances/list?account=&asset=&at=<height|hash>
+// like the full node, the balance is proven against the latest header
+// committing to the state by default. A light node has no state to list every
+// balance from, nor the token issuer and supply.
+func lightBalancesHandler(w http.ResponseWriter, r *http.Request, n *Node) {
+	at := r.URL.Query().Get("at")
+	asset := r.URL.Query().Get("asset")
+
+	accountRaw := r.URL.Query().Get("account")
+	if accountRaw == "" {
+		writeErrorResponse(w, fmt.Errorf("a light node can't prove the list of every balance, set ?account= to prove the balance of one account"))
+		return
+	}
+	account := database.NewAccount(accountRaw)
+
+	var number uint64
+	if at != "" {
+		var err error
+		if number, err = n.headers.ResolveBlockNumber(at); err != nil {
+			writeErrorResponse(w, err)
+			return
+		}
+	} else {
+		header, ok := n.headers.LatestCommitted()
+		if !ok {
+			writeErrorResponse(w, fmt.Errorf("no synced header commits to the state yet"))
+			return
+		}
+		number = header.Block.Header.Number
+	}
+
+	proof, err := n.proveBalance(r.Context(), account, asset, number)
+	if err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+
+	res := BalancesRes{
+		Hash:         proof.BlockHash,
+		Number:       proof.Number,
+		Denomination: n.headers.Denomination(),
+		Balances:     map[database.Account]database.Amount{account: proof.Balance},
+	}
+	if asset != "" {
+		res.Asset = asset
+		res.Denomination = database.Denomination{Symbol: asset, Unit: asset}
+	}
+	writeResponse(w, res)
+}
+
+// lightTransactionHandler serves /tx/{hash}, a TX is mined once a peer proves
+// it's in a synced block. A light node has no mempool nor receipts.
+func lightTransactionHandler(w http.ResponseWriter, r *http.Request, n *Node) {
+	hash := database.Hash{}
+	if err := hash.UnmarshalText([]byte(strings.TrimPrefix(r.URL.Path, endpointTx))); err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+
+	proof, isMined, err := n.proveTx(r.Context(), hash)
+	if err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+
+	res := TxRes{Hash: hash, Status: TxStatusUnknown}
+	if isMined {
+		res.Status = TxStatusMined
+		res.Tx = &proof.Tx
+		res.TxLocation = &proof.TxLocation
+		res.Confirmations = n.headers.LatestBlock().Header.Number - proof.BlockNumber + 1
+	}
+
+	writeResponse(w, res)
+}
+
+func lightSignersHandler(w http.ResponseWriter, _ *http.Request, n *Node) {
+	writeResponse(w, SignersRes{n.headers.Engine().Name(), n.headers.Authority(), n.proposals})
+}
+
+func lightStatusHandler(w http.ResponseWriter, _ *http.Request, n *Node) {
+	writeResponse(w, StatusRes{
+		Hash:       n.headers.LatestBlockHash(),
+		Number:     n.headers.LatestBlock().Header.Number,
+		KnownPeers: n.knownPeers,
+		Light:      true,
+	})
+}
+
+func fetchHeadersFromPeer(ctx context.Context, peer PeerNode, hash database.Hash) ([]database.Block, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s%s?hash=%x", peer.TCPAddress(), endpointFetchHeaders, hash), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var res FetchBlocksRes
+	if err := doRequest(req, &res); err != nil {
+		return nil, err
+	}
+	return res.Blocks, nil
+}
+
+func fetchBalanceProof(ctx context.Context, peer PeerNode, account database.Account, asset string, number uint64) (database.BalanceProof, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s%s?account=%s&asset=%s&at=%d", peer.TCPAddress(), endpointBalanceProof, account.Hex(), url.QueryEscape(asset), number), nil)
+	if err != nil {
+		return database.BalanceProof{}, err
+	}
+
+	var proof database.BalanceProof
+	if err := doRequest(req, &proof); err != nil {
+		return database.BalanceProof{}, err
+	}
+	return proof, nil
+}
+
+func fetchTxProof(ctx context.Context, peer PeerNode, hash database.Hash) (TxProofRes, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s%s%x", peer.TCPAddress(), endpointTxProof, hash), nil)
+	if err != nil {
+		return TxProofRes{}, err
+	}
+
+	var res TxProofRes
+	if err := doRequest(req, &res); err != nil {
+		return TxProofRes{}, err
+	}
+	return res, nil
+}
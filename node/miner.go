@@ -25,52 +25,87 @@ func Mine(ctx context.Context, pendingBlock PendingBlock) (database.Block, error
 		return database.Block{}, fmt.Errorf("empty block")
 	}
 
-	start := time.Now()
-	attempts := 0
-	hash := database.Hash{}
-	block := database.Block{}
-
-	for !hash.IsBlockHashValid() {
-		select {
-		case <-ctx.Done():
-			return database.Block{}, fmt.Errorf("stop mining after %d attempts with error: %s", attempts, ctx.Err())
-		default:
-		}
-
-		attempts++
-
-		if attempts%1e6 == 0 || attempts == 1 {
-			fmt.Printf("Mining %d pending TXs. Attempts #%d\n", len(pendingBlock.txs), attempts)
-		}
-
-		nonce, err := database.RandomNonce()
-		if err != nil {
-			return database.Block{}, err
-		}
-
-		block = database.NewBlock(
-			pendingBlock.parent,
-			pendingBlock.number,
-			pendingBlock.time,
-			nonce,
-			pendingBlock.miner,
-			pendingBlock.txs,
-		)
-
-		hash, err = block.Hash()
-		if err != nil {
-			return database.Block{}, fmt.Errorf("can't mine block: %s", err.Error())
-		}
+	return database.NewPoW().Seal(ctx, nil, pendingBlock.block())
+}
+
+func (pb PendingBlock) block() database.Block {
+	return database.NewBlock(pb.parent, pb.number, pb.time, 0, pb.miner, pb.txs)
+}
+
+// MiningConfig configures the node's miner, it can be changed while the node
+// runs.
+type MiningConfig struct {
+	Enabled bool `json:"enabled"`
+	// Workers is the number of PoW mining goroutines, 0 for one per CPU.
+	Workers int `json:"workers"`
+	// EmptyBlockIntervalSecs makes the miner seal a block without TXs once
+	// the tip is that old, 0 never mines empty blocks.
+	EmptyBlockIntervalSecs uint64 `json:"empty_block_interval_secs"`
+}
+
+func DefaultMiningConfig() MiningConfig {
+	return MiningConfig{Enabled: true}
+}
+
+func (n *Node) MiningConfig() MiningConfig {
+	n.miningMu.Lock()
+	defer n.miningMu.Unlock()
+
+	return n.miningConfig
+}
+
+// SetMiningConfig replaces the miner configuration, a running node restarts
+// its current mining job with it.
+func (n *Node) SetMiningConfig(config MiningConfig) {
+	n.miningMu.Lock()
+	n.miningConfig = config
+	n.miningMu.Unlock()
+
+	select {
+	case n.miningConfigChanged <- struct{}{}:
+	default:
+	}
+}
+
+type miningJob struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (n *Node) setMiningJob(job *miningJob) {
+	n.miningMu.Lock()
+	defer n.miningMu.Unlock()
+
+	n.miningJob = job
+}
+
+func (n *Node) lastMiningJob() *miningJob {
+	n.miningMu.Lock()
+	defer n.miningMu.Unlock()
+
+	return n.miningJob
+}
+
+// isMining tells whether a mining job is running.
+func (n *Node) isMining() bool {
+	job := n.lastMiningJob()
+	if job == nil {
+		return false
 	}
 
-	fmt.Printf("Mined new Block using PoW '%x':\n", hash)
-	fmt.Printf("\tHeight: %d\n", block.Header.Number)
-	fmt.Printf("\tNonce: %d\n", block.Header.Nonce)
-	fmt.Printf("\tCreated: %v\n", block.Header.Time)
-	fmt.Printf("\tMiner: %x\n", block.Header.Miner)
-	fmt.Printf("\tParent: %x\n", block.Header.Parent)
-	fmt.Printf("\tAttempts: %d\n", attempts)
-	fmt.Printf("\tTime mining: %s\n", time.Since(start))
+	select {
+	case <-job.done:
+		return false
+	default:
+		return true
+	}
+}
 
-	return block, nil
+// doneChan is nil, blocking forever in a select, when no job runs.
+func (j *miningJob) doneChan() <-chan struct{} {
+	if j == nil {
+		return nil
+	}
+	return j.done
 }
@@ -119,7 +119,8 @@ func TestMineWithTimeout(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	ctx, _ := context.WithTimeout(context.Background(), 1*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Millisecond)
+	defer cancel()
 	_, err = Mine(ctx, pb)
 	if err == nil {
 		t.Fatal()
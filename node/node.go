@@ -3,16 +3,34 @@ package node
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/1412335/the-blockchain-bar/database"
+	"github.com/1412335/the-blockchain-bar/wallet"
 )
 
 const endpointStatus = "/node/status"
 const endpointAddPeer = "/node/peer"
 const endpointFetchBlocks = "/node/blocks"
+const endpointTx = "/tx/"
+const endpointEscrow = "/escrows/"
+const endpointContract = "/contracts/"
+const endpointAccounts = "/accounts/"
+const endpointBlocks = "/blocks"
+const endpointBlock = "/blocks/"
+const endpointSigners = "/consensus/signers"
+const endpointVote = "/consensus/vote"
+const endpointMining = "/mining"
+const endpointStartMining = "/mining/start"
+const endpointStopMining = "/mining/stop"
+const endpointMiningConfig = "/mining/config"
+const endpointWork = "/mining/work"
+const endpointSubmitWork = "/mining/submit"
 
 const miningIntervalSecs = 10
 
@@ -37,14 +55,41 @@ type Node struct {
 	port    uint64
 
 	state *database.State
+	// headers replace the state of a light node
+	headers *database.HeaderChain
 
 	knownPeers map[string]PeerNode
 
 	archivedTxs    map[string]database.SignedTx
 	pendingTxs     map[string]database.SignedTx
-	isMining       bool
+	rejectedTxs    map[string]string
 	miner          database.Account
+	minerPwd       string
+	fastSync       bool
+	pruneKeep      uint64
+	light          bool
+	miningWorkers  int
 	newSyncedBlock chan database.Block
+	newPendingTx   chan struct{}
+	// announcedBlocks are the blocks peers announced, for the sync loop
+	announcedBlocks chan announcedBlock
+
+	// proposals are the PoA signer changes this node votes for, true to
+	// authorise the account
+	proposals map[database.Account]bool
+
+	workTemplates *workTemplates
+	orphans       *orphanPool
+
+	// chainMu guards the state, the mempool and the proposals, shared by
+	// the mining and sync loops and the API handlers.
+	chainMu sync.Mutex
+
+	miningMu            sync.Mutex
+	miningConfig        MiningConfig
+	miningConfigChanged chan struct{}
+	// miningJob is the last job the miner started, guarded by miningMu
+	miningJob *miningJob
 }
 
 func New(dataDir string, ip string, port uint64, miner database.Account, bootstrap PeerNode) *Node {
@@ -55,15 +100,45 @@ func New(dataDir string, ip string, port uint64, miner database.Account, bootstr
 		knownPeers: map[string]PeerNode{
 			bootstrap.TCPAddress(): bootstrap,
 		},
-		archivedTxs:    make(map[string]database.SignedTx),
-		pendingTxs:     make(map[string]database.SignedTx),
-		isMining:       false,
-		miner:          miner,
-		newSyncedBlock: make(chan database.Block),
+		archivedTxs:     make(map[string]database.SignedTx),
+		pendingTxs:      make(map[string]database.SignedTx),
+		rejectedTxs:     make(map[string]string),
+		miner:           miner,
+		newSyncedBlock:  make(chan database.Block, 1),
+		newPendingTx:    make(chan struct{}, 1),
+		announcedBlocks: make(chan announcedBlock),
+		proposals:       make(map[database.Account]bool),
+		workTemplates:   newWorkTemplates(),
+		orphans:         newOrphanPool(),
+
+		miningConfig:        DefaultMiningConfig(),
+		miningConfigChanged: make(chan struct{}, 1),
 	}
 }
 
+// SetMinerPassword sets the password of the miner keystore account, a PoA
+// node needs its key to sign blocks.
+func (n *Node) SetMinerPassword(pwd string) {
+	n.minerPwd = pwd
+}
+
+// SetFastSync skips the TX signature checks of synced blocks a checkpoint
+// vouches for.
+func (n *Node) SetFastSync(enabled bool) {
+	n.fastSync = enabled
+}
+
+// SetPruning makes the node keep the TXs of the last keep blocks only, 0
+// keeps every block.
+func (n *Node) SetPruning(keep uint64) {
+	n.pruneKeep = keep
+}
+
 func (n *Node) Run(ctx context.Context) error {
+	if n.light {
+		return n.runLight(ctx)
+	}
+
 	fmt.Printf("Listening on HTTP port: %d\n", n.port)
 
 	state, err := database.NewStateFromDisk(n.dataDir)
@@ -72,11 +147,34 @@ func (n *Node) Run(ctx context.Context) error {
 	}
 	defer state.Close()
 
+	n.chainMu.Lock()
 	n.state = state
+	n.chainMu.Unlock()
+	n.state.SetFastSync(n.fastSync)
+	n.state.SetPruning(n.pruneKeep)
+	if n.pruneKeep > 0 {
+		if _, err := n.state.Prune(n.pruneKeep); err != nil {
+			return err
+		}
+	}
+
+	if poa, ok := state.Engine().(*database.PoA); ok && n.minerPwd != "" {
+		privkey, err := wallet.LoadKeystoreKey(n.miner, n.minerPwd, wallet.GetKeystoreDirPath(n.dataDir))
+		if err != nil {
+			return fmt.Errorf("unable to load signer key: %v", err)
+		}
+		poa.Authorize(n.miner, func(hash database.Hash) ([]byte, error) {
+			return wallet.Sign(hash[:], privkey)
+		})
+	}
 
 	fmt.Println("Blockchain state:")
 	fmt.Printf("	- height: %d\n", n.state.LatestBlock().Header.Number)
 	fmt.Printf("	- hash: %x\n", n.state.LatestBlockHash())
+	if heights := n.state.Checkpoints().Heights(); len(heights) > 0 {
+		fmt.Printf("	- checkpoints: %d, last at height %d\n", len(heights), heights[len(heights)-1])
+	}
+	fmt.Printf("Block explorer: http://localhost:%d%s\n", n.port, endpointExplorer)
 
 	go n.sync(ctx)
 	go n.mine(ctx)
@@ -87,10 +185,70 @@ func (n *Node) Run(ctx context.Context) error {
 		listBalancesHandler(w, r, n)
 	})
 
-	handler.HandleFunc("/tx/add", func(w http.ResponseWriter, r *http.Request) {
+	handler.HandleFunc(endpointAddTx, func(w http.ResponseWriter, r *http.Request) {
 		addTransactionHandler(w, r, n)
 	})
 
+	handler.HandleFunc(endpointSubmitTx, func(w http.ResponseWriter, r *http.Request) {
+		submitTransactionHandler(w, r, n)
+	})
+
+	handler.HandleFunc(endpointTx, func(w http.ResponseWriter, r *http.Request) {
+		getTransactionHandler(w, r, n)
+	})
+
+	handler.HandleFunc(endpointEscrow, func(w http.ResponseWriter, r *http.Request) {
+		escrowHandler(w, r, n)
+	})
+
+	handler.HandleFunc(endpointContract, func(w http.ResponseWriter, r *http.Request) {
+		contractHandler(w, r, n)
+	})
+
+	handler.HandleFunc(endpointAccounts, func(w http.ResponseWriter, r *http.Request) {
+		accountTxsHandler(w, r, n)
+	})
+
+	handler.HandleFunc(endpointBlocks, func(w http.ResponseWriter, r *http.Request) {
+		listBlocksHandler(w, r, n)
+	})
+
+	handler.HandleFunc(endpointBlock, func(w http.ResponseWriter, r *http.Request) {
+		blockHandler(w, r, n)
+	})
+
+	handler.HandleFunc(endpointSigners, func(w http.ResponseWriter, r *http.Request) {
+		signersHandler(w, r, n)
+	})
+
+	handler.HandleFunc(endpointVote, func(w http.ResponseWriter, r *http.Request) {
+		voteHandler(w, r, n)
+	})
+
+	handler.HandleFunc(endpointMining, func(w http.ResponseWriter, r *http.Request) {
+		miningHandler(w, r, n)
+	})
+
+	handler.HandleFunc(endpointStartMining, func(w http.ResponseWriter, r *http.Request) {
+		startMiningHandler(w, r, n)
+	})
+
+	handler.HandleFunc(endpointStopMining, func(w http.ResponseWriter, r *http.Request) {
+		stopMiningHandler(w, r, n)
+	})
+
+	handler.HandleFunc(endpointMiningConfig, func(w http.ResponseWriter, r *http.Request) {
+		miningConfigHandler(w, r, n)
+	})
+
+	handler.HandleFunc(endpointWork, func(w http.ResponseWriter, r *http.Request) {
+		workHandler(w, r, n)
+	})
+
+	handler.HandleFunc(endpointSubmitWork, func(w http.ResponseWriter, r *http.Request) {
+		submitWorkHandler(w, r, n)
+	})
+
 	handler.HandleFunc("/node/status", func(w http.ResponseWriter, r *http.Request) {
 		nodeStatusHandler(w, r, n)
 	})
@@ -99,10 +257,37 @@ func (n *Node) Run(ctx context.Context) error {
 		addPeerHandler(w, r, n)
 	})
 
+	handler.HandleFunc(endpointAnnounceBlock, func(w http.ResponseWriter, r *http.Request) {
+		announceBlockHandler(w, r, n)
+	})
+
 	handler.HandleFunc(endpointFetchBlocks, func(w http.ResponseWriter, r *http.Request) {
 		fetchBlocksHandler(w, r, n)
 	})
 
+	handler.HandleFunc(endpointFetchHeaders, func(w http.ResponseWriter, r *http.Request) {
+		fetchHeadersHandler(w, r, n)
+	})
+
+	handler.HandleFunc(endpointBalanceProof, func(w http.ResponseWriter, r *http.Request) {
+		balanceProofHandler(w, r, n)
+	})
+
+	handler.HandleFunc(endpointTxProof, func(w http.ResponseWriter, r *http.Request) {
+		txProofHandler(w, r, n)
+	})
+
+	explorer, err := explorerHandler()
+	if err != nil {
+		return err
+	}
+	handler.Handle(endpointExplorer, explorer)
+
+	return n.serve(ctx, handler)
+}
+
+// serve runs the HTTP API until the context is done.
+func (n *Node) serve(ctx context.Context, handler http.Handler) error {
 	server := &http.Server{
 		Addr:    fmt.Sprintf(":%d", n.port),
 		Handler: handler,
@@ -113,7 +298,7 @@ func (n *Node) Run(ctx context.Context) error {
 		_ = server.Close()
 	}()
 
-	err = server.ListenAndServe()
+	err := server.ListenAndServe()
 	if err == http.ErrServerClosed {
 		return nil
 	}
@@ -129,15 +314,27 @@ func (n *Node) RemovePeer(peer PeerNode) {
 }
 
 func (n *Node) LatestBlockHash() database.Hash {
+	n.chainMu.Lock()
+	defer n.chainMu.Unlock()
+
 	return n.state.LatestBlockHash()
 }
 
+// AddPendingTX adds the TX to the mempool unless it already expired, a TX
+// not valid yet waits there until its window opens.
 func (n *Node) AddPendingTX(signedTx database.SignedTx, peer PeerNode) error {
 	txHash, err := signedTx.Hash()
 	if err != nil {
 		return err
 	}
 
+	n.chainMu.Lock()
+	defer n.chainMu.Unlock()
+
+	if err := signedTx.CheckValidity(n.state.NextBlockHeader()); err != nil && !errors.Is(err, database.ErrTxNotYetValid) {
+		return err
+	}
+
 	txJSON, err := json.Marshal(signedTx)
 	if err != nil {
 		return err
@@ -149,75 +346,232 @@ func (n *Node) AddPendingTX(signedTx database.SignedTx, peer PeerNode) error {
 	if !isPending && !isArchived {
 		fmt.Printf("Added Pending TX %s from Peer %s\n", txJSON, peer.TCPAddress())
 		n.pendingTxs[txHash.Hex()] = signedTx
+
+		select {
+		case n.newPendingTx <- struct{}{}:
+		default:
+		}
 	}
 	return nil
 }
 
 func (n *Node) mine(ctx context.Context) error {
+	// the ticker retries jobs that sealed nothing, e.g. a PoA signer out of turn
 	ticker := time.NewTicker(time.Second * miningIntervalSecs)
+	defer ticker.Stop()
+
+	emptyBlockTimer := time.NewTimer(time.Hour)
+	defer emptyBlockTimer.Stop()
+	emptyBlockDue := false
+
+	resetEmptyBlockTimer := func() {
+		emptyBlockDue = false
+		if !emptyBlockTimer.Stop() {
+			select {
+			case <-emptyBlockTimer.C:
+			default:
+			}
+		}
 
-	var miningCtx context.Context
-	var miningCancel context.CancelFunc
+		interval := n.MiningConfig().EmptyBlockIntervalSecs
+		if interval == 0 {
+			return
+		}
+		n.chainMu.Lock()
+		tipTime := time.Unix(int64(n.state.LatestBlock().Header.Time), 0)
+		n.chainMu.Unlock()
+		wait := time.Until(tipTime.Add(time.Second * time.Duration(interval)))
+		if wait < 0 {
+			wait = 0
+		}
+		emptyBlockTimer.Reset(wait)
+	}
 
-	for {
-		select {
-		case <-ticker.C:
-			go func() {
-				if len(n.pendingTxs) > 0 && !n.isMining {
-					n.isMining = true
+	tip := n.LatestBlockHash()
+	checkTip := func() bool {
+		latest := n.LatestBlockHash()
+		if tip == latest {
+			return false
+		}
+		tip = latest
+		resetEmptyBlockTimer()
+		return true
+	}
 
-					miningCtx, miningCancel = context.WithCancel(ctx)
-					if err := n.miningPendingTxs(miningCtx); err != nil {
-						fmt.Printf("Error: %v\n", err)
-					}
+	var job *miningJob
 
-					n.isMining = false
-				}
-			}()
+	stopMining := func() {
+		if job == nil {
+			return
+		}
+		job.cancel()
+		<-job.done
+		job = nil
+	}
+
+	// startMining (re)builds the block on the current tip and pending TXs
+	startMining := func() {
+		stopMining()
+
+		config := n.MiningConfig()
+		n.chainMu.Lock()
+		idle := len(n.pendingTxs) == 0 && len(n.proposals) == 0
+		n.chainMu.Unlock()
+		if !config.Enabled || (idle && !emptyBlockDue) {
+			return
+		}
+
+		if pow, ok := n.state.Engine().(*database.PoW); ok {
+			pow.SetWorkers(config.Workers)
+		}
+
+		jobCtx, cancel := context.WithCancel(ctx)
+		job = &miningJob{ctx: jobCtx, cancel: cancel, done: make(chan struct{})}
+		n.setMiningJob(job)
+
+		go func(done chan struct{}, allowEmpty bool) {
+			defer close(done)
+
+			if err := n.miningPendingTxs(jobCtx, allowEmpty); err != nil && jobCtx.Err() == nil {
+				fmt.Printf("Error: %v\n", err)
+			}
+		}(job.done, emptyBlockDue)
+	}
+
+	resetEmptyBlockTimer()
+	startMining()
+
+	for {
+		select {
+		case <-job.doneChan():
+			job = nil
+			// a job sealing nothing waits for the next event or tick
+			if checkTip() {
+				startMining()
+			}
+		case <-n.newPendingTx:
+			// TXs arriving during a job go into the next block
+			if job == nil {
+				startMining()
+			}
 		case block := <-n.newSyncedBlock:
-			if n.isMining {
+			if job != nil {
 				hash, err := block.Hash()
 				if err != nil {
 					return err
 				}
 				fmt.Printf("Miner '%s' mined next Block '%x' faster\n", block.Header.Miner.Hex(), hash)
+			}
 
-				if err := n.removeMinedPendingTXs(block); err != nil {
-					return err
-				}
-				miningCancel()
+			n.chainMu.Lock()
+			err := n.removeMinedPendingTXs(block)
+			n.chainMu.Unlock()
+			if err != nil {
+				return err
+			}
+			checkTip()
+			startMining()
+		case <-n.miningConfigChanged:
+			resetEmptyBlockTimer()
+			startMining()
+		case <-emptyBlockTimer.C:
+			emptyBlockDue = true
+			startMining()
+		case <-ticker.C:
+			checkTip()
+			if job == nil {
+				startMining()
 			}
 		case <-ctx.Done():
-			ticker.Stop()
+			stopMining()
 			return nil
 		}
 	}
 }
 
-func (n *Node) miningPendingTxs(ctx context.Context) error {
-	var pendingTxs []database.SignedTx
-	for _, tx := range n.pendingTxs {
-		pendingTxs = append(pendingTxs, tx)
+// miningPendingTxs seals and adds the next block. Without TXs and votes it
+// only seals an empty block when allowEmpty is set.
+func (n *Node) miningPendingTxs(ctx context.Context, allowEmpty bool) error {
+	seal, err := n.prepareNextBlock(allowEmpty)
+	if err != nil || seal == nil {
+		return err
 	}
 
-	pb := NewPendingBlock(n.state.LatestBlockHash(), n.state.NextBlockNumber(), n.miner, pendingTxs)
-
-	minedBlock, err := Mine(ctx, pb)
+	// sealing takes long, the chain keeps moving meanwhile
+	minedBlock, err := seal(ctx)
+	if errors.Is(err, database.ErrNotInTurn) || errors.Is(err, database.ErrUnauthorizedSigner) {
+		return nil
+	}
 	if err != nil {
 		return err
 	}
 
-	if err := n.removeMinedPendingTXs(minedBlock); err != nil {
+	n.chainMu.Lock()
+	_, err = n.state.AddBlock(minedBlock)
+	if err == nil {
+		err = n.removeMinedPendingTXs(minedBlock)
+	}
+	n.chainMu.Unlock()
+	if err != nil {
 		return err
 	}
+	go n.announceBlock(minedBlock)
 
-	if _, err := n.state.AddBlock(minedBlock); err != nil {
-		return err
+	return nil
+}
+
+// prepareNextBlock builds the next block from the mempool and returns the
+// function sealing it, nil when there is nothing to seal.
+func (n *Node) prepareNextBlock(allowEmpty bool) (func(ctx context.Context) (database.Block, error), error) {
+	n.chainMu.Lock()
+	defer n.chainMu.Unlock()
+
+	next := n.state.NextBlockHeader()
+	pb := PendingBlock{next.Parent, next.Number, next.Time, n.miner, n.blockTxs(next)}
+	block := pb.block()
+	block.Header.Vote = n.nextVote()
+
+	if len(block.TXs) == 0 && block.Header.Vote == nil && !allowEmpty {
+		return nil, nil
 	}
 
+	return n.state.PrepareSeal(block)
+}
+
+// nextVote picks the proposal to vote for in the next sealed block. Proposals
+// already applied to the signer set are dropped.
+func (n *Node) nextVote() *database.Vote {
+	if _, ok := n.state.Engine().(*database.PoA); !ok || len(n.proposals) == 0 {
+		return nil
+	}
+
+	authority := n.state.Authority()
+
+	accounts := make([]database.Account, 0, len(n.proposals))
+	for account := range n.proposals {
+		accounts = append(accounts, account)
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].Hex() < accounts[j].Hex()
+	})
+
+	for _, account := range accounts {
+		authorize := n.proposals[account]
+		if authorize == authority.IsSigner(account) {
+			delete(n.proposals, account)
+			continue
+		}
+
+		if voted, ok := authority.Votes[account][n.miner]; ok && voted == authorize {
+			continue
+		}
+		return &database.Vote{Account: account, Authorize: authorize}
+	}
 	return nil
 }
 
+// removeMinedPendingTXs archives the pending TXs of the block, the caller
+// holds chainMu.
 func (n *Node) removeMinedPendingTXs(block database.Block) error {
 	if len(n.pendingTxs) == 0 || len(block.TXs) == 0 {
 		return nil
@@ -238,3 +592,14 @@ func (n *Node) removeMinedPendingTXs(block database.Block) error {
 	}
 	return nil
 }
+
+// notifyNewBlock tells the mining loop a block was added by another path
+// than its own job. It never blocks: a notification already queued makes the
+// loop catch up with the newest tip anyway, and the block TXs were archived
+// by whoever added it.
+func (n *Node) notifyNewBlock(block database.Block) {
+	select {
+	case n.newSyncedBlock <- block:
+	default:
+	}
+}
@@ -169,7 +169,7 @@ func TestNode_MiningStopOnNewSyncedBlock(t *testing.T) {
 
 	tx1 := database.NewTX(wallet.AndrejAccount, wallet.BabayagaAccount, 100, "")
 	tx2 := database.NewTX(wallet.BabayagaAccount, wallet.AndrejAccount, 40, "")
-	tx2Hash, err := tx2.Hash()
+	tx1Hash, err := tx1.Hash()
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -192,8 +192,20 @@ func TestNode_MiningStopOnNewSyncedBlock(t *testing.T) {
 	n := New(datadir, "127.0.0.1", 8088, babayagaAcc, peer)
 
 	errs := make(chan error, 1)
+	synced := make(chan map[database.Account]database.Amount, 1)
 
 	go func() {
+		// the TXs are checked against the state the node loads on start
+		for {
+			n.chainMu.Lock()
+			started := n.state != nil
+			n.chainMu.Unlock()
+			if started {
+				break
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+
 		err := n.AddPendingTX(signedTx1, peer)
 		if err != nil {
 			errs <- err
@@ -208,60 +220,89 @@ func TestNode_MiningStopOnNewSyncedBlock(t *testing.T) {
 	}()
 
 	go func() {
-		time.Sleep(time.Second*miningIntervalSecs + 2)
-		if !n.isMining {
+		// the miner reacts to the pending TXs without waiting for the interval
+		deadline := time.Now().Add(time.Second * 2)
+		for !n.isMining() && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond * 10)
+		}
+		if !n.isMining() {
 			errs <- fmt.Errorf("node should be mining")
 			return
 		}
+		job := n.lastMiningJob()
 
-		if _, err := n.state.AddBlock(minedBlock); err != nil {
+		n.chainMu.Lock()
+		_, err := n.state.AddBlock(minedBlock)
+		balances := make(map[database.Account]database.Amount)
+		for account, balance := range n.state.Balances {
+			balances[account] = balance
+		}
+		n.chainMu.Unlock()
+		if err != nil {
 			errs <- err
 			return
 		}
+		synced <- balances
 
 		n.newSyncedBlock <- minedBlock
 
-		time.Sleep(time.Second * 2)
-		if n.isMining {
-			errs <- fmt.Errorf("node should be stop mining")
+		// the job mining on the old tip stops
+		select {
+		case <-job.done:
+		case <-time.After(time.Second * 5):
+			errs <- fmt.Errorf("node should stop mining on the old tip")
 			return
 		}
-
-		_, tx2InPending := n.pendingTxs[tx2Hash.Hex()]
-
-		if len(n.pendingTxs) != 1 || !tx2InPending {
-			errs <- fmt.Errorf("missing tx2 in pending")
+		if job.ctx.Err() == nil || ctx.Err() != nil {
+			errs <- fmt.Errorf("the job on the old tip should be cancelled, not finished")
 			return
 		}
 
-		time.Sleep(time.Second*miningIntervalSecs + 2)
-		if !n.isMining {
-			errs <- fmt.Errorf("node should be mining tx2")
-			return
+		// and a new one mines tx2 on top of the synced block
+		deadline = time.Now().Add(time.Second * 5)
+		for {
+			n.chainMu.Lock()
+			_, tx1InPending := n.pendingTxs[tx1Hash.Hex()]
+			n.chainMu.Unlock()
+
+			if newJob := n.lastMiningJob(); !tx1InPending && newJob != nil && newJob != job {
+				break
+			}
+			if time.Now().After(deadline) {
+				errs <- fmt.Errorf("node should drop the synced tx1 and mine tx2")
+				return
+			}
+			time.Sleep(time.Millisecond * 10)
 		}
 	}()
 
 	go func() {
 		ticker := time.NewTicker(time.Second * 10)
 		for range ticker.C {
-			if n.state.LatestBlock().Header.Number == 1 {
+			n.chainMu.Lock()
+			number := n.state.LatestBlock().Header.Number
+			n.chainMu.Unlock()
+
+			if number == 1 {
 				cancel()
-				close(errs)
 				return
 			}
 		}
 	}()
 
 	go func() {
-		time.Sleep(time.Second * 2)
-		oldBalances := n.state.Balances
+		oldBalances := <-synced
 
 		<-ctx.Done()
 
+		n.chainMu.Lock()
 		newBalances := n.state.Balances
+		n.chainMu.Unlock()
 
-		expectedAndrejBalance := oldBalances[andrejAcc] - tx1.Value + tx2.Value + database.BlockReward
-		expectedBabayagaBalance := oldBalances[babayagaAcc] + tx1.Value + database.BlockReward
+		// the old balances already include the synced block with tx1, the
+		// node then mined tx2
+		expectedAndrejBalance := oldBalances[andrejAcc] + tx2.Value
+		expectedBabayagaBalance := oldBalances[babayagaAcc] - tx2.Value + database.BlockReward
 
 		if newBalances[andrejAcc] != expectedAndrejBalance {
 			errs <- fmt.Errorf("andrej's balance expected: %d, got: %d", expectedAndrejBalance, newBalances[andrejAcc])
@@ -277,6 +318,7 @@ func TestNode_MiningStopOnNewSyncedBlock(t *testing.T) {
 		t.Logf("Starting BabaYaga balance: %d", oldBalances[babayagaAcc])
 		t.Logf("Ending Andrej balance: %d", newBalances[andrejAcc])
 		t.Logf("Ending BabaYaga balance: %d", newBalances[babayagaAcc])
+		close(errs)
 	}()
 
 	go func() {
@@ -0,0 +1,338 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/1412335/the-blockchain-bar/database"
+)
+
+const endpointAnnounceBlock = "/node/block"
+
+const maxOrphans = 64
+const orphanTTL = 10 * time.Minute
+const announceTimeout = 10 * time.Second
+
+// announcedBlock is a block a peer announced, handed by the API to the sync
+// loop which connects it.
+type announcedBlock struct {
+	peer  PeerNode
+	block database.Block
+	res   chan error
+}
+
+type orphanBlock struct {
+	block   database.Block
+	expires time.Time
+}
+
+// orphanPool keeps the blocks received before their parent, until the parent
+// is connected or they expire.
+type orphanPool struct {
+	mu       sync.Mutex
+	blocks   map[database.Hash]orphanBlock
+	byParent map[database.Hash][]database.Hash
+}
+
+func newOrphanPool() *orphanPool {
+	return &orphanPool{
+		blocks:   make(map[database.Hash]orphanBlock),
+		byParent: make(map[database.Hash][]database.Hash),
+	}
+}
+
+// add keeps the block, evicting the one closest to expiry when the pool is
+// full.
+func (p *orphanPool) add(hash database.Hash, block database.Block, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.blocks[hash]; ok {
+		return
+	}
+
+	p.expire(now)
+	if len(p.blocks) >= maxOrphans {
+		var oldest database.Hash
+		for h, orphan := range p.blocks {
+			if oldest.IsEmpty() || orphan.expires.Before(p.blocks[oldest].expires) {
+				oldest = h
+			}
+		}
+		p.remove(oldest)
+	}
+
+	p.blocks[hash] = orphanBlock{block, now.Add(orphanTTL)}
+	p.byParent[block.Header.Parent] = append(p.byParent[block.Header.Parent], hash)
+}
+
+// takeChildren removes and returns the orphans whose parent is the block.
+func (p *orphanPool) takeChildren(parent database.Hash) []database.Block {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var children []database.Block
+	for _, hash := range p.byParent[parent] {
+		children = append(children, p.blocks[hash].block)
+		delete(p.blocks, hash)
+	}
+	delete(p.byParent, parent)
+
+	return children
+}
+
+func (p *orphanPool) drop(hash database.Hash) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.remove(hash)
+}
+
+func (p *orphanPool) expireAt(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.expire(now)
+}
+
+func (p *orphanPool) len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.blocks)
+}
+
+func (p *orphanPool) expire(now time.Time) {
+	for hash, orphan := range p.blocks {
+		if now.After(orphan.expires) {
+			fmt.Printf("Orphan block '%x' expired\n", hash)
+			p.remove(hash)
+		}
+	}
+}
+
+func (p *orphanPool) remove(hash database.Hash) {
+	orphan, ok := p.blocks[hash]
+	if !ok {
+		return
+	}
+	delete(p.blocks, hash)
+
+	parent := orphan.block.Header.Parent
+	siblings := p.byParent[parent][:0]
+	for _, h := range p.byParent[parent] {
+		if h != hash {
+			siblings = append(siblings, h)
+		}
+	}
+	if len(siblings) == 0 {
+		delete(p.byParent, parent)
+		return
+	}
+	p.byParent[parent] = siblings
+}
+
+// handOverBlock passes a block announced by a peer to the sync loop and
+// waits until the loop received it.
+func (n *Node) handOverBlock(ctx context.Context, peer PeerNode, block database.Block) error {
+	announced := announcedBlock{peer, block, make(chan error, 1)}
+
+	select {
+	case n.announcedBlocks <- announced:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-announced.res:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// receiveBlock handles a block a peer sent, from the sync loop. A block
+// extending the chain is added right away, one with an unknown parent and a
+// valid seal waits in the orphan pool while the missing blocks are fetched
+// from the known peers.
+func (n *Node) receiveBlock(ctx context.Context, peer PeerNode, block database.Block) error {
+	hash, err := block.Hash()
+	if err != nil {
+		return err
+	}
+
+	n.chainMu.Lock()
+	_, errUnknown := n.state.GetBlockByHash(hash)
+	extends := n.extendsChain(block)
+	nextNumber := n.state.NextBlockNumber()
+	latestHash := n.state.LatestBlockHash()
+	n.chainMu.Unlock()
+
+	if errUnknown == nil {
+		return nil
+	}
+
+	if extends {
+		return n.connectBlock(block)
+	}
+
+	if block.Header.Number < nextNumber {
+		return fmt.Errorf("block '%x' at height %d doesn't extend the chain", hash, block.Header.Number)
+	}
+
+	// forged blocks would evict the real orphans
+	if err := n.state.Engine().VerifySeal(block); err != nil {
+		return fmt.Errorf("orphan block '%x' rejected: %v", hash, err)
+	}
+
+	fmt.Printf("Orphan block '%x' at height %d from Peer %s, fetching its parents\n", hash, block.Header.Number, peer.TCPAddress())
+	n.orphans.add(hash, block, time.Now())
+
+	blocks, err := n.fetchBlocksFromKnownPeers(ctx, peer, latestHash)
+	if err != nil {
+		return fmt.Errorf("orphan block '%x' kept, unable to fetch its parents: %v", hash, err)
+	}
+	return n.connectBlocks(blocks)
+}
+
+// fetchBlocksFromKnownPeers fetches the blocks after the hash from the first
+// known peer answering in time, the announcing peer first if it's known. The
+// announce names any address, it's never fetched from otherwise.
+func (n *Node) fetchBlocksFromKnownPeers(ctx context.Context, announcer PeerNode, hash database.Hash) ([]database.Block, error) {
+	peers := make([]PeerNode, 0, len(n.knownPeers))
+	if known, ok := n.knownPeers[announcer.TCPAddress()]; ok {
+		peers = append(peers, known)
+	}
+	for _, peer := range n.knownPeers {
+		if peer.TCPAddress() != announcer.TCPAddress() {
+			peers = append(peers, peer)
+		}
+	}
+
+	err := fmt.Errorf("no known peer")
+	for _, peer := range peers {
+		if peer.IP == n.ip && peer.Port == n.port {
+			continue
+		}
+
+		fetchCtx, cancel := context.WithTimeout(ctx, announceTimeout)
+		var blocks []database.Block
+		blocks, err = fetchBlocksFromPeer(fetchCtx, peer, hash)
+		cancel()
+		if err == nil {
+			return blocks, nil
+		}
+		fmt.Printf("Error: unable to fetch blocks from Peer %s: %v\n", peer.TCPAddress(), err)
+	}
+	return nil, err
+}
+
+// connectBlocks checks a segment of fetched blocks against the checkpoints,
+// then connects the ones extending the chain.
+func (n *Node) connectBlocks(blocks []database.Block) error {
+	n.chainMu.Lock()
+	err := n.state.VerifyCheckpoints(blocks)
+	n.chainMu.Unlock()
+	if err != nil {
+		return err
+	}
+	defer n.forgetSegment()
+
+	for _, block := range blocks {
+		n.chainMu.Lock()
+		extends := n.extendsChain(block)
+		n.chainMu.Unlock()
+		if !extends {
+			continue
+		}
+		if err := n.connectBlock(block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// forgetSegment drops the checkpoint marks of the blocks of a verified
+// segment that weren't added.
+func (n *Node) forgetSegment() {
+	n.chainMu.Lock()
+	defer n.chainMu.Unlock()
+
+	n.state.ForgetSegment()
+}
+
+// extendsChain tells whether the block is the next one, the caller holds
+// chainMu.
+func (n *Node) extendsChain(block database.Block) bool {
+	if n.state.LatestBlockHash().IsEmpty() {
+		return block.Header.Number == 0
+	}
+	return block.Header.Parent == n.state.LatestBlockHash() && block.Header.Number == n.state.NextBlockNumber()
+}
+
+// connectBlock adds the block and then the orphans waiting for it.
+func (n *Node) connectBlock(block database.Block) error {
+	n.chainMu.Lock()
+	hash, err := n.state.AddBlock(block)
+	if err == nil {
+		err = n.removeMinedPendingTXs(block)
+	}
+	n.chainMu.Unlock()
+	if err != nil {
+		return err
+	}
+	n.orphans.drop(hash)
+
+	// alert sync block & stop mining that block
+	n.notifyNewBlock(block)
+
+	for _, child := range n.orphans.takeChildren(hash) {
+		n.chainMu.Lock()
+		extends := n.extendsChain(child)
+		n.chainMu.Unlock()
+		if !extends {
+			continue
+		}
+		if err := n.connectBlock(child); err != nil {
+			fmt.Printf("Error: unable to connect orphan block: %v\n", err)
+		}
+	}
+	return nil
+}
+
+// announceBlock sends a block this node produced to its known peers.
+func (n *Node) announceBlock(block database.Block) {
+	reqJSON, err := json.Marshal(AnnounceBlockReq{NewPeerNode(n.ip, n.port, false, true), block})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	for _, peer := range n.knownPeers {
+		if peer.IP == n.ip && peer.Port == n.port {
+			continue
+		}
+
+		if err := postBlock(peer, reqJSON); err != nil {
+			fmt.Printf("Error: unable to announce block to Peer %s: %v\n", peer.TCPAddress(), err)
+		}
+	}
+}
+
+func postBlock(peer PeerNode, reqJSON []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), announceTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://%s%s", peer.TCPAddress(), endpointAnnounceBlock), bytes.NewReader(reqJSON))
+	if err != nil {
+		return err
+	}
+
+	var res AnnounceBlockRes
+	return doRequest(req, &res)
+}
@@ -0,0 +1,100 @@
+package node
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/1412335/the-blockchain-bar/database"
+)
+
+func TestOrphanPool(t *testing.T) {
+	pool := newOrphanPool()
+	now := time.Now()
+
+	parent := database.Hash{1}
+	for i := 0; i < maxOrphans+1; i++ {
+		block := database.NewBlock(parent, 5, uint64(i), 0, database.Account{}, nil)
+		pool.add(database.Hash{2, byte(i)}, block, now.Add(time.Duration(i)*time.Second))
+	}
+
+	if pool.len() != maxOrphans {
+		t.Fatalf("expected the pool bounded to %d orphans, got %d", maxOrphans, pool.len())
+	}
+	if _, ok := pool.blocks[database.Hash{2, 0}]; ok {
+		t.Fatal("expected the oldest orphan evicted")
+	}
+
+	pool.expireAt(now.Add(orphanTTL + time.Duration(maxOrphans-1)*time.Second + time.Millisecond))
+	if pool.len() != 1 {
+		t.Fatalf("expected 1 orphan left after expiry, got %d", pool.len())
+	}
+
+	children := pool.takeChildren(parent)
+	if len(children) != 1 || children[0].Header.Time != maxOrphans {
+		t.Fatalf("expected the newest orphan as child, got %v", children)
+	}
+	if pool.len() != 0 || len(pool.byParent) != 0 {
+		t.Fatal("expected an empty pool after taking the children")
+	}
+}
+
+func TestReceiveOrphanBlock(t *testing.T) {
+	source, key := newInstantTestNode(t)
+	for i := 0; i < 3; i++ {
+		addTestBlock(t, source)
+	}
+	tip := source.state.LatestBlock()
+
+	peerServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetchBlocksHandler(w, r, source)
+	}))
+	defer peerServer.Close()
+
+	announcerFetches := 0
+	announcerServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		announcerFetches++
+		fetchBlocksHandler(w, r, source)
+	}))
+	defer announcerServer.Close()
+
+	n := newInstantTestNodeFunding(t, key)
+	knownPeer, announcer := testServerPeer(t, peerServer), testServerPeer(t, announcerServer)
+	n.AddPeer(knownPeer)
+
+	// a forged seal never gets in the pool
+	forged := tip
+	forged.Header.Signature = []byte{1}
+	if err := n.receiveBlock(context.Background(), announcer, forged); err == nil || n.orphans.len() != 0 {
+		t.Fatalf("expected a block with an invalid seal rejected, got %d orphans: %v", n.orphans.len(), err)
+	}
+
+	// the parents of an orphan come from the known peers only
+	if err := n.receiveBlock(context.Background(), announcer, tip); err != nil {
+		t.Fatal(err)
+	}
+	if announcerFetches != 0 {
+		t.Fatalf("expected no fetch from the unknown announcing peer, got %d", announcerFetches)
+	}
+	if n.state.LatestBlockHash() != source.state.LatestBlockHash() || n.orphans.len() != 0 {
+		t.Fatalf("expected the orphan connected after its parents, got tip %x and %d orphans", n.state.LatestBlockHash(), n.orphans.len())
+	}
+}
+
+// testServerPeer is the peer listening at the test server address.
+func testServerPeer(t *testing.T, server *httptest.Server) PeerNode {
+	host, portRaw, err := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.ParseUint(portRaw, 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewPeerNode(host, port, false, true)
+}
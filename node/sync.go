@@ -3,6 +3,7 @@ package node
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -20,9 +21,14 @@ func (n *Node) sync(ctx context.Context) error {
 			fmt.Println("Searching for new Peer and Block...")
 
 			n.fetchNewBlocksAndPeers(ctx)
+			n.orphans.expireAt(time.Now())
+
+		case announced := <-n.announcedBlocks:
+			announced.res <- n.receiveBlock(ctx, announced.peer, announced.block)
 
 		case <-ctx.Done():
 			ticker.Stop()
+			return nil
 		}
 	}
 }
@@ -44,6 +50,12 @@ func (n *Node) fetchNewBlocksAndPeers(ctx context.Context) {
 			continue
 		}
 
+		// light nodes have no blocks to sync
+		if status.Light {
+			n.syncKnownPeers(status.KnownPeers)
+			continue
+		}
+
 		if err := n.joinKnownPeers(ctx, knownPeer); err != nil {
 			fmt.Printf("Error: %v\n", err)
 			continue
@@ -104,7 +116,11 @@ func (n *Node) joinKnownPeers(ctx context.Context, peer PeerNode) error {
 
 // Fetch blocks from peer
 func (n *Node) syncBlocks(ctx context.Context, peer PeerNode, status StatusRes) error {
+	n.chainMu.Lock()
 	localBlockNumber := n.state.LatestBlock().Header.Number
+	latestHash := n.state.LatestBlockHash()
+	nextNumber := n.state.NextBlockNumber()
+	n.chainMu.Unlock()
 
 	if status.Hash.IsEmpty() {
 		return nil
@@ -114,7 +130,7 @@ func (n *Node) syncBlocks(ctx context.Context, peer PeerNode, status StatusRes)
 		return nil
 	}
 
-	if status.Number == 0 && !n.state.LatestBlockHash().IsEmpty() {
+	if status.Number == 0 && !latestHash.IsEmpty() {
 		return nil
 	}
 
@@ -128,17 +144,29 @@ func (n *Node) syncBlocks(ctx context.Context, peer PeerNode, status StatusRes)
 		return nil
 	}
 
-	blocks, err := fetchBlocksFromPeer(ctx, peer, n.state.LatestBlockHash())
+	if status.ServesFrom > nextNumber {
+		return fmt.Errorf("peer %s pruned the blocks before %d, this node needs them from %d", peer.TCPAddress(), status.ServesFrom, nextNumber)
+	}
+
+	blocks, err := fetchBlocksFromPeer(ctx, peer, latestHash)
 	if err != nil {
 		return err
 	}
 
+	// a peer serving a chain off the checkpoints is rejected before any of its
+	// blocks is added
+	n.chainMu.Lock()
+	err = n.state.VerifyCheckpoints(blocks)
+	n.chainMu.Unlock()
+	if err != nil {
+		return fmt.Errorf("peer %s: %v", peer.TCPAddress(), err)
+	}
+	defer n.forgetSegment()
+
 	for _, block := range blocks {
-		if _, err := n.state.AddBlock(block); err != nil {
+		if err := n.connectBlock(block); err != nil {
 			return err
 		}
-		// alert sync block & stop mining that block
-		n.newSyncedBlock <- block
 	}
 	return nil
 }
@@ -158,7 +186,11 @@ func (n *Node) syncKnownPeers(knownPeers map[string]PeerNode) {
 
 func (n *Node) syncPendingTXs(peer PeerNode, pendingTXs []database.SignedTx) error {
 	for _, tx := range pendingTXs {
-		if err := n.AddPendingTX(tx, peer); err != nil {
+		// the peer keeps expired TXs until it mines a block, the others are
+		// still worth taking
+		if err := n.AddPendingTX(tx, peer); errors.Is(err, database.ErrTxExpired) {
+			continue
+		} else if err != nil {
 			return err
 		}
 	}
@@ -2,7 +2,10 @@ package node
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+
+	"github.com/1412335/the-blockchain-bar/database"
 )
 
 func writeResponse(w http.ResponseWriter, data interface{}) {
@@ -17,10 +20,16 @@ func writeResponse(w http.ResponseWriter, data interface{}) {
 	w.Write(content)
 }
 
+// writeErrorResponse answers 404 for an unknown block, 500 otherwise.
 func writeErrorResponse(w http.ResponseWriter, err error) {
 	errJSON, _ := json.Marshal(ErrRes{err.Error()})
 
+	status := http.StatusInternalServerError
+	if errors.Is(err, database.ErrUnknownBlock) {
+		status = http.StatusNotFound
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusInternalServerError)
+	w.WriteHeader(status)
 	w.Write(errJSON)
 }
@@ -0,0 +1,173 @@
+package node
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/1412335/the-blockchain-bar/database"
+)
+
+// maxWorkTemplates bounds the templates kept for submissions, older ones
+// are forgotten.
+const maxWorkTemplates = 16
+
+// workTemplate is a block waiting for an external miner to find its nonce.
+type workTemplate struct {
+	id     database.Hash
+	block  database.Block
+	prefix []byte
+	suffix []byte
+	// key identifies the tip and mempool the template was built from.
+	key string
+}
+
+// workTemplates hands out block templates to external miners. A template is
+// rebuilt when the chain tip or the mempool changes.
+type workTemplates struct {
+	mu sync.Mutex
+
+	current   map[database.Account]*workTemplate
+	templates map[database.Hash]*workTemplate
+	order     []database.Hash
+}
+
+func newWorkTemplates() *workTemplates {
+	return &workTemplates{
+		current:   make(map[database.Account]*workTemplate),
+		templates: make(map[database.Hash]*workTemplate),
+	}
+}
+
+// work returns the template for the miner, building a new one when the tip
+// or the mempool changed since the last one.
+func (n *Node) work(miner database.Account) (*workTemplate, error) {
+	n.chainMu.Lock()
+	defer n.chainMu.Unlock()
+
+	if _, ok := n.state.Engine().(*database.PoW); !ok {
+		return nil, fmt.Errorf("external mining needs the pow consensus engine, the chain uses %s", n.state.Engine().Name())
+	}
+
+	next := n.state.NextBlockHeader()
+	txs := n.blockTxs(next)
+	key, err := workKey(n.state.LatestBlockHash(), txs)
+	if err != nil {
+		return nil, err
+	}
+
+	n.workTemplates.mu.Lock()
+	defer n.workTemplates.mu.Unlock()
+
+	if current, ok := n.workTemplates.current[miner]; ok && current.key == key {
+		return current, nil
+	}
+
+	if len(txs) == 0 {
+		return nil, fmt.Errorf("no pending TXs to mine")
+	}
+
+	block, err := n.state.Prepare(database.NewBlock(next.Parent, next.Number, next.Time, 0, miner, txs))
+	if err != nil {
+		return nil, err
+	}
+
+	prefix, suffix, err := database.SplitOnNonce(block)
+	if err != nil {
+		return nil, err
+	}
+
+	template := &workTemplate{
+		id:     sha256.Sum256(append(append([]byte{}, prefix...), suffix...)),
+		block:  block,
+		prefix: prefix,
+		suffix: suffix,
+		key:    key,
+	}
+	n.workTemplates.add(miner, template)
+
+	return template, nil
+}
+
+func (w *workTemplates) add(miner database.Account, template *workTemplate) {
+	w.current[miner] = template
+	w.templates[template.id] = template
+	w.order = append(w.order, template.id)
+
+	for len(w.order) > maxWorkTemplates {
+		delete(w.templates, w.order[0])
+		w.order = w.order[1:]
+	}
+}
+
+func (w *workTemplates) get(id database.Hash) (*workTemplate, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	template, ok := w.templates[id]
+	return template, ok
+}
+
+// submitWork imports the template block solved with the nonce.
+func (n *Node) submitWork(id database.Hash, nonce uint32) (database.Hash, error) {
+	template, ok := n.workTemplates.get(id)
+	if !ok {
+		return database.Hash{}, fmt.Errorf("unknown or expired work %x", id)
+	}
+
+	block := template.block
+	block.Header.Nonce = nonce
+
+	n.chainMu.Lock()
+	hash, err := n.state.AddBlock(block)
+	if err == nil {
+		err = n.removeMinedPendingTXs(block)
+	}
+	n.chainMu.Unlock()
+	if err != nil {
+		return database.Hash{}, err
+	}
+	fmt.Printf("External miner '%s' mined Block '%x'\n", block.Header.Miner.Hex(), hash)
+
+	// stop mining the same block locally
+	n.notifyNewBlock(block)
+	go n.announceBlock(block)
+
+	return hash, nil
+}
+
+// blockTxs returns the pending TXs the block with the given header can
+// include, oldest first. Failing and expired TXs are dropped from the mempool,
+// the ones not valid yet stay until their window opens. The caller holds
+// chainMu.
+func (n *Node) blockTxs(header database.BlockHeader) []database.SignedTx {
+	var pendingTxs []database.SignedTx
+	for _, tx := range n.pendingTxs {
+		pendingTxs = append(pendingTxs, tx)
+	}
+	sort.Slice(pendingTxs, func(i, j int) bool {
+		return pendingTxs[i].Time < pendingTxs[j].Time
+	})
+
+	// a single failing TX would invalidate the whole block
+	pendingTxs, rejected := n.state.FilterTxs(pendingTxs, header)
+	for txHash, err := range rejected {
+		fmt.Printf("\t-dropping failed TX %s: %v\n", txHash.Hex(), err)
+		delete(n.pendingTxs, txHash.Hex())
+		n.rejectedTxs[txHash.Hex()] = err.Error()
+	}
+	return pendingTxs
+}
+
+func workKey(tip database.Hash, txs []database.SignedTx) (string, error) {
+	key := tip.Hex()
+	for _, tx := range txs {
+		txHash, err := tx.Hash()
+		if err != nil {
+			return "", err
+		}
+		key += txHash.Hex()
+	}
+	return key, nil
+}
@@ -0,0 +1,76 @@
+package node
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/1412335/the-blockchain-bar/database"
+	"github.com/1412335/the-blockchain-bar/wallet"
+)
+
+// TestNode_SubmitWorkWhileMining serves work to an external miner while the
+// node mines the same mempool, run it with -race.
+func TestNode_SubmitWorkWhileMining(t *testing.T) {
+	datadir, err := ioutil.TempDir("", "tbb-work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(datadir)
+
+	if err := copyKeystoreFileIntoTestDataDir(datadir, andrejAccKeystore); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := database.NewStateFromDisk(datadir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	andrejAcc := database.NewAccount(wallet.AndrejAccount)
+	babayagaAcc := database.NewAccount(wallet.BabayagaAccount)
+	peer := NewPeerNode("127.0.0.1", 8087, true, true)
+
+	key, err := wallet.LoadKeystoreKey(andrejAcc, andrejAccPwd, wallet.GetKeystoreDirPath(datadir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := New(datadir, "127.0.0.1", 8089, andrejAcc, peer)
+	n.state = state
+
+	ctx, cancel := context.WithCancel(context.Background())
+	mined := make(chan error, 1)
+	go func() {
+		mined <- n.mine(ctx)
+	}()
+
+	for i := 0; i < 10; i++ {
+		tx := database.NewTX(wallet.AndrejAccount, wallet.BabayagaAccount, 1, "")
+		tx.Time += uint64(i)
+		signedTx, err := wallet.SignTx(tx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := n.AddPendingTX(signedTx, peer); err != nil {
+			t.Fatal(err)
+		}
+
+		template, err := n.work(babayagaAcc)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// an unsolved nonce still goes through the whole import
+		if _, err := n.submitWork(template.id, 0); err == nil {
+			t.Fatal("expected unsolved work to be rejected")
+		}
+	}
+
+	cancel()
+	if err := <-mined; err != nil {
+		t.Fatal(err)
+	}
+}
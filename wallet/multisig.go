@@ -0,0 +1,108 @@
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/1412335/the-blockchain-bar/database"
+)
+
+const multisigDirName = "multisig"
+
+func GetMultisigDirPath(dir string) string {
+	return filepath.Join(dir, multisigDirName)
+}
+
+func getMultisigFilePath(dir string, account database.Account) string {
+	return filepath.Join(GetMultisigDirPath(dir), account.Hex()+".json")
+}
+
+// SaveMultisig stores the definition of a multisig account in the data dir,
+// TXs from the account are built from it.
+func SaveMultisig(dir string, multisig database.Multisig) (database.Account, error) {
+	if err := multisig.Validate(); err != nil {
+		return database.Account{}, err
+	}
+
+	if err := os.MkdirAll(GetMultisigDirPath(dir), 0700); err != nil {
+		return database.Account{}, err
+	}
+
+	multisigJSON, err := json.MarshalIndent(multisig, "", "  ")
+	if err != nil {
+		return database.Account{}, err
+	}
+
+	account := multisig.Account()
+	return account, ioutil.WriteFile(getMultisigFilePath(dir, account), multisigJSON, 0600)
+}
+
+func LoadMultisig(dir string, account database.Account) (database.Multisig, error) {
+	multisigJSON, err := ioutil.ReadFile(getMultisigFilePath(dir, account))
+	if err != nil {
+		return database.Multisig{}, fmt.Errorf("unknown multisig account %s: %v", account.Hex(), err)
+	}
+
+	var multisig database.Multisig
+	if err := json.Unmarshal(multisigJSON, &multisig); err != nil {
+		return database.Multisig{}, err
+	}
+	return multisig, multisig.Validate()
+}
+
+// NewMultisigTx builds a TX from the multisig account without signatures,
+// its signers then co-sign it one after another.
+func NewMultisigTx(tx database.TX, multisig database.Multisig) (database.SignedTx, error) {
+	if account := multisig.Account(); tx.From != account {
+		return database.SignedTx{}, fmt.Errorf("TX sender %s isn't the multisig account %s", tx.From.Hex(), account.Hex())
+	}
+	return database.SignedTx{TX: tx, Multisig: &multisig}, nil
+}
+
+// CoSignTx adds the signature of one of the multisig signers to the TX.
+func CoSignTx(tx database.SignedTx, privkey *ecdsa.PrivateKey) (database.SignedTx, error) {
+	if tx.Multisig == nil {
+		return database.SignedTx{}, fmt.Errorf("TX isn't from a multisig account")
+	}
+
+	signer := PublicKeyToAccount(privkey.PublicKey)
+	if !tx.Multisig.IsSigner(privkey.PublicKey) {
+		return database.SignedTx{}, fmt.Errorf("%s isn't a signer of %s", signer.Hex(), tx.From.Hex())
+	}
+
+	signers, err := tx.MultisigSigners()
+	if err != nil {
+		return database.SignedTx{}, err
+	}
+	for _, s := range signers {
+		if s == signer {
+			return database.SignedTx{}, fmt.Errorf("%s already signed the TX", signer.Hex())
+		}
+	}
+
+	txEncoded, err := tx.TX.Encode()
+	if err != nil {
+		return database.SignedTx{}, err
+	}
+
+	sign, err := Sign(txEncoded, privkey)
+	if err != nil {
+		return database.SignedTx{}, err
+	}
+
+	tx.Signs = append(append([][]byte{}, tx.Signs...), sign)
+	return tx, nil
+}
+
+func CoSignTxWithKeystoreAccount(tx database.SignedTx, account database.Account, pwd string, dir string) (database.SignedTx, error) {
+	privkey, err := LoadKeystoreKey(account, pwd, dir)
+	if err != nil {
+		return database.SignedTx{}, err
+	}
+
+	return CoSignTx(tx, privkey)
+}
@@ -32,23 +32,33 @@ func NewKeyStoreAccount(dir, pwd string) (database.Account, error) {
 }
 
 func SignTxWithKeystoreAccount(tx database.TX, account database.Account, pwd string, dir string) (database.SignedTx, error) {
+	privkey, err := LoadKeystoreKey(account, pwd, dir)
+	if err != nil {
+		return database.SignedTx{}, err
+	}
+
+	return SignTx(tx, privkey)
+}
+
+// LoadKeystoreKey decrypts the private key of a keystore account.
+func LoadKeystoreKey(account database.Account, pwd string, dir string) (*ecdsa.PrivateKey, error) {
 	ks := keystore.NewKeyStore(dir, keystore.StandardScryptN, keystore.StandardScryptP)
 	acc, err := ks.Find(accounts.Account{Address: common.Address(account)})
 	if err != nil {
-		return database.SignedTx{}, err
+		return nil, err
 	}
 
 	ksAccountJSON, err := ioutil.ReadFile(acc.URL.Path)
 	if err != nil {
-		return database.SignedTx{}, err
+		return nil, err
 	}
 
 	key, err := keystore.DecryptKey(ksAccountJSON, pwd)
 	if err != nil {
-		return database.SignedTx{}, err
+		return nil, err
 	}
 
-	return SignTx(tx, key.PrivateKey)
+	return key.PrivateKey, nil
 }
 
 func SignTx(tx database.TX, privkey *ecdsa.PrivateKey) (database.SignedTx, error) {
@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"testing"
 
+	"github.com/1412335/the-blockchain-bar/database"
 	"github.com/ethereum/go-ethereum/crypto"
 )
 
@@ -33,3 +34,88 @@ func TestSign(t *testing.T) {
 		t.Fatalf("msg signed by %s, got %s", account.Hex(), recoveredAccount.Hex())
 	}
 }
+
+func TestCoSignTx(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 3)
+	pubkeys := make([]database.PubKey, 3)
+	for i := range keys {
+		privkey, err := ecdsa.GenerateKey(crypto.S256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = privkey
+		pubkeys[i] = database.NewPubKey(privkey.PublicKey)
+	}
+
+	multisig, err := database.NewMultisig(2, pubkeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := database.NewTX(multisig.Account().Hex(), BabayagaAccount, 100, "")
+	signedTx, err := NewMultisigTx(tx, multisig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signedTx, err = CoSignTx(signedTx, keys[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CoSignTx(signedTx, keys[2]); err == nil {
+		t.Fatal("expected a second signature of the same signer to be refused")
+	}
+	if isAuth, err := signedTx.IsAuthentic(); isAuth || err == nil {
+		t.Fatal("expected a TX with 1 of 2 signatures not to be authentic")
+	}
+
+	signedTx, err = CoSignTx(signedTx, keys[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isAuth, err := signedTx.IsAuthentic(); !isAuth || err != nil {
+		t.Fatalf("expected a TX with 2 of 2 signatures to be authentic: %v", err)
+	}
+
+	// the signatures are bound to the TX
+	signedTx.Value = 1000
+	if isAuth, _ := signedTx.IsAuthentic(); isAuth {
+		t.Fatal("expected a TX changed after signing not to be authentic")
+	}
+
+	outsider, err := ecdsa.GenerateKey(crypto.S256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CoSignTx(signedTx, outsider); err == nil {
+		t.Fatal("expected a signature of a non-signer to be refused")
+	}
+}
+
+func TestSignTx(t *testing.T) {
+	privkey, err := ecdsa.GenerateKey(crypto.S256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	from := PublicKeyToAccount(privkey.PublicKey)
+	tx := database.NewTX(from.Hex(), database.NewAccount("0x02").Hex(), 10, "")
+
+	signedTx, err := SignTx(tx, privkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	isAuth, err := signedTx.IsAuthentic()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isAuth {
+		t.Fatalf("expected the TX signed by %s to be authentic", from.Hex())
+	}
+
+	signedTx.Value = 11
+	if isAuth, err := signedTx.IsAuthentic(); err == nil && isAuth {
+		t.Fatal("expected a tampered TX not to be authentic")
+	}
+}